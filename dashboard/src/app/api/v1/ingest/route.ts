@@ -1,6 +1,6 @@
 import { NextRequest, NextResponse } from 'next/server';
 import { db } from '@/lib/db';
-import { probes, measurements } from '@/lib/db/schema';
+import { probes, measurements, networkEvents } from '@/lib/db/schema';
 import { ingestPayloadSchema } from '@/lib/validation/ingest';
 import { eq } from 'drizzle-orm';
 import { authenticateProbe } from '@/lib/auth/api-key';
@@ -87,10 +87,45 @@ export async function POST(request: NextRequest) {
       packetLoss: m.packet_loss,
       dnsTime: m.dns_time,
       bufferbloat: m.bufferbloat,
+      resolveTime: m.resolve_time ?? null,
+      connectTime: m.connect_time ?? null,
+      tlsTime: m.tls_time ?? null,
+      ttfb: m.ttfb ?? null,
+      transferTime: m.transfer_time ?? null,
+      totalTime: m.total_time ?? null,
+      statusCode: m.status_code ?? null,
+      latencyIdle: m.latency_idle ?? null,
+      latencyLoadedDownload: m.latency_loaded_download ?? null,
+      latencyLoadedUpload: m.latency_loaded_upload ?? null,
+      bufferbloatDownload: m.bufferbloat_download ?? null,
+      bufferbloatUpload: m.bufferbloat_upload ?? null,
+      downloadMbps: m.download_mbps ?? null,
+      uploadMbps: m.upload_mbps ?? null,
+      bytesTransferred: m.bytes_transferred ?? null,
+      rFactor: m.r_factor ?? null,
+      mos: m.mos ?? null,
+      voipCodec: m.voip_codec ?? null,
+      captivePortal: m.captive_portal ?? null,
+      contentInjected: m.content_injected ?? null,
+      transparentProxy: m.transparent_proxy ?? null,
+      tlsIntercepted: m.tls_intercepted ?? null,
     }));
 
     await db.insert(measurements).values(rows).onConflictDoNothing();
 
+    const eventRows = (payload.events ?? []).map((e) => ({
+      time: new Date(e.timestamp),
+      probeId: probe.id,
+      type: e.type,
+      previous: e.previous ?? null,
+      current: e.current,
+      detail: e.detail ?? null,
+    }));
+
+    if (eventRows.length > 0) {
+      await db.insert(networkEvents).values(eventRows).onConflictDoNothing();
+    }
+
     // Emit events to SSE clients
     for (const m of payload.measurements) {
       eventBus.emit(probe.id, {
@@ -105,7 +140,8 @@ export async function POST(request: NextRequest) {
       .where(eq(probes.id, probe.id));
 
     return NextResponse.json(
-      { accepted: rows.length, rejected: 0 },
+      // Probes only mark events synced when this count is present.
+      { accepted: rows.length, rejected: 0, events: eventRows.length },
       { status: 200 }
     );
   } catch (error) {
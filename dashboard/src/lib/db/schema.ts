@@ -6,6 +6,7 @@ import {
   boolean,
   real,
   integer,
+  bigint,
   jsonb,
   doublePrecision,
   index,
@@ -90,6 +91,28 @@ export const measurements = pgTable(
     packetLoss: doublePrecision('packet_loss'),
     dnsTime: doublePrecision('dns_time'),
     bufferbloat: doublePrecision('bufferbloat'),
+    resolveTime: doublePrecision('resolve_time'),
+    connectTime: doublePrecision('connect_time'),
+    tlsTime: doublePrecision('tls_time'),
+    ttfb: doublePrecision('ttfb'),
+    transferTime: doublePrecision('transfer_time'),
+    totalTime: doublePrecision('total_time'),
+    statusCode: integer('status_code'),
+    latencyIdle: doublePrecision('latency_idle'),
+    latencyLoadedDownload: doublePrecision('latency_loaded_download'),
+    latencyLoadedUpload: doublePrecision('latency_loaded_upload'),
+    bufferbloatDownload: doublePrecision('bufferbloat_download'),
+    bufferbloatUpload: doublePrecision('bufferbloat_upload'),
+    downloadMbps: doublePrecision('download_mbps'),
+    uploadMbps: doublePrecision('upload_mbps'),
+    bytesTransferred: bigint('bytes_transferred', { mode: 'number' }),
+    rFactor: doublePrecision('r_factor'),
+    mos: doublePrecision('mos'),
+    voipCodec: text('voip_codec'),
+    captivePortal: boolean('captive_portal'),
+    contentInjected: boolean('content_injected'),
+    transparentProxy: boolean('transparent_proxy'),
+    tlsIntercepted: boolean('tls_intercepted'),
   },
   (table) => ({
     probeTimeIdx: index('measurements_probe_time_idx').on(
@@ -101,6 +124,29 @@ export const measurements = pgTable(
   })
 );
 
+export const networkEvents = pgTable(
+  'network_events',
+  {
+    id: uuid('id').primaryKey().defaultRandom(),
+    time: timestamp('time', { withTimezone: true }).notNull(),
+    probeId: uuid('probe_id')
+      .notNull()
+      .references(() => probes.id),
+    type: text('type').notNull(),
+    previous: text('previous'),
+    current: text('current').notNull(),
+    detail: text('detail'),
+  },
+  (table) => ({
+    probeTimeIdx: index('network_events_probe_time_idx').on(
+      table.probeId,
+      table.time.desc()
+    ),
+    probeTimeTypeUniq: uniqueIndex('network_events_probe_time_type_uniq')
+      .on(table.probeId, table.time, table.type),
+  })
+);
+
 export type Probe = InferSelectModel<typeof probes>;
 export type InsertProbe = InferInsertModel<typeof probes>;
 
@@ -118,3 +164,6 @@ export type InsertReport = InferInsertModel<typeof reports>;
 
 export type Measurement = InferSelectModel<typeof measurements>;
 export type InsertMeasurement = InferInsertModel<typeof measurements>;
+
+export type NetworkEvent = InferSelectModel<typeof networkEvents>;
+export type InsertNetworkEvent = InferInsertModel<typeof networkEvents>;
@@ -3,12 +3,14 @@ import { z } from 'zod';
 const MAX_AGE_MS = 7 * 24 * 60 * 60 * 1000; // 7 days
 const MAX_FUTURE_MS = 5 * 60 * 1000; // 5 minutes
 
+const timestampSchema = z.string().datetime().refine((ts) => {
+  const t = new Date(ts).getTime();
+  const now = Date.now();
+  return t >= now - MAX_AGE_MS && t <= now + MAX_FUTURE_MS;
+}, { message: 'Timestamp must be within last 7 days and not more than 5 minutes in the future' });
+
 export const rawMeasurementSchema = z.object({
-  timestamp: z.string().datetime().refine((ts) => {
-    const t = new Date(ts).getTime();
-    const now = Date.now();
-    return t >= now - MAX_AGE_MS && t <= now + MAX_FUTURE_MS;
-  }, { message: 'Timestamp must be within last 7 days and not more than 5 minutes in the future' }),
+  timestamp: timestampSchema,
   target: z.string().min(1).max(255),
   latency_avg: z.number().nonnegative().nullable(),
   latency_p95: z.number().nonnegative().nullable(),
@@ -16,11 +18,50 @@ export const rawMeasurementSchema = z.object({
   packet_loss: z.number().min(0).max(100).nullable(),
   dns_time: z.number().nonnegative().nullable(),
   bufferbloat: z.number().nullable(),
+  // HTTP phase timings in milliseconds; other probes leave them out.
+  resolve_time: z.number().nonnegative().nullish(),
+  connect_time: z.number().nonnegative().nullish(),
+  tls_time: z.number().nonnegative().nullish(),
+  ttfb: z.number().nonnegative().nullish(),
+  transfer_time: z.number().nonnegative().nullish(),
+  total_time: z.number().nonnegative().nullish(),
+  status_code: z.number().int().min(100).max(599).nullish(),
+  // Bufferbloat by load direction in milliseconds. Bloat can be negative
+  // when loaded pings happen to beat the idle ones.
+  latency_idle: z.number().nonnegative().nullish(),
+  latency_loaded_download: z.number().nonnegative().nullish(),
+  latency_loaded_upload: z.number().nonnegative().nullish(),
+  bufferbloat_download: z.number().nullish(),
+  bufferbloat_upload: z.number().nullish(),
+  // Throughput test results and the data they cost.
+  download_mbps: z.number().nonnegative().nullish(),
+  upload_mbps: z.number().nonnegative().nullish(),
+  bytes_transferred: z.number().int().nonnegative().nullish(),
+  // E-model call quality estimate for ping, UDP stream and TWAMP results.
+  r_factor: z.number().min(0).max(100).nullish(),
+  mos: z.number().min(1).max(4.5).nullish(),
+  voip_codec: z.string().max(16).nullish(),
+  // Captive portal probe findings; other probes leave them out.
+  captive_portal: z.boolean().nullish(),
+  content_injected: z.boolean().nullish(),
+  transparent_proxy: z.boolean().nullish(),
+  tls_intercepted: z.boolean().nullish(),
+});
+
+// A change in the probe's network situation, such as a new public IP or a
+// captive portal appearing.
+export const networkEventSchema = z.object({
+  timestamp: timestampSchema,
+  type: z.string().min(1).max(64),
+  previous: z.string().max(1024).optional(),
+  current: z.string().max(1024),
+  detail: z.string().max(4096).optional(),
 });
 
 export const ingestPayloadSchema = z.object({
   probe_id: z.string().uuid(),
   measurements: z.array(rawMeasurementSchema).min(1).max(1000),
+  events: z.array(networkEventSchema).max(1000).optional(),
 });
 
 export type IngestPayload = z.infer<typeof ingestPayloadSchema>;
@@ -14,11 +14,42 @@ export interface RawMeasurement {
   packet_loss: number | null;
   dns_time: number | null;
   bufferbloat: number | null;
+  resolve_time?: number | null;
+  connect_time?: number | null;
+  tls_time?: number | null;
+  ttfb?: number | null;
+  transfer_time?: number | null;
+  total_time?: number | null;
+  status_code?: number | null;
+  latency_idle?: number | null;
+  latency_loaded_download?: number | null;
+  latency_loaded_upload?: number | null;
+  bufferbloat_download?: number | null;
+  bufferbloat_upload?: number | null;
+  download_mbps?: number | null;
+  upload_mbps?: number | null;
+  bytes_transferred?: number | null;
+  r_factor?: number | null;
+  mos?: number | null;
+  voip_codec?: string | null;
+  captive_portal?: boolean | null;
+  content_injected?: boolean | null;
+  transparent_proxy?: boolean | null;
+  tls_intercepted?: boolean | null;
+}
+
+export interface NetworkEvent {
+  timestamp: string;
+  type: string;
+  previous?: string;
+  current: string;
+  detail?: string;
 }
 
 export interface ProbePayload {
   probe_id: string;
   measurements: RawMeasurement[];
+  events?: NetworkEvent[];
 }
 
 export interface AggregatedMeasurement {
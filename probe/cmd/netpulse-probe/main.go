@@ -32,6 +32,7 @@ func main() {
 	rootCmd.AddCommand(
 		initCmd(),
 		runCmd(&configPath),
+		reflectCmd(),
 		versionCmd(),
 	)
 
@@ -76,6 +77,22 @@ func runCmd(configPath *string) *cobra.Command {
 	return cmd
 }
 
+func reflectCmd() *cobra.Command {
+	var listenAddr, twampAddr string
+
+	cmd := &cobra.Command{
+		Use:   "reflect",
+		Short: "Run a UDP reflector for other probes' stream tests",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runReflector(listenAddr, twampAddr)
+		},
+	}
+
+	cmd.Flags().StringVar(&listenAddr, "listen", ":8620", "UDP address to reflect stream packets on")
+	cmd.Flags().StringVar(&twampAddr, "twamp", "", "UDP address to answer TWAMP-Light test packets on, e.g. :862 (disabled when empty)")
+	return cmd
+}
+
 func versionCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "version",
@@ -100,24 +117,173 @@ func (a *storeAdapter) GetUnsynced(limit int) ([]pushsync.StoredMeasurement, err
 	result := make([]pushsync.StoredMeasurement, len(rows))
 	for i, r := range rows {
 		result[i] = pushsync.StoredMeasurement{
-			ID:         r.ID,
-			Timestamp:  r.Timestamp.UTC().Format("2006-01-02T15:04:05Z07:00"),
-			Target:     r.Target,
-			LatencyAvg: r.LatencyAvg,
-			LatencyP95: r.LatencyP95,
-			Jitter:     r.Jitter,
-			PacketLoss: r.PacketLoss,
-			DNSTime:    r.DNSTime,
-			Bufferbloat: r.Bufferbloat,
+			ID:                    r.ID,
+			Timestamp:             r.Timestamp.UTC().Format("2006-01-02T15:04:05Z07:00"),
+			ProbeType:             string(r.ProbeType),
+			Target:                r.Target,
+			LatencyAvg:            r.LatencyAvg,
+			LatencyP95:            r.LatencyP95,
+			Jitter:                r.Jitter,
+			PacketLoss:            r.PacketLoss,
+			DNSTime:               r.DNSTime,
+			Bufferbloat:           r.Bufferbloat,
+			ResolveTime:           r.ResolveTime,
+			ConnectTime:           r.ConnectTime,
+			TLSTime:               r.TLSTime,
+			TTFB:                  r.TTFB,
+			TransferTime:          r.TransferTime,
+			TotalTime:             r.TotalTime,
+			StatusCode:            r.StatusCode,
+			HopCount:              r.HopCount,
+			Hops:                  convertHops(r.Hops),
+			LatencyIdle:           r.LatencyIdle,
+			LatencyLoadedDownload: r.LatencyLoadedDownload,
+			LatencyLoadedUpload:   r.LatencyLoadedUpload,
+			BufferbloatDownload:   r.BufferbloatDownload,
+			BufferbloatUpload:     r.BufferbloatUpload,
+			DownloadMbps:          r.DownloadMbps,
+			UploadMbps:            r.UploadMbps,
+			BytesTransferred:      r.BytesTransferred,
+			Protocol:              r.Protocol,
+			DNSRcode:              r.DNSRcode,
+			DNSAnswerCount:        r.DNSAnswerCount,
+			DNSMinTTL:             r.DNSMinTTL,
+			DNSAnswers:            r.DNSAnswers,
+			DNSMismatch:           r.DNSMismatch,
+			NXDomainRedirect:      r.NXDomainRedirect,
+			DNSIntercepted:        r.DNSIntercepted,
+			QueryName:             r.QueryName,
+			QueryType:             r.QueryType,
+			DNSTimeCold:           r.DNSTimeCold,
+			DNSSECAD:              r.DNSSECAD,
+			DNSSECValid:           r.DNSSECValid,
+			DNSLargeResponseOK:    r.DNSLargeResponseOK,
+			DNSTCPFallbackOK:      r.DNSTCPFallbackOK,
+			DNSTCPFallbackTime:    r.DNSTCPFallbackTime,
+			Scope:                 r.Scope,
+			PathMTU:               r.PathMTU,
+			PMTUBlackhole:         r.PMTUBlackhole,
+			IPFamily:              r.IPFamily,
+			HappyEyeballs:         r.HappyEyeballs,
+			Reordering:            r.Reordering,
+			Duplicates:            r.Duplicates,
+			JitterForward:         r.JitterForward,
+			JitterReverse:         r.JitterReverse,
+			ForwardDelay:          r.ForwardDelay,
+			ReverseDelay:          r.ReverseDelay,
+			ReflectorDelay:        r.ReflectorDelay,
+			RFactor:               r.RFactor,
+			MOS:                   r.MOS,
+			VoIPCodec:             r.VoIPCodec,
+			ClockOffset:           r.ClockOffset,
+			Stratum:               r.Stratum,
+			ClockUntrusted:        r.ClockUntrusted,
+			PublicIP:              r.PublicIP,
+			ASN:                   r.ASN,
+			ASOrg:                 r.ASOrg,
+			CGNAT:                 r.CGNAT,
+			CaptivePortal:         r.CaptivePortal,
+			ContentInjected:       r.ContentInjected,
+			TransparentProxy:      r.TransparentProxy,
+			TLSIntercepted:        r.TLSIntercepted,
+			TLSVersion:            r.TLSVersion,
+			TLSCipher:             r.TLSCipher,
+			ALPN:                  r.ALPN,
+			OCSPStapled:           r.OCSPStapled,
+			CertExpiryDays:        r.CertExpiryDays,
+			CertValid:             r.CertValid,
+			QUICHandshake:         r.QUICHandshake,
+			QUICResumeHandshake:   r.QUICResumeHandshake,
+			QUIC0RTT:              r.QUIC0RTT,
+			QUICVersion:           r.QUICVersion,
+			UDPBlocked:            r.UDPBlocked,
+			UnderLoad:             r.UnderLoad,
+			TraceReached:          r.TraceReached,
 		}
 	}
 	return result, nil
 }
 
+func convertHops(hops []probe.Hop) []pushsync.Hop {
+	if len(hops) == 0 {
+		return nil
+	}
+
+	result := make([]pushsync.Hop, len(hops))
+	for i, h := range hops {
+		result[i] = pushsync.Hop{
+			TTL:        h.TTL,
+			Address:    h.Address,
+			Sent:       h.Sent,
+			Received:   h.Received,
+			LatencyMin: h.LatencyMin,
+			LatencyAvg: h.LatencyAvg,
+			LatencyMax: h.LatencyMax,
+			LatencyP95: h.LatencyP95,
+			Jitter:     h.Jitter,
+			PacketLoss: h.PacketLoss,
+		}
+	}
+	return result
+}
+
 func (a *storeAdapter) MarkSynced(ids []int64) error {
 	return a.store.MarkSynced(ids)
 }
 
+func (a *storeAdapter) MarkRejected(ids []int64) error {
+	return a.store.MarkRejected(ids)
+}
+
+func (a *storeAdapter) GetUnsyncedEvents(limit int) ([]pushsync.StoredEvent, error) {
+	rows, err := a.store.GetUnsyncedEvents(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]pushsync.StoredEvent, len(rows))
+	for i, r := range rows {
+		result[i] = pushsync.StoredEvent{
+			ID:        r.ID,
+			Timestamp: r.Timestamp.UTC().Format("2006-01-02T15:04:05Z07:00"),
+			Type:      string(r.Type),
+			Previous:  r.Previous,
+			Current:   r.Current,
+			Detail:    r.Detail,
+		}
+	}
+	return result, nil
+}
+
+func (a *storeAdapter) MarkEventsSynced(ids []int64) error {
+	return a.store.MarkEventsSynced(ids)
+}
+
+func (a *storeAdapter) MarkEventsRejected(ids []int64) error {
+	return a.store.MarkEventsRejected(ids)
+}
+
+// usageAdapter bridges storage.Store to probe.UsageStore, logging errors
+// since a budget keeps counting in memory when the database fails.
+type usageAdapter struct {
+	store  *storage.Store
+	logger *slog.Logger
+}
+
+func (a *usageAdapter) LoadUsage(name, from, to string) int64 {
+	n, err := a.store.DataUsage(name, from, to)
+	if err != nil {
+		a.logger.Error("failed to load data usage", "budget", name, "error", err)
+	}
+	return n
+}
+
+func (a *usageAdapter) AddUsage(name, day string, n int64) {
+	if err := a.store.AddDataUsage(name, day, n); err != nil {
+		a.logger.Error("failed to save data usage", "budget", name, "error", err)
+	}
+}
+
 func runProbe(configPath, healthAddr string) error {
 	// Set up structured logging.
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
@@ -135,6 +301,9 @@ func runProbe(configPath, healthAddr string) error {
 		"probe_name", cfg.Probe.Name,
 		"ping_targets", cfg.Targets.Ping,
 		"dns_resolvers", cfg.Targets.DNS,
+		"http_targets", cfg.Targets.HTTP,
+		"tcp_targets", cfg.Targets.TCP,
+		"tls_targets", cfg.Targets.TLS,
 	)
 
 	// Open local SQLite storage.
@@ -150,7 +319,25 @@ func runProbe(configPath, healthAddr string) error {
 	healthServer := health.NewServer(logger)
 
 	// Create measurement handler that saves to SQLite and updates health.
+	codec := probe.Codec(cfg.VoIP.Codec)
+	clockTrust := probe.NewClockTrust(cfg.NTP.MaxOffset)
 	handler := func(measurements []probe.Measurement) {
+		if clockTrust.Observe(measurements) {
+			offset, untrusted := clockTrust.Offset()
+			if untrusted {
+				logger.Warn("system clock is off, correcting measurement timestamps by the NTP offset",
+					"offset_ms", *offset, "max_offset", cfg.NTP.MaxOffset)
+			} else {
+				logger.Info("system clock is within tolerance", "offset_ms", *offset)
+			}
+		}
+
+		for i := range measurements {
+			probe.AnnotateCallQuality(&measurements[i], codec)
+			clockTrust.Annotate(&measurements[i])
+		}
+		healthServer.RecordClock(clockTrust.Offset())
+
 		if err := store.SaveMeasurements(measurements); err != nil {
 			logger.Error("failed to save measurements", "error", err)
 			return
@@ -158,26 +345,241 @@ func runProbe(configPath, healthAddr string) error {
 
 		for _, m := range measurements {
 			healthServer.RecordMeasurement(string(m.ProbeType))
+			if m.ProbeType == probe.ProbeTypePMTU {
+				warnPMTU(logger, m)
+			}
 		}
 
 		logger.Debug("measurements saved", "count", len(measurements))
 	}
 
+	// Create event handler that saves network events to SQLite.
+	eventHandler := func(events []probe.Event) {
+		for _, e := range events {
+			logger.Info("network event", "type", e.Type, "previous", e.Previous, "current", e.Current, "detail", e.Detail)
+			if probe.IsFinding(e.Type) {
+				healthServer.RecordFinding(string(e.Type), e.Current == "true", e.Detail)
+			}
+		}
+		if err := store.SaveEvents(events); err != nil {
+			logger.Error("failed to save events", "error", err)
+		}
+	}
+
+	// Resume stateful probes and health findings from the last events.
+	lastEvents, err := store.LatestEvents()
+	if err != nil {
+		logger.Warn("failed to load previous network events", "error", err)
+	}
+	for _, e := range lastEvents {
+		if probe.IsFinding(e.Type) {
+			healthServer.RecordFinding(string(e.Type), e.Current == "true", e.Detail)
+		}
+	}
+
+	// Load-generating probes share one data budget, persisted so that a
+	// restart does not reset it.
+	usage := &usageAdapter{store: store, logger: logger}
+	dataBudget := probe.NewDataBudget(probe.DataBudgetOptions{
+		Name:         "data",
+		DailyLimit:   int64(cfg.DataBudget.DailyMB) << 20,
+		MonthlyLimit: int64(cfg.DataBudget.MonthlyMB) << 20,
+		Store:        usage,
+	})
+
+	timetables, err := cfg.Schedule.Timetables()
+	if err != nil {
+		return err
+	}
+
 	// Create scheduler and register probes.
-	scheduler := probe.NewScheduler(handler, logger)
+	var escalation *probe.EscalationPolicy
+	if a := cfg.Schedule.Adaptive; a.Enabled {
+		escalation = &probe.EscalationPolicy{
+			Trigger:          probe.ProbeTypePing,
+			LossThreshold:    a.LossThreshold,
+			LatencyThreshold: float64(a.LatencyThreshold) / float64(time.Millisecond),
+			EscalateAfter:    a.EscalateAfter,
+			RecoverAfter:     a.RecoverAfter,
+			Intervals:        make(map[probe.ProbeType]time.Duration, len(a.Intervals)),
+		}
+		for probeType, interval := range a.Intervals {
+			escalation.Intervals[probe.ProbeType(probeType)] = interval
+		}
+	}
+	scheduler := probe.NewScheduler(handler, probe.SchedulerOptions{
+		Timeout:     cfg.Schedule.ProbeTimeout,
+		StartJitter: cfg.Schedule.StartJitter,
+		Jitter:      cfg.Schedule.Jitter,
+		Overrun:     probe.OverrunPolicy(cfg.Schedule.Overrun),
+		Exclusion: probe.ExclusionGroups{
+			Load:    probeTypes(cfg.Schedule.Exclusion.Load),
+			Passive: probeTypes(cfg.Schedule.Exclusion.Passive),
+			Policy:  probe.UnderLoadPolicy(cfg.Schedule.Exclusion.Policy),
+		},
+		Escalation: escalation,
+		Timetables: timetables,
+	}, logger)
+	healthServer.SetScheduleSource(func() map[string]health.ScheduleStats {
+		stats := make(map[string]health.ScheduleStats)
+		for probeType, st := range scheduler.Stats() {
+			stats[string(probeType)] = health.ScheduleStats{
+				Runs:     st.Runs,
+				Overruns: st.Overruns,
+				Skipped:  st.Skipped,
+				TimedOut: st.TimedOut,
+			}
+		}
+		return stats
+	})
 
 	// Ping probe.
-	pingProbe := probe.NewPingProbe(cfg.Targets.Ping, 10)
+	pingProbe := probe.NewPingProbe(cfg.Targets.Ping, 10, cfg.Targets.DualStack)
 	scheduler.Add(pingProbe, cfg.Schedule.PingInterval)
 
 	// DNS probe.
-	dnsProbe := probe.NewDNSProbe(cfg.Targets.DNS, "example.com")
+	dnsQueries := make([]probe.DNSQuery, len(cfg.DNS.Queries))
+	for i, q := range cfg.DNS.Queries {
+		dnsQueries[i] = probe.DNSQuery{Name: q.Name, Type: q.Type, Expected: q.Expected}
+	}
+	dnsProbe := probe.NewDNSProbe(cfg.Targets.DNS, probe.DNSOptions{
+		Queries:            dnsQueries,
+		CacheBust:          cfg.DNS.CacheBust,
+		NXDomainCheck:      cfg.DNS.NXDomainCheck,
+		InterceptionCanary: cfg.DNS.InterceptionCanary,
+		DNSSECZones:        cfg.DNS.DNSSECZones,
+		LargeResponseName:  cfg.DNS.LargeResponseName,
+		DualStack:          cfg.Targets.DualStack,
+	})
 	scheduler.Add(dnsProbe, cfg.Schedule.DNSInterval)
 
 	// Bufferbloat probe.
-	bbProbe := probe.NewBufferbloatProbe(cfg.Targets.Ping[0], cfg.Targets.BufferbloatDownloadURL)
+	bbProbe := probe.NewBufferbloatProbe(
+		cfg.Targets.Ping[0],
+		cfg.Targets.BufferbloatDownloadURL,
+		cfg.Targets.BufferbloatUploadURL,
+		dataBudget,
+		int64(cfg.DataBudget.BufferbloatRunMB)<<20,
+	)
 	scheduler.Add(bbProbe, cfg.Schedule.BufferbloatInterval)
 
+	// HTTP phase-timing probe.
+	if len(cfg.Targets.HTTP) > 0 {
+		httpProbe := probe.NewHTTPProbe(cfg.Targets.HTTP)
+		scheduler.Add(httpProbe, cfg.Schedule.HTTPInterval)
+	}
+
+	// TCP connect-latency probe.
+	if len(cfg.Targets.TCP) > 0 {
+		tcpProbe := probe.NewTCPProbe(cfg.Targets.TCP, 5)
+		scheduler.Add(tcpProbe, cfg.Schedule.TCPInterval)
+	}
+
+	// TLS handshake and certificate probe.
+	if len(cfg.Targets.TLS) > 0 {
+		tlsProbe := probe.NewTLSProbe(cfg.Targets.TLS)
+		scheduler.Add(tlsProbe, cfg.Schedule.TLSInterval)
+	}
+
+	// QUIC versus TCP+TLS handshake probe.
+	if len(cfg.Targets.QUIC) > 0 {
+		quicProbe := probe.NewQUICProbe(cfg.Targets.QUIC)
+		scheduler.Add(quicProbe, cfg.Schedule.QUICInterval)
+	}
+
+	// Gateway probe, separating LAN trouble from ISP trouble.
+	if cfg.Targets.Gateway != "" {
+		gwProbe := probe.NewGatewayProbe(cfg.Targets.Gateway, 10)
+		scheduler.Add(gwProbe, cfg.Schedule.GatewayInterval)
+	}
+
+	// Traceroute probe, mapping the path to each ping target.
+	if cfg.Traceroute.Enabled {
+		trProbe := probe.NewTracerouteProbe(
+			cfg.Targets.Ping,
+			cfg.Traceroute.MaxHops,
+			cfg.Traceroute.HopTimeout,
+			cfg.Traceroute.Rounds,
+		)
+		scheduler.Add(trProbe, cfg.Schedule.TracerouteInterval)
+	}
+
+	// Path MTU probe against the ping targets.
+	if cfg.PMTU.Enabled {
+		pmtuProbe := probe.NewPMTUProbe(cfg.Targets.Ping, cfg.PMTU.MaxSize, cfg.PMTU.Timeout)
+		scheduler.Add(pmtuProbe, cfg.Schedule.PMTUInterval)
+	}
+
+	// UDP stream probe, against reflectors run with "netpulse-probe reflect".
+	if len(cfg.Targets.UDPStream) > 0 {
+		usProbe := probe.NewUDPStreamProbe(
+			cfg.Targets.UDPStream,
+			cfg.UDPStream.Rate,
+			cfg.UDPStream.Duration,
+			cfg.UDPStream.PacketSize,
+		)
+		scheduler.Add(usProbe, cfg.Schedule.UDPStreamInterval)
+	}
+
+	if cfg.PublicIP.Enabled {
+		publicIPProbe := probe.NewPublicIPProbe(probe.PublicIPOptions{
+			EchoURL:     cfg.PublicIP.EchoURL,
+			STUNServer:  cfg.PublicIP.STUNServer,
+			ASNDatabase: cfg.PublicIP.ASNDatabase,
+		}, eventHandler)
+		publicIPProbe.Restore(lastEvents)
+		scheduler.Add(publicIPProbe, cfg.Schedule.PublicIPInterval)
+	}
+
+	if cfg.Portal.Enabled {
+		checks := make([]probe.PortalCheck, len(cfg.Portal.Checks))
+		for i, c := range cfg.Portal.Checks {
+			checks[i] = probe.PortalCheck{URL: c.URL, Status: c.Status, Body: c.Body}
+		}
+		pins := make([]probe.TLSPin, len(cfg.Portal.TLS))
+		for i, t := range cfg.Portal.TLS {
+			pins[i] = probe.TLSPin{Host: t.Host, Fingerprints: t.Fingerprints}
+		}
+		portalProbe := probe.NewPortalProbe(checks, pins, cfg.Portal.Timeout, eventHandler)
+		portalProbe.Restore(lastEvents)
+		scheduler.Add(portalProbe, cfg.Schedule.PortalInterval)
+	}
+
+	if len(cfg.Targets.NTP) > 0 {
+		ntpProbe := probe.NewNTPProbe(cfg.Targets.NTP, cfg.NTP.Timeout)
+		scheduler.Add(ntpProbe, cfg.Schedule.NTPInterval)
+	}
+
+	if len(cfg.Targets.TWAMP) > 0 {
+		twampProbe := probe.NewTWAMPProbe(
+			cfg.Targets.TWAMP,
+			cfg.TWAMP.Rate,
+			cfg.TWAMP.Duration,
+			cfg.TWAMP.PacketSize,
+		)
+		scheduler.Add(twampProbe, cfg.Schedule.TWAMPInterval)
+	}
+
+	// Throughput probe, off by default since it transfers real data.
+	if cfg.Throughput.Enabled {
+		budget := probe.NewDataBudget(probe.DataBudgetOptions{
+			Name:       "throughput",
+			DailyLimit: int64(cfg.Throughput.DailyBudgetMB) << 20,
+			Store:      usage,
+			Parent:     dataBudget,
+		})
+		tpProbe := probe.NewThroughputProbe(
+			cfg.Throughput.DownloadURL,
+			cfg.Throughput.UploadURL,
+			cfg.Throughput.Streams,
+			cfg.Throughput.Duration,
+			cfg.Throughput.Warmup,
+			budget,
+			int64(cfg.Throughput.RunMB)<<20,
+		)
+		scheduler.Add(tpProbe, cfg.Schedule.ThroughputInterval)
+	}
+
 	// Create context that cancels on SIGINT/SIGTERM.
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -241,3 +643,65 @@ func runProbe(configPath, healthAddr string) error {
 
 	return nil
 }
+
+func runReflector(listenAddr, twampAddr string) error {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+
+	reflector, err := probe.ListenUDPReflector(listenAddr)
+	if err != nil {
+		return fmt.Errorf("starting reflector: %w", err)
+	}
+
+	// Create context that cancels on SIGINT/SIGTERM.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-sigChan
+		logger.Info("received signal, shutting down", "signal", sig)
+		cancel()
+	}()
+
+	if twampAddr != "" {
+		twamp, err := probe.ListenTWAMPReflector(twampAddr)
+		if err != nil {
+			return fmt.Errorf("starting TWAMP reflector: %w", err)
+		}
+		logger.Info("TWAMP reflector listening", "addr", twamp.Addr())
+		go func() {
+			if err := twamp.Serve(ctx); err != nil {
+				logger.Error("TWAMP reflector stopped", "error", err)
+				cancel()
+			}
+		}()
+	}
+
+	logger.Info("reflector listening", "addr", reflector.Addr())
+	return reflector.Serve(ctx)
+}
+
+// warnPMTU logs path MTU results that commonly explain hung TLS
+// connections: an MTU below Ethernet's 1500 or a PMTU black hole.
+func warnPMTU(logger *slog.Logger, m probe.Measurement) {
+	if m.PMTUBlackhole != nil && *m.PMTUBlackhole {
+		logger.Warn("PMTU black hole: large packets dropped without ICMP feedback",
+			"target", m.Target, "path_mtu", *m.PathMTU)
+		return
+	}
+	if m.PathMTU != nil && *m.PathMTU < 1500 {
+		logger.Warn("path MTU below 1500", "target", m.Target, "path_mtu", *m.PathMTU)
+	}
+}
+
+func probeTypes(names []string) []probe.ProbeType {
+	types := make([]probe.ProbeType, len(names))
+	for i, name := range names {
+		types[i] = probe.ProbeType(name)
+	}
+	return types
+}
@@ -2,20 +2,36 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"time"
 
+	"github.com/netpulse/probe/internal/probe"
 	"gopkg.in/yaml.v3"
 )
 
 // Config holds the probe agent configuration.
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Schedule ScheduleConfig `yaml:"schedule"`
-	Targets  TargetsConfig  `yaml:"targets"`
-	Probe    ProbeConfig    `yaml:"probe"`
-	Storage  StorageConfig  `yaml:"storage"`
+	Server     ServerConfig     `yaml:"server"`
+	Schedule   ScheduleConfig   `yaml:"schedule"`
+	Targets    TargetsConfig    `yaml:"targets"`
+	Probe      ProbeConfig      `yaml:"probe"`
+	Storage    StorageConfig    `yaml:"storage"`
+	Traceroute TracerouteConfig `yaml:"traceroute"`
+	PMTU       PMTUConfig       `yaml:"pmtu"`
+	UDPStream  UDPStreamConfig  `yaml:"udp_stream"`
+	TWAMP      TWAMPConfig      `yaml:"twamp"`
+	VoIP       VoIPConfig       `yaml:"voip"`
+	NTP        NTPConfig        `yaml:"ntp"`
+	PublicIP   PublicIPConfig   `yaml:"public_ip"`
+	Portal     PortalConfig     `yaml:"portal"`
+	Throughput ThroughputConfig `yaml:"throughput"`
+	DataBudget DataBudgetConfig `yaml:"data_budget"`
+	DNS        DNSConfig        `yaml:"dns"`
 }
 
 type ServerConfig struct {
@@ -25,15 +41,87 @@ type ServerConfig struct {
 }
 
 type ScheduleConfig struct {
-	PingInterval       time.Duration `yaml:"ping_interval"`
-	DNSInterval        time.Duration `yaml:"dns_interval"`
+	PingInterval        time.Duration `yaml:"ping_interval"`
+	DNSInterval         time.Duration `yaml:"dns_interval"`
 	BufferbloatInterval time.Duration `yaml:"bufferbloat_interval"`
+	HTTPInterval        time.Duration `yaml:"http_interval"`
+	TCPInterval         time.Duration `yaml:"tcp_interval"`
+	TracerouteInterval  time.Duration `yaml:"traceroute_interval"`
+	ThroughputInterval  time.Duration `yaml:"throughput_interval"`
+	GatewayInterval     time.Duration `yaml:"gateway_interval"`
+	PMTUInterval        time.Duration `yaml:"pmtu_interval"`
+	UDPStreamInterval   time.Duration `yaml:"udp_stream_interval"`
+	TWAMPInterval       time.Duration `yaml:"twamp_interval"`
+	NTPInterval         time.Duration `yaml:"ntp_interval"`
+	PublicIPInterval    time.Duration `yaml:"public_ip_interval"`
+	PortalInterval      time.Duration `yaml:"portal_interval"`
+	TLSInterval         time.Duration `yaml:"tls_interval"`
+	QUICInterval        time.Duration `yaml:"quic_interval"`
+	ProbeTimeout        time.Duration `yaml:"probe_timeout"`
+	StartJitter         time.Duration `yaml:"start_jitter"`
+	Jitter              time.Duration `yaml:"jitter"`
+	Overrun             string        `yaml:"overrun"`
+
+	Exclusion ExclusionConfig `yaml:"exclusion"`
+	Adaptive  AdaptiveConfig  `yaml:"adaptive"`
+
+	// Windows restricts when individual probes run, keyed by probe type.
+	Windows map[string]WindowConfig `yaml:"windows"`
+	// QuietHours are windows in which no load-generating probe runs.
+	QuietHours []string `yaml:"quiet_hours"`
+}
+
+// WindowConfig restricts when one probe runs, in local time. Cron is a
+// five-field cron expression that replaces the probe's interval. Only and
+// Except are windows such as "02:00-05:00" or "Mon-Fri 09:00-17:00".
+type WindowConfig struct {
+	Cron   string   `yaml:"cron"`
+	Only   []string `yaml:"only"`
+	Except []string `yaml:"except"`
+}
+
+// ExclusionConfig keeps load-generating probes from distorting the latency
+// measured by passive ones. Policy "wait" holds passive probes while a
+// load probe runs; "tag" lets them run and marks their results under_load.
+type ExclusionConfig struct {
+	Load    []string `yaml:"load"`
+	Passive []string `yaml:"passive"`
+	Policy  string   `yaml:"policy"`
+}
+
+// AdaptiveConfig shortens probe intervals while ping results cross a loss
+// or latency threshold, so short outages are sampled densely. Intervals
+// maps probe types to the interval they use while escalated. It is off by
+// default, since escalating adds traffic just when the link is struggling.
+type AdaptiveConfig struct {
+	Enabled          bool                     `yaml:"enabled"`
+	LossThreshold    float64                  `yaml:"loss_threshold"`
+	LatencyThreshold time.Duration            `yaml:"latency_threshold"`
+	EscalateAfter    int                      `yaml:"escalate_after"`
+	RecoverAfter     int                      `yaml:"recover_after"`
+	Intervals        map[string]time.Duration `yaml:"intervals"`
 }
 
 type TargetsConfig struct {
-	Ping                []string `yaml:"ping"`
-	DNS                 []string `yaml:"dns"`
+	Ping []string `yaml:"ping"`
+	DNS  []string `yaml:"dns"`
+	// BufferbloatDownloadURL is fetched once per bufferbloat run; the
+	// default 5 MB file costs about 1.4 GB a day at the default 5m
+	// interval.
 	BufferbloatDownloadURL string `yaml:"bufferbloat_download_url"`
+	// BufferbloatUploadURL, when set, adds an upload-saturation phase that
+	// sends at line rate for the ~10s of loaded pings, up to 50 MB per run
+	// (about 14 GB a day at the default interval), so it is opt-in.
+	BufferbloatUploadURL string   `yaml:"bufferbloat_upload_url"`
+	HTTP                 []string `yaml:"http"`
+	TCP                  []string `yaml:"tcp"`
+	Gateway              string   `yaml:"gateway"`
+	DualStack            bool     `yaml:"dual_stack"`
+	UDPStream            []string `yaml:"udp_stream"`
+	TWAMP                []string `yaml:"twamp"`
+	NTP                  []string `yaml:"ntp"`
+	TLS                  []string `yaml:"tls"`
+	QUIC                 []string `yaml:"quic"`
 }
 
 type ProbeConfig struct {
@@ -41,6 +129,175 @@ type ProbeConfig struct {
 	Location string `yaml:"location"`
 }
 
+// TracerouteConfig controls the MTR-style path probe run against ping
+// targets. It is opt-in, since every run opens raw or ping ICMP sockets.
+type TracerouteConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	MaxHops    int           `yaml:"max_hops"`
+	HopTimeout time.Duration `yaml:"hop_timeout"`
+	Rounds     int           `yaml:"rounds"`
+}
+
+// PMTUConfig controls path MTU discovery against ping targets.
+type PMTUConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxSize is the largest packet tried, normally the LAN MTU.
+	MaxSize int           `yaml:"max_size"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// UDPStreamConfig shapes the constant-bitrate stream sent to the
+// reflectors listed under targets.udp_stream. The defaults mimic a G.711
+// call: 50 packets per second of 172 bytes.
+type UDPStreamConfig struct {
+	Rate       int           `yaml:"rate"`
+	Duration   time.Duration `yaml:"duration"`
+	PacketSize int           `yaml:"packet_size"`
+}
+
+// TWAMPConfig shapes the TWAMP-Light test sessions sent to the reflectors
+// listed under targets.twamp. PacketSize defaults to the 41-byte reply
+// size so that test packets are the same size in both directions.
+type TWAMPConfig struct {
+	Rate       int           `yaml:"rate"`
+	Duration   time.Duration `yaml:"duration"`
+	PacketSize int           `yaml:"packet_size"`
+}
+
+// VoIPConfig selects the codec assumed when estimating call quality (MOS)
+// from ping, UDP stream and TWAMP results: "g711" or "opus".
+type VoIPConfig struct {
+	Codec string `yaml:"codec"`
+}
+
+// NTPConfig controls the clock check against the servers listed under
+// targets.ntp. Measurements are flagged clock_untrusted while the offset
+// exceeds MaxOffset.
+type NTPConfig struct {
+	MaxOffset time.Duration `yaml:"max_offset"`
+	Timeout   time.Duration `yaml:"timeout"`
+}
+
+// PublicIPConfig controls public IP, ASN and CGNAT tracking. The egress
+// address comes from STUNServer when set, otherwise from EchoURL.
+// ASNDatabase is an optional MaxMind-format ASN database file.
+type PublicIPConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	EchoURL     string `yaml:"echo_url"`
+	STUNServer  string `yaml:"stun_server"`
+	ASNDatabase string `yaml:"asn_database"`
+}
+
+// PortalConfig controls captive portal, transparent proxy and TLS
+// interception detection.
+type PortalConfig struct {
+	Enabled bool                `yaml:"enabled"`
+	Checks  []PortalCheckConfig `yaml:"checks"`
+	TLS     []TLSPinConfig      `yaml:"tls"`
+	Timeout time.Duration       `yaml:"timeout"`
+}
+
+// PortalCheckConfig is a plain-HTTP URL with a known response. An empty
+// Body means the response must be empty; otherwise it must contain Body.
+type PortalCheckConfig struct {
+	URL    string `yaml:"url"`
+	Status int    `yaml:"status"`
+	Body   string `yaml:"body,omitempty"`
+}
+
+// TLSPinConfig is a host:port whose certificate chain must verify against
+// the system roots and, when Fingerprints (base64 SHA-256 of a
+// certificate's SubjectPublicKeyInfo) are listed, include one of them.
+type TLSPinConfig struct {
+	Host         string   `yaml:"host"`
+	Fingerprints []string `yaml:"fingerprints,omitempty"`
+}
+
+// ThroughputConfig controls the parallel-stream speed test. DailyBudgetMB
+// caps the data it may use per day, within data_budget; zero means
+// unlimited. A run only starts with RunMB of budget left, and stops once
+// it has used whatever was left.
+type ThroughputConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	DownloadURL   string        `yaml:"download_url"`
+	UploadURL     string        `yaml:"upload_url"`
+	Streams       int           `yaml:"streams"`
+	Duration      time.Duration `yaml:"duration"`
+	Warmup        time.Duration `yaml:"warmup"`
+	DailyBudgetMB int           `yaml:"daily_budget_mb"`
+	RunMB         int           `yaml:"run_mb"`
+}
+
+// DataBudgetConfig caps the data the load-generating probes, bufferbloat
+// and throughput, may use between them per local day and calendar month;
+// zero means unlimited. Usage is kept in the local database so restarts do
+// not reset it, which matters on metered backup links. A bufferbloat run
+// only starts with BufferbloatRunMB of budget left, and stops once it has
+// used whatever was left.
+type DataBudgetConfig struct {
+	DailyMB          int `yaml:"daily_mb"`
+	MonthlyMB        int `yaml:"monthly_mb"`
+	BufferbloatRunMB int `yaml:"bufferbloat_run_mb"`
+}
+
+// DNSConfig controls what the DNS probe asks and how it validates the
+// answers from the resolvers listed under targets.dns.
+type DNSConfig struct {
+	// Queries are asked of every resolver; each pair yields a measurement.
+	Queries []DNSQueryConfig `yaml:"queries"`
+	// CacheBust also times a random label under each query name, which no
+	// resolver can have cached, to measure the authoritative lookup for
+	// the name.
+	CacheBust bool `yaml:"cache_bust"`
+	// NXDomainCheck detects resolvers that answer for non-existent names.
+	NXDomainCheck bool `yaml:"nxdomain_check"`
+	// InterceptionCanary is an address with no DNS server behind it; an
+	// answer from it reveals transparent DNS interception. Empty disables.
+	InterceptionCanary string `yaml:"interception_canary"`
+	// DNSSECZones are signed zones used to check that resolvers validate
+	// DNSSEC and that signatures survive the path. Empty disables.
+	DNSSECZones []string `yaml:"dnssec_zones"`
+	// LargeResponseName is a name whose TXT answer exceeds 512 bytes, used
+	// to test EDNS0 large responses and TCP fallback. Empty disables.
+	LargeResponseName string `yaml:"large_response_name"`
+}
+
+// DNSQueryConfig is a single name and record type to resolve.
+type DNSQueryConfig struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+	// Expected, when set, lists the only addresses Name may resolve to.
+	Expected []string `yaml:"expected,omitempty"`
+}
+
+// dnsQueryTypes are the record types the DNS probe may ask for.
+var dnsQueryTypes = map[string]bool{
+	"A":     true,
+	"AAAA":  true,
+	"HTTPS": true,
+	"MX":    true,
+}
+
+// probeTypes are the names schedule settings may refer to probes by.
+var probeTypes = map[probe.ProbeType]bool{
+	probe.ProbeTypePing:        true,
+	probe.ProbeTypeDNS:         true,
+	probe.ProbeTypeBufferbloat: true,
+	probe.ProbeTypeHTTP:        true,
+	probe.ProbeTypeTCP:         true,
+	probe.ProbeTypeTraceroute:  true,
+	probe.ProbeTypeThroughput:  true,
+	probe.ProbeTypeGateway:     true,
+	probe.ProbeTypePMTU:        true,
+	probe.ProbeTypeUDPStream:   true,
+	probe.ProbeTypeTWAMP:       true,
+	probe.ProbeTypeNTP:         true,
+	probe.ProbeTypePublicIP:    true,
+	probe.ProbeTypePortal:      true,
+	probe.ProbeTypeTLS:         true,
+	probe.ProbeTypeQUIC:        true,
+}
+
 type StorageConfig struct {
 	LocalRetentionDays int    `yaml:"local_retention_days"`
 	DBPath             string `yaml:"db_path"`
@@ -49,6 +306,13 @@ type StorageConfig struct {
 // DefaultConfig returns a configuration with sensible defaults.
 func DefaultConfig() *Config {
 	homeDir, _ := os.UserHomeDir()
+	// The gateway is discovered from /proc/net/route and PMTU probes need
+	// IP_MTU_DISCOVER, both of which only Linux has.
+	linux := runtime.GOOS == "linux"
+	gateway := ""
+	if linux {
+		gateway = "auto"
+	}
 	return &Config{
 		Server: ServerConfig{
 			URL:    "http://localhost:3000",
@@ -58,11 +322,46 @@ func DefaultConfig() *Config {
 			PingInterval:        30 * time.Second,
 			DNSInterval:         60 * time.Second,
 			BufferbloatInterval: 5 * time.Minute,
+			HTTPInterval:        60 * time.Second,
+			TCPInterval:         30 * time.Second,
+			TracerouteInterval:  10 * time.Minute,
+			ThroughputInterval:  6 * time.Hour,
+			GatewayInterval:     30 * time.Second,
+			PMTUInterval:        15 * time.Minute,
+			UDPStreamInterval:   5 * time.Minute,
+			TWAMPInterval:       5 * time.Minute,
+			NTPInterval:         5 * time.Minute,
+			PublicIPInterval:    5 * time.Minute,
+			PortalInterval:      5 * time.Minute,
+			TLSInterval:         5 * time.Minute,
+			QUICInterval:        5 * time.Minute,
+			ProbeTimeout:        2 * time.Minute,
+			StartJitter:         10 * time.Second,
+			Jitter:              time.Second,
+			Overrun:             "skip",
+			Exclusion: ExclusionConfig{
+				Load:    []string{"bufferbloat", "throughput"},
+				Passive: []string{"ping", "dns", "gateway", "tcp", "http", "udp_stream", "twamp"},
+				Policy:  "wait",
+			},
+			Adaptive: AdaptiveConfig{
+				Enabled:          false,
+				LossThreshold:    5,
+				LatencyThreshold: 250 * time.Millisecond,
+				EscalateAfter:    1,
+				RecoverAfter:     3,
+				Intervals: map[string]time.Duration{
+					"ping":       15 * time.Second,
+					"gateway":    10 * time.Second,
+					"traceroute": 2 * time.Minute,
+				},
+			},
 		},
 		Targets: TargetsConfig{
-			Ping: []string{"1.1.1.1", "8.8.8.8", "9.9.9.9"},
-			DNS:  []string{"1.1.1.1", "8.8.8.8", "system"},
+			Ping:                   []string{"1.1.1.1", "8.8.8.8", "9.9.9.9"},
+			DNS:                    []string{"1.1.1.1", "8.8.8.8", "system"},
 			BufferbloatDownloadURL: "https://speed.cloudflare.com/__down?bytes=5000000",
+			Gateway:                gateway,
 		},
 		Probe: ProbeConfig{
 			Name:     "default",
@@ -72,6 +371,71 @@ func DefaultConfig() *Config {
 			LocalRetentionDays: 30,
 			DBPath:             filepath.Join(homeDir, ".netpulse", "measurements.db"),
 		},
+		Traceroute: TracerouteConfig{
+			Enabled:    false,
+			MaxHops:    30,
+			HopTimeout: time.Second,
+			Rounds:     5,
+		},
+		PMTU: PMTUConfig{
+			Enabled: linux,
+			MaxSize: 1500,
+			Timeout: time.Second,
+		},
+		UDPStream: UDPStreamConfig{
+			Rate:       50,
+			Duration:   10 * time.Second,
+			PacketSize: 172,
+		},
+		TWAMP: TWAMPConfig{
+			Rate:       10,
+			Duration:   10 * time.Second,
+			PacketSize: 41,
+		},
+		VoIP: VoIPConfig{
+			Codec: "g711",
+		},
+		NTP: NTPConfig{
+			MaxOffset: time.Second,
+			Timeout:   5 * time.Second,
+		},
+		PublicIP: PublicIPConfig{
+			Enabled: false,
+			EchoURL: "https://www.cloudflare.com/cdn-cgi/trace",
+		},
+		Portal: PortalConfig{
+			Enabled: false,
+			Checks: []PortalCheckConfig{
+				{URL: "http://connectivitycheck.gstatic.com/generate_204", Status: 204},
+			},
+			TLS: []TLSPinConfig{
+				{Host: "www.google.com:443"},
+			},
+			Timeout: 10 * time.Second,
+		},
+		Throughput: ThroughputConfig{
+			Enabled:       false,
+			DownloadURL:   "https://speed.cloudflare.com/__down?bytes=25000000",
+			UploadURL:     "https://speed.cloudflare.com/__up",
+			Streams:       4,
+			Duration:      10 * time.Second,
+			Warmup:        2 * time.Second,
+			DailyBudgetMB: 1024,
+			// Four streams for 10s each way at 100 Mbps.
+			RunMB: 250,
+		},
+		DataBudget: DataBudgetConfig{
+			// The 5 MB download plus the 50 MB upload cap.
+			BufferbloatRunMB: 60,
+		},
+		DNS: DNSConfig{
+			Queries: []DNSQueryConfig{
+				{Name: "example.com", Type: "A"},
+			},
+			CacheBust:          true,
+			NXDomainCheck:      true,
+			InterceptionCanary: "192.0.2.53",
+		},
 	}
 }
 
@@ -108,21 +472,368 @@ func (c *Config) Validate() error {
 	if len(c.Targets.DNS) == 0 {
 		return fmt.Errorf("at least one DNS target is required")
 	}
+	for _, resolver := range c.Targets.DNS {
+		if err := validateResolver(resolver); err != nil {
+			return err
+		}
+	}
+	if len(c.DNS.Queries) == 0 {
+		return fmt.Errorf("at least one DNS query is required")
+	}
+	for _, zone := range c.DNS.DNSSECZones {
+		if zone == "" {
+			return fmt.Errorf("DNSSEC zone name must not be empty")
+		}
+	}
+	for _, q := range c.DNS.Queries {
+		if q.Name == "" {
+			return fmt.Errorf("DNS query name is required")
+		}
+		if !dnsQueryTypes[strings.ToUpper(q.Type)] {
+			return fmt.Errorf("DNS query %q has unsupported type %q", q.Name, q.Type)
+		}
+	}
 	if c.Schedule.PingInterval < 5*time.Second {
 		return fmt.Errorf("ping interval must be at least 5s")
 	}
 	if c.Schedule.DNSInterval < 10*time.Second {
 		return fmt.Errorf("DNS interval must be at least 10s")
 	}
+	// Zero leaves runs unbounded; otherwise the scheduler cuts each run
+	// off at the timeout or the probe's interval, whichever is shorter.
+	if c.Schedule.ProbeTimeout < 0 {
+		return fmt.Errorf("probe timeout must not be negative")
+	}
+	if c.Schedule.StartJitter < 0 || c.Schedule.Jitter < 0 {
+		return fmt.Errorf("start_jitter and jitter must not be negative")
+	}
+	switch c.Schedule.Overrun {
+	case "skip", "queue", "concurrent":
+	default:
+		return fmt.Errorf("overrun must be skip, queue or concurrent")
+	}
+	if c.Schedule.Exclusion.Policy != "wait" && c.Schedule.Exclusion.Policy != "tag" {
+		return fmt.Errorf("exclusion policy must be wait or tag")
+	}
+	for _, group := range [][]string{c.Schedule.Exclusion.Load, c.Schedule.Exclusion.Passive} {
+		for _, name := range group {
+			if !probeTypes[probe.ProbeType(name)] {
+				return fmt.Errorf("exclusion names unknown probe %q", name)
+			}
+		}
+	}
+	for _, load := range c.Schedule.Exclusion.Load {
+		for _, passive := range c.Schedule.Exclusion.Passive {
+			if load == passive {
+				return fmt.Errorf("probe %q cannot be both load and passive", load)
+			}
+		}
+	}
+	if _, err := c.Schedule.Timetables(); err != nil {
+		return err
+	}
+	for probeType := range c.Schedule.Adaptive.Intervals {
+		if !probeTypes[probe.ProbeType(probeType)] {
+			return fmt.Errorf("adaptive intervals name unknown probe %q", probeType)
+		}
+	}
+	if a := c.Schedule.Adaptive; a.Enabled {
+		if a.LossThreshold < 0 || a.LatencyThreshold < 0 {
+			return fmt.Errorf("adaptive thresholds must not be negative")
+		}
+		if a.LossThreshold == 0 && a.LatencyThreshold == 0 {
+			return fmt.Errorf("adaptive probing needs a loss or latency threshold")
+		}
+		if a.EscalateAfter < 1 || a.RecoverAfter < 1 {
+			return fmt.Errorf("adaptive escalate_after and recover_after must be at least 1")
+		}
+		for probeType, interval := range a.Intervals {
+			if interval < 5*time.Second {
+				return fmt.Errorf("adaptive %s interval must be at least 5s", probeType)
+			}
+		}
+	}
 	if c.Schedule.BufferbloatInterval < 60*time.Second {
 		return fmt.Errorf("bufferbloat interval must be at least 60s")
 	}
+	if len(c.Targets.HTTP) > 0 && c.Schedule.HTTPInterval < 10*time.Second {
+		return fmt.Errorf("HTTP interval must be at least 10s")
+	}
+	if len(c.Targets.TCP) > 0 && c.Schedule.TCPInterval < 5*time.Second {
+		return fmt.Errorf("TCP interval must be at least 5s")
+	}
+	for _, target := range c.Targets.TCP {
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			return fmt.Errorf("TCP target %q must be host:port: %w", target, err)
+		}
+	}
+	if len(c.Targets.TLS) > 0 && c.Schedule.TLSInterval < 10*time.Second {
+		return fmt.Errorf("TLS interval must be at least 10s")
+	}
+	for _, target := range c.Targets.TLS {
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			return fmt.Errorf("TLS target %q must be host:port: %w", target, err)
+		}
+	}
+	if len(c.Targets.QUIC) > 0 && c.Schedule.QUICInterval < 60*time.Second {
+		return fmt.Errorf("QUIC interval must be at least 60s")
+	}
+	for _, target := range c.Targets.QUIC {
+		if _, _, err := net.SplitHostPort(target); err != nil {
+			return fmt.Errorf("QUIC target %q must be host:port: %w", target, err)
+		}
+	}
+	if c.Targets.Gateway != "" {
+		if c.Targets.Gateway != "auto" && net.ParseIP(c.Targets.Gateway) == nil {
+			return fmt.Errorf("gateway must be \"auto\" or an IP address")
+		}
+		if c.Targets.Gateway == "auto" && runtime.GOOS != "linux" {
+			return fmt.Errorf("gateway auto-discovery needs Linux; set the gateway address")
+		}
+		if c.Schedule.GatewayInterval < 5*time.Second {
+			return fmt.Errorf("gateway interval must be at least 5s")
+		}
+	}
+	if c.Traceroute.Enabled {
+		if c.Schedule.TracerouteInterval < 60*time.Second {
+			return fmt.Errorf("traceroute interval must be at least 60s")
+		}
+		if c.Traceroute.MaxHops < 1 || c.Traceroute.MaxHops > 64 {
+			return fmt.Errorf("traceroute max hops must be between 1 and 64")
+		}
+	}
+	if c.PMTU.Enabled {
+		if runtime.GOOS != "linux" {
+			return fmt.Errorf("PMTU discovery is only supported on Linux")
+		}
+		if c.Schedule.PMTUInterval < time.Minute {
+			return fmt.Errorf("PMTU interval must be at least 1m")
+		}
+		// 576 bytes is where the bisection starts, so it must be larger.
+		if c.PMTU.MaxSize <= 576 || c.PMTU.MaxSize > 9000 {
+			return fmt.Errorf("PMTU max size must be above 576 and at most 9000")
+		}
+	}
+	if len(c.Targets.UDPStream) > 0 {
+		for _, target := range c.Targets.UDPStream {
+			if _, _, err := net.SplitHostPort(target); err != nil {
+				return fmt.Errorf("UDP stream target %q must be host:port: %w", target, err)
+			}
+		}
+		if c.Schedule.UDPStreamInterval < time.Minute {
+			return fmt.Errorf("UDP stream interval must be at least 1m")
+		}
+		if c.UDPStream.Rate < 1 || c.UDPStream.Rate > 1000 {
+			return fmt.Errorf("UDP stream rate must be between 1 and 1000 packets per second")
+		}
+		if c.UDPStream.Duration < time.Second || c.UDPStream.Duration >= c.Schedule.UDPStreamInterval {
+			return fmt.Errorf("UDP stream duration must be at least 1s and shorter than its interval")
+		}
+		if c.UDPStream.PacketSize < 24 || c.UDPStream.PacketSize > 1472 {
+			return fmt.Errorf("UDP stream packet size must be between 24 and 1472 bytes")
+		}
+	}
+	if len(c.Targets.TWAMP) > 0 {
+		if c.Schedule.TWAMPInterval < time.Minute {
+			return fmt.Errorf("TWAMP interval must be at least 1m")
+		}
+		if c.TWAMP.Rate < 1 || c.TWAMP.Rate > 1000 {
+			return fmt.Errorf("TWAMP rate must be between 1 and 1000 packets per second")
+		}
+		if c.TWAMP.Duration < time.Second || c.TWAMP.Duration >= c.Schedule.TWAMPInterval {
+			return fmt.Errorf("TWAMP duration must be at least 1s and shorter than its interval")
+		}
+		if c.TWAMP.PacketSize < 41 || c.TWAMP.PacketSize > 1472 {
+			return fmt.Errorf("TWAMP packet size must be between 41 and 1472 bytes")
+		}
+	}
+	if len(c.Targets.NTP) > 0 {
+		if c.Schedule.NTPInterval < time.Minute {
+			return fmt.Errorf("NTP interval must be at least 1m")
+		}
+		if c.NTP.MaxOffset <= 0 {
+			return fmt.Errorf("NTP max offset must be positive")
+		}
+		if c.NTP.Timeout <= 0 || c.NTP.Timeout >= c.Schedule.NTPInterval {
+			return fmt.Errorf("NTP timeout must be positive and shorter than its interval")
+		}
+	}
+	if c.PublicIP.Enabled {
+		if c.Schedule.PublicIPInterval < time.Minute {
+			return fmt.Errorf("public IP interval must be at least 1m")
+		}
+		if c.PublicIP.STUNServer != "" {
+			if _, _, err := net.SplitHostPort(c.PublicIP.STUNServer); err != nil {
+				return fmt.Errorf("STUN server %q must be host:port: %w", c.PublicIP.STUNServer, err)
+			}
+		} else if u, err := url.Parse(c.PublicIP.EchoURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("public IP echo URL %q must be an http(s) URL", c.PublicIP.EchoURL)
+		}
+		if c.PublicIP.ASNDatabase != "" {
+			if _, err := os.Stat(c.PublicIP.ASNDatabase); err != nil {
+				return fmt.Errorf("ASN database: %w", err)
+			}
+		}
+	}
+	if c.Portal.Enabled {
+		if c.Schedule.PortalInterval < time.Minute {
+			return fmt.Errorf("portal interval must be at least 1m")
+		}
+		if len(c.Portal.Checks) == 0 && len(c.Portal.TLS) == 0 {
+			return fmt.Errorf("portal detection needs at least one check or TLS host")
+		}
+		for _, check := range c.Portal.Checks {
+			if u, err := url.Parse(check.URL); err != nil || u.Scheme != "http" {
+				return fmt.Errorf("portal check URL %q must be a plain http URL", check.URL)
+			}
+			if check.Status < 100 || check.Status > 599 {
+				return fmt.Errorf("portal check %q needs an expected HTTP status", check.URL)
+			}
+		}
+		for _, pin := range c.Portal.TLS {
+			if _, _, err := net.SplitHostPort(pin.Host); err != nil {
+				return fmt.Errorf("portal TLS host %q must be host:port: %w", pin.Host, err)
+			}
+		}
+		if c.Portal.Timeout <= 0 || c.Portal.Timeout >= c.Schedule.PortalInterval {
+			return fmt.Errorf("portal timeout must be positive and shorter than its interval")
+		}
+	}
+	if c.VoIP.Codec != "g711" && c.VoIP.Codec != "opus" {
+		return fmt.Errorf("VoIP codec must be g711 or opus")
+	}
+	if c.Throughput.Enabled {
+		if c.Schedule.ThroughputInterval < 10*time.Minute {
+			return fmt.Errorf("throughput interval must be at least 10m")
+		}
+		if c.Throughput.DownloadURL == "" && c.Throughput.UploadURL == "" {
+			return fmt.Errorf("throughput needs a download or upload URL")
+		}
+		if c.Throughput.Streams < 1 || c.Throughput.Streams > 16 {
+			return fmt.Errorf("throughput streams must be between 1 and 16")
+		}
+		if c.Throughput.Warmup >= c.Throughput.Duration {
+			return fmt.Errorf("throughput warmup must be shorter than duration")
+		}
+		if c.Throughput.RunMB < 1 {
+			return fmt.Errorf("throughput run estimate must be at least 1 MB")
+		}
+	}
+	if c.DataBudget.DailyMB < 0 || c.DataBudget.MonthlyMB < 0 {
+		return fmt.Errorf("data budget must not be negative")
+	}
+	if c.DataBudget.BufferbloatRunMB < 1 {
+		return fmt.Errorf("bufferbloat run estimate must be at least 1 MB")
+	}
 	if c.Targets.BufferbloatDownloadURL == "" {
 		return fmt.Errorf("bufferbloat download URL is required")
 	}
 	return nil
 }
 
+// Timetables parses the per-probe schedule windows, adding quiet hours to
+// every load-generating probe.
+func (s ScheduleConfig) Timetables() (map[probe.ProbeType]probe.Timetable, error) {
+	timetables := make(map[probe.ProbeType]probe.Timetable)
+	parseWindows := func(specs []string) ([]probe.Window, error) {
+		windows := make([]probe.Window, 0, len(specs))
+		for _, spec := range specs {
+			w, err := probe.ParseWindow(spec)
+			if err != nil {
+				return nil, err
+			}
+			windows = append(windows, w)
+		}
+		return windows, nil
+	}
+
+	for name, wc := range s.Windows {
+		if !probeTypes[probe.ProbeType(name)] {
+			return nil, fmt.Errorf("schedule windows name unknown probe %q", name)
+		}
+		var tt probe.Timetable
+		var err error
+		if wc.Cron != "" {
+			if tt.Cron, err = probe.ParseCron(wc.Cron); err != nil {
+				return nil, fmt.Errorf("schedule for %s: %w", name, err)
+			}
+		}
+		if tt.Only, err = parseWindows(wc.Only); err != nil {
+			return nil, fmt.Errorf("schedule for %s: %w", name, err)
+		}
+		if tt.Except, err = parseWindows(wc.Except); err != nil {
+			return nil, fmt.Errorf("schedule for %s: %w", name, err)
+		}
+		timetables[probe.ProbeType(name)] = tt
+	}
+
+	quiet, err := parseWindows(s.QuietHours)
+	if err != nil {
+		return nil, fmt.Errorf("quiet hours: %w", err)
+	}
+	if len(quiet) > 0 {
+		for _, name := range s.Exclusion.Load {
+			tt := timetables[probe.ProbeType(name)]
+			tt.Except = append(tt.Except, quiet...)
+			timetables[probe.ProbeType(name)] = tt
+		}
+	}
+	return timetables, nil
+}
+
+// validateResolver checks a targets.dns entry. Besides "system" and plain
+// addresses, resolvers may be udp://, tls:// (DoT), https:// (DoH) or
+// quic:// (DoQ) URIs.
+func validateResolver(resolver string) error {
+	if !strings.Contains(resolver, "://") {
+		return nil
+	}
+
+	u, err := url.Parse(resolver)
+	if err != nil {
+		return fmt.Errorf("DNS resolver %q is not a valid URI: %w", resolver, err)
+	}
+	switch u.Scheme {
+	case "udp", "tls", "https", "quic":
+	default:
+		return fmt.Errorf("DNS resolver %q has unsupported scheme %q", resolver, u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("DNS resolver %q has no host", resolver)
+	}
+	return nil
+}
+
+// templateExamples is appended to the template to show opt-in probes that
+// send traffic to third-party hosts, which stay off until targets are
+// listed.
+const templateExamples = `
+# Opt-in targets, for example:
+#
+# targets:
+#   http:
+#     - https://www.google.com/generate_204
+#     - https://www.cloudflare.com/cdn-cgi/trace
+#   tcp:
+#     - 1.1.1.1:443
+#   ntp:
+#     - time.cloudflare.com
+#     - pool.ntp.org
+#   bufferbloat_upload_url: https://speed.cloudflare.com/__up
+#
+# public_ip:
+#   enabled: true
+#   echo_url: https://www.cloudflare.com/cdn-cgi/trace
+#
+# portal:
+#   enabled: true
+#   checks:
+#     - url: http://connectivitycheck.gstatic.com/generate_204
+#       status: 204
+#   tls:
+#     - host: www.google.com:443
+`
+
 // WriteTemplate writes a default config file to the given path.
 func WriteTemplate(path string) error {
 	cfg := DefaultConfig()
@@ -142,5 +853,5 @@ func WriteTemplate(path string) error {
 	}
 
 	header := "# NetPulse Probe Configuration\n# See https://github.com/netpulse/netpulse for documentation\n\n"
-	return os.WriteFile(path, []byte(header+string(data)), 0644)
+	return os.WriteFile(path, []byte(header+string(data)+templateExamples), 0644)
 }
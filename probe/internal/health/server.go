@@ -5,18 +5,46 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
 // Status holds the current health status of the probe.
 type Status struct {
-	Healthy       bool      `json:"healthy"`
-	Uptime        string    `json:"uptime"`
-	LastPing      time.Time `json:"last_ping,omitempty"`
-	LastDNS       time.Time `json:"last_dns,omitempty"`
-	LastBufferbloat time.Time `json:"last_bufferbloat,omitempty"`
-	MeasurementCount int64  `json:"measurement_count"`
+	Healthy          bool                     `json:"healthy"`
+	Uptime           string                   `json:"uptime"`
+	LastPing         time.Time                `json:"last_ping,omitempty"`
+	LastDNS          time.Time                `json:"last_dns,omitempty"`
+	LastBufferbloat  time.Time                `json:"last_bufferbloat,omitempty"`
+	LastHTTP         time.Time                `json:"last_http,omitempty"`
+	LastTCP          time.Time                `json:"last_tcp,omitempty"`
+	LastTraceroute   time.Time                `json:"last_traceroute,omitempty"`
+	LastThroughput   time.Time                `json:"last_throughput,omitempty"`
+	LastGateway      time.Time                `json:"last_gateway,omitempty"`
+	LastPMTU         time.Time                `json:"last_pmtu,omitempty"`
+	LastUDPStream    time.Time                `json:"last_udp_stream,omitempty"`
+	LastTWAMP        time.Time                `json:"last_twamp,omitempty"`
+	LastNTP          time.Time                `json:"last_ntp,omitempty"`
+	LastPublicIP     time.Time                `json:"last_public_ip,omitempty"`
+	LastPortal       time.Time                `json:"last_portal,omitempty"`
+	LastTLS          time.Time                `json:"last_tls,omitempty"`
+	LastQUIC         time.Time                `json:"last_quic,omitempty"`
+	MeasurementCount int64                    `json:"measurement_count"`
+	ClockOffsetMs    *float64                 `json:"clock_offset_ms,omitempty"`
+	ClockUntrusted   bool                     `json:"clock_untrusted"`
+	Findings         map[string]string        `json:"findings,omitempty"`
+	Schedule         map[string]ScheduleStats `json:"schedule,omitempty"`
+}
+
+// ScheduleStats counts a probe type's scheduled runs: runs started, ticks
+// that came due while a run was still going, ticks that never ran, and
+// runs cut off by the probe timeout.
+type ScheduleStats struct {
+	Runs     int64 `json:"runs"`
+	Overruns int64 `json:"overruns"`
+	Skipped  int64 `json:"skipped"`
+	TimedOut int64 `json:"timed_out"`
 }
 
 // Server provides a local HTTP health endpoint.
@@ -26,7 +54,26 @@ type Server struct {
 	lastPing         atomic.Value
 	lastDNS          atomic.Value
 	lastBufferbloat  atomic.Value
+	lastHTTP         atomic.Value
+	lastTCP          atomic.Value
+	lastTraceroute   atomic.Value
+	lastThroughput   atomic.Value
+	lastGateway      atomic.Value
+	lastPMTU         atomic.Value
+	lastUDPStream    atomic.Value
+	lastTWAMP        atomic.Value
+	lastNTP          atomic.Value
+	lastPublicIP     atomic.Value
+	lastPortal       atomic.Value
+	lastTLS          atomic.Value
+	lastQUIC         atomic.Value
+	clockOffset      atomic.Pointer[float64]
+	clockUntrusted   atomic.Bool
 	logger           *slog.Logger
+
+	mu       sync.Mutex
+	findings map[string]string
+	schedule func() map[string]ScheduleStats
 }
 
 // NewServer creates a health check server.
@@ -34,10 +81,24 @@ func NewServer(logger *slog.Logger) *Server {
 	s := &Server{
 		startTime: time.Now(),
 		logger:    logger,
+		findings:  make(map[string]string),
 	}
 	s.lastPing.Store(time.Time{})
 	s.lastDNS.Store(time.Time{})
 	s.lastBufferbloat.Store(time.Time{})
+	s.lastHTTP.Store(time.Time{})
+	s.lastTCP.Store(time.Time{})
+	s.lastTraceroute.Store(time.Time{})
+	s.lastThroughput.Store(time.Time{})
+	s.lastGateway.Store(time.Time{})
+	s.lastPMTU.Store(time.Time{})
+	s.lastUDPStream.Store(time.Time{})
+	s.lastTWAMP.Store(time.Time{})
+	s.lastNTP.Store(time.Time{})
+	s.lastPublicIP.Store(time.Time{})
+	s.lastPortal.Store(time.Time{})
+	s.lastTLS.Store(time.Time{})
+	s.lastQUIC.Store(time.Time{})
 	return s
 }
 
@@ -52,9 +113,62 @@ func (s *Server) RecordMeasurement(probeType string) {
 		s.lastDNS.Store(now)
 	case "bufferbloat":
 		s.lastBufferbloat.Store(now)
+	case "http":
+		s.lastHTTP.Store(now)
+	case "tcp":
+		s.lastTCP.Store(now)
+	case "traceroute":
+		s.lastTraceroute.Store(now)
+	case "throughput":
+		s.lastThroughput.Store(now)
+	case "gateway":
+		s.lastGateway.Store(now)
+	case "pmtu":
+		s.lastPMTU.Store(now)
+	case "udp_stream":
+		s.lastUDPStream.Store(now)
+	case "twamp":
+		s.lastTWAMP.Store(now)
+	case "ntp":
+		s.lastNTP.Store(now)
+	case "public_ip":
+		s.lastPublicIP.Store(now)
+	case "portal":
+		s.lastPortal.Store(now)
+	case "tls":
+		s.lastTLS.Store(now)
+	case "quic":
+		s.lastQUIC.Store(now)
+	}
+}
+
+// RecordClock updates the latest NTP clock offset in milliseconds and
+// whether measurement timestamps are currently untrusted.
+func (s *Server) RecordClock(offsetMs *float64, untrusted bool) {
+	s.clockOffset.Store(offsetMs)
+	s.clockUntrusted.Store(untrusted)
+}
+
+// RecordFinding marks a browsing obstacle of the given kind as active with
+// detail, or clears it.
+func (s *Server) RecordFinding(kind string, active bool, detail string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if active {
+		s.findings[kind] = detail
+	} else {
+		delete(s.findings, kind)
 	}
 }
 
+// SetScheduleSource registers where per-probe schedule counters are read
+// from when health is requested.
+func (s *Server) SetScheduleSource(fn func() map[string]ScheduleStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedule = fn
+}
+
 // Run starts the health HTTP server. Blocks until ctx is cancelled.
 func (s *Server) Run(ctx context.Context, addr string) error {
 	mux := http.NewServeMux()
@@ -86,7 +200,36 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		LastPing:         s.lastPing.Load().(time.Time),
 		LastDNS:          s.lastDNS.Load().(time.Time),
 		LastBufferbloat:  s.lastBufferbloat.Load().(time.Time),
+		LastHTTP:         s.lastHTTP.Load().(time.Time),
+		LastTCP:          s.lastTCP.Load().(time.Time),
+		LastTraceroute:   s.lastTraceroute.Load().(time.Time),
+		LastThroughput:   s.lastThroughput.Load().(time.Time),
+		LastGateway:      s.lastGateway.Load().(time.Time),
+		LastPMTU:         s.lastPMTU.Load().(time.Time),
+		LastUDPStream:    s.lastUDPStream.Load().(time.Time),
+		LastTWAMP:        s.lastTWAMP.Load().(time.Time),
+		LastNTP:          s.lastNTP.Load().(time.Time),
+		LastPublicIP:     s.lastPublicIP.Load().(time.Time),
+		LastPortal:       s.lastPortal.Load().(time.Time),
+		LastTLS:          s.lastTLS.Load().(time.Time),
+		LastQUIC:         s.lastQUIC.Load().(time.Time),
 		MeasurementCount: s.measurementCount.Load(),
+		ClockOffsetMs:    s.clockOffset.Load(),
+		ClockUntrusted:   s.clockUntrusted.Load(),
+	}
+
+	s.mu.Lock()
+	if len(s.findings) > 0 {
+		status.Findings = make(map[string]string, len(s.findings))
+		for kind, detail := range s.findings {
+			status.Findings[kind] = detail
+		}
+	}
+	schedule := s.schedule
+	s.mu.Unlock()
+
+	if schedule != nil {
+		status.Schedule = schedule()
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,141 @@
+package probe
+
+import (
+	"sync"
+	"time"
+)
+
+// EscalationPolicy shortens probe intervals while the link is degraded, so
+// that a short outage is sampled every few seconds rather than once or
+// twice, and backs off once it recovers.
+type EscalationPolicy struct {
+	// Trigger is the probe whose results decide escalation; the default is
+	// ping.
+	Trigger ProbeType
+	// LossThreshold is packet loss in percent at or above which a result
+	// is degraded. Zero disables the check.
+	LossThreshold float64
+	// LatencyThreshold is average latency in milliseconds at or above
+	// which a result is degraded. Zero disables the check.
+	LatencyThreshold float64
+	// EscalateAfter is the number of consecutive degraded trigger runs
+	// needed to escalate; the default is 1.
+	EscalateAfter int
+	// RecoverAfter is the number of consecutive healthy trigger runs
+	// needed to back off; the default is 3.
+	RecoverAfter int
+	// Intervals replaces the interval of each listed probe while
+	// escalated. Probes not listed keep their usual interval.
+	Intervals map[ProbeType]time.Duration
+}
+
+// escalator tracks whether the link is degraded according to an
+// EscalationPolicy. A nil escalator never escalates. It is safe for
+// concurrent use.
+type escalator struct {
+	policy EscalationPolicy
+
+	mu        sync.Mutex
+	escalated bool
+	// streak counts consecutive trigger runs that disagree with the
+	// current state.
+	streak int
+	// changed is closed and replaced on every transition.
+	changed chan struct{}
+}
+
+func newEscalator(policy *EscalationPolicy) *escalator {
+	if policy == nil {
+		return nil
+	}
+	e := &escalator{
+		policy:  *policy,
+		changed: make(chan struct{}),
+	}
+	if e.policy.Trigger == "" {
+		e.policy.Trigger = ProbeTypePing
+	}
+	if e.policy.EscalateAfter < 1 {
+		e.policy.EscalateAfter = 1
+	}
+	if e.policy.RecoverAfter < 1 {
+		e.policy.RecoverAfter = 3
+	}
+	return e
+}
+
+// observe feeds the result of a run of probeType into the policy and
+// reports whether the escalation state changed, and to what. A run that failed
+// outright counts as degraded; one that returned nothing without an error
+// is ignored.
+func (e *escalator) observe(probeType ProbeType, ms []Measurement, err error) (changed, escalated bool) {
+	if e == nil || probeType != e.policy.Trigger {
+		return false, false
+	}
+
+	var degraded bool
+	switch {
+	case len(ms) > 0:
+		degraded = e.isDegraded(ms)
+	case err != nil:
+		degraded = true
+	default:
+		return false, false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if degraded == e.escalated {
+		e.streak = 0
+		return false, e.escalated
+	}
+	e.streak++
+	need := e.policy.EscalateAfter
+	if e.escalated {
+		need = e.policy.RecoverAfter
+	}
+	if e.streak < need {
+		return false, e.escalated
+	}
+
+	e.escalated = degraded
+	e.streak = 0
+	close(e.changed)
+	e.changed = make(chan struct{})
+	return true, e.escalated
+}
+
+// isDegraded reports whether at least half of the measurements cross a
+// threshold, so that one unreachable target does not escalate on its own.
+func (e *escalator) isDegraded(ms []Measurement) bool {
+	bad := 0
+	for _, m := range ms {
+		switch {
+		case e.policy.LossThreshold > 0 && m.PacketLoss != nil && *m.PacketLoss >= e.policy.LossThreshold:
+			bad++
+		case e.policy.LatencyThreshold > 0 && m.LatencyAvg != nil && *m.LatencyAvg >= e.policy.LatencyThreshold:
+			bad++
+		}
+	}
+	return bad*2 >= len(ms)
+}
+
+// state returns the interval probeType should run at given its usual
+// interval, whether the link is escalated, and a channel that is closed on
+// the next transition.
+func (e *escalator) state(probeType ProbeType, interval time.Duration) (time.Duration, bool, <-chan struct{}) {
+	if e == nil {
+		return interval, false, nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.escalated {
+		if d, ok := e.policy.Intervals[probeType]; ok && d > 0 {
+			interval = d
+		}
+	}
+	return interval, e.escalated, e.changed
+}
@@ -0,0 +1,158 @@
+package probe
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEscalatorObserve(t *testing.T) {
+	healthy := []Measurement{{PacketLoss: F64(0), LatencyAvg: F64(20)}}
+	lossy := []Measurement{{PacketLoss: F64(50), LatencyAvg: F64(20)}}
+	slow := []Measurement{{PacketLoss: F64(0), LatencyAvg: F64(400)}}
+	halfBad := []Measurement{healthy[0], lossy[0]}
+	thirdBad := []Measurement{healthy[0], healthy[0], lossy[0]}
+	failed := errors.New("all targets failed")
+
+	type step struct {
+		probe         ProbeType
+		ms            []Measurement
+		err           error
+		wantChanged   bool
+		wantEscalated bool
+	}
+	ping := ProbeTypePing
+
+	tests := []struct {
+		name   string
+		policy EscalationPolicy
+		steps  []step
+	}{
+		{
+			name:   "escalates at once and recovers after three healthy runs",
+			policy: EscalationPolicy{LossThreshold: 10},
+			steps: []step{
+				{ping, healthy, nil, false, false},
+				{ping, lossy, nil, true, true},
+				{ping, healthy, nil, false, true},
+				{ping, healthy, nil, false, true},
+				{ping, healthy, nil, true, false},
+			},
+		},
+		{
+			name:   "a healthy run breaks the escalation streak",
+			policy: EscalationPolicy{LossThreshold: 10, EscalateAfter: 2},
+			steps: []step{
+				{ping, lossy, nil, false, false},
+				{ping, healthy, nil, false, false},
+				{ping, lossy, nil, false, false},
+				{ping, lossy, nil, true, true},
+			},
+		},
+		{
+			name:   "a degraded run breaks the recovery streak",
+			policy: EscalationPolicy{LossThreshold: 10, RecoverAfter: 2},
+			steps: []step{
+				{ping, lossy, nil, true, true},
+				{ping, healthy, nil, false, true},
+				{ping, lossy, nil, false, true},
+				{ping, healthy, nil, false, true},
+				{ping, healthy, nil, true, false},
+			},
+		},
+		{
+			name:   "failed runs are degraded and empty ones ignored",
+			policy: EscalationPolicy{LossThreshold: 10, RecoverAfter: 1},
+			steps: []step{
+				{ping, nil, failed, true, true},
+				{ping, nil, nil, false, true},
+				{ping, healthy, nil, true, false},
+			},
+		},
+		{
+			name:   "other probes do not count",
+			policy: EscalationPolicy{LossThreshold: 10},
+			steps: []step{
+				{ProbeTypeHTTP, lossy, nil, false, false},
+				{ProbeTypeHTTP, nil, failed, false, false},
+			},
+		},
+		{
+			name:   "custom trigger",
+			policy: EscalationPolicy{Trigger: ProbeTypeGateway, LossThreshold: 10},
+			steps: []step{
+				{ping, lossy, nil, false, false},
+				{ProbeTypeGateway, lossy, nil, true, true},
+			},
+		},
+		{
+			name:   "latency threshold",
+			policy: EscalationPolicy{LatencyThreshold: 200},
+			steps: []step{
+				{ping, lossy, nil, false, false},
+				{ping, slow, nil, true, true},
+			},
+		},
+		{
+			name:   "half the targets degraded is enough",
+			policy: EscalationPolicy{LossThreshold: 10},
+			steps: []step{
+				{ping, thirdBad, nil, false, false},
+				{ping, halfBad, nil, true, true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEscalator(&tt.policy)
+			for i, s := range tt.steps {
+				_, _, transition := e.state(ProbeTypeDNS, time.Minute)
+				changed, _ := e.observe(s.probe, s.ms, s.err)
+				_, escalated, _ := e.state(ProbeTypeDNS, time.Minute)
+
+				if changed != s.wantChanged || escalated != s.wantEscalated {
+					t.Fatalf("step %d: changed %v escalated %v, want %v and %v",
+						i, changed, escalated, s.wantChanged, s.wantEscalated)
+				}
+				select {
+				case <-transition:
+					if !changed {
+						t.Fatalf("step %d: transition signalled without a change", i)
+					}
+				default:
+					if changed {
+						t.Fatalf("step %d: change not signalled", i)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEscalatorState(t *testing.T) {
+	e := newEscalator(&EscalationPolicy{
+		LossThreshold: 10,
+		Intervals:     map[ProbeType]time.Duration{ProbeTypePing: 5 * time.Second},
+	})
+	lossy := []Measurement{{PacketLoss: F64(100)}}
+
+	if d, escalated, _ := e.state(ProbeTypePing, time.Minute); d != time.Minute || escalated {
+		t.Errorf("before escalation: got %v escalated %v, want 1m and false", d, escalated)
+	}
+	e.observe(ProbeTypePing, lossy, nil)
+	if d, escalated, _ := e.state(ProbeTypePing, time.Minute); d != 5*time.Second || !escalated {
+		t.Errorf("escalated ping: got %v escalated %v, want 5s and true", d, escalated)
+	}
+	if d, _, _ := e.state(ProbeTypeDNS, time.Minute); d != time.Minute {
+		t.Errorf("escalated DNS: got %v, want its usual 1m", d)
+	}
+
+	var disabled *escalator
+	if changed, _ := disabled.observe(ProbeTypePing, lossy, nil); changed {
+		t.Error("nil escalator changed state")
+	}
+	if d, escalated, ch := disabled.state(ProbeTypePing, time.Minute); d != time.Minute || escalated || ch != nil {
+		t.Errorf("nil escalator: got %v escalated %v", d, escalated)
+	}
+}
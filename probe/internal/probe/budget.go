@@ -0,0 +1,157 @@
+package probe
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrBudgetExhausted is returned by load-generating probes that skip a run
+// because it would exceed the data budget.
+var ErrBudgetExhausted = errors.New("data budget exhausted")
+
+// UsageStore persists data budget usage so that it survives restarts.
+// Days are local calendar days formatted as 2006-01-02.
+type UsageStore interface {
+	// LoadUsage returns the bytes recorded under name for days from to to
+	// inclusive.
+	LoadUsage(name, from, to string) int64
+	// AddUsage adds n bytes to name's usage on day.
+	AddUsage(name, day string, n int64)
+}
+
+// DataBudgetOptions configures a DataBudget. Limits of zero or less mean
+// unlimited.
+type DataBudgetOptions struct {
+	// Name keys the budget's usage in Store.
+	Name         string
+	DailyLimit   int64
+	MonthlyLimit int64
+	// Store persists usage; nil keeps it in memory only.
+	Store UsageStore
+	// Parent is a wider budget this one also draws from, such as a
+	// link-wide cap shared by several probes.
+	Parent *DataBudget
+}
+
+// DataBudget caps the bytes load-generating probes may transfer per day
+// and per calendar month, which matters on metered links. It is safe for
+// concurrent use and may be shared between probes.
+type DataBudget struct {
+	opts DataBudgetOptions
+
+	mu        sync.Mutex
+	day       string
+	used      int64
+	month     string
+	monthUsed int64
+	now       func() time.Time
+}
+
+// NewDataBudget creates a budget from opts.
+func NewDataBudget(opts DataBudgetOptions) *DataBudget {
+	return &DataBudget{
+		opts: opts,
+		now:  time.Now,
+	}
+}
+
+// Allow reports whether transferring estimate more bytes today would stay
+// within the budget and its parent.
+func (b *DataBudget) Allow(estimate int64) bool {
+	return b.Remaining() >= estimate
+}
+
+// Remaining returns the bytes that may still be transferred today within
+// the budget and its parent, or math.MaxInt64 when neither has a limit.
+// Load-generating probes stop a run once they have moved this much.
+func (b *DataBudget) Remaining() int64 {
+	if b == nil {
+		return math.MaxInt64
+	}
+
+	b.mu.Lock()
+	b.rollover()
+	left := int64(math.MaxInt64)
+	if b.opts.DailyLimit > 0 {
+		left = min(left, b.opts.DailyLimit-b.used)
+	}
+	if b.opts.MonthlyLimit > 0 {
+		left = min(left, b.opts.MonthlyLimit-b.monthUsed)
+	}
+	b.mu.Unlock()
+
+	return max(0, min(left, b.opts.Parent.Remaining()))
+}
+
+// Record adds n transferred bytes to today's usage here and in the
+// parent.
+func (b *DataBudget) Record(n int64) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	b.rollover()
+	b.used += n
+	b.monthUsed += n
+	if b.opts.Store != nil && n > 0 {
+		b.opts.Store.AddUsage(b.opts.Name, b.day, n)
+	}
+	b.mu.Unlock()
+
+	b.opts.Parent.Record(n)
+}
+
+// Used returns the bytes transferred so far today.
+func (b *DataBudget) Used() int64 {
+	if b == nil {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rollover()
+	return b.used
+}
+
+// MonthUsed returns the bytes transferred so far this calendar month.
+func (b *DataBudget) MonthUsed() int64 {
+	if b == nil {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rollover()
+	return b.monthUsed
+}
+
+// rollover resets usage when the local calendar day changes, reloading it
+// from the store so a restart does not reset the budget. Callers must hold
+// b.mu.
+func (b *DataBudget) rollover() {
+	now := b.now()
+	today := now.Format("2006-01-02")
+	if today == b.day {
+		return
+	}
+	month := now.Format("2006-01")
+	firstOfMonth := month + "-01"
+
+	b.used = 0
+	if b.opts.Store != nil {
+		b.used = b.opts.Store.LoadUsage(b.opts.Name, today, today)
+	}
+	switch {
+	case b.opts.Store != nil:
+		b.monthUsed = b.opts.Store.LoadUsage(b.opts.Name, firstOfMonth, today)
+	case month != b.month:
+		b.monthUsed = 0
+	}
+	b.day = today
+	b.month = month
+}
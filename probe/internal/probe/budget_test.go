@@ -0,0 +1,207 @@
+package probe
+
+import (
+	"errors"
+	"io"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memUsage is a UsageStore kept in a map of name and day to bytes.
+type memUsage map[[2]string]int64
+
+func (m memUsage) LoadUsage(name, from, to string) int64 {
+	var total int64
+	for k, n := range m {
+		if k[0] == name && k[1] >= from && k[1] <= to {
+			total += n
+		}
+	}
+	return total
+}
+
+func (m memUsage) AddUsage(name, day string, n int64) {
+	m[[2]string{name, day}] += n
+}
+
+func TestDataBudgetRollover(t *testing.T) {
+	at := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2026, month, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	type step struct {
+		at        time.Time
+		record    int64
+		wantUsed  int64
+		wantMonth int64
+	}
+
+	tests := []struct {
+		name  string
+		store memUsage
+		steps []step
+	}{
+		{
+			name: "in memory",
+			steps: []step{
+				{at(3, 30, 10), 100, 100, 100},
+				{at(3, 30, 23), 50, 150, 150},
+				{at(3, 31, 1), 20, 20, 170},
+				{at(4, 1, 0), 5, 5, 5},
+			},
+		},
+		{
+			name:  "stored",
+			store: memUsage{},
+			steps: []step{
+				{at(3, 30, 10), 100, 100, 100},
+				{at(3, 31, 1), 20, 20, 120},
+				{at(4, 1, 0), 5, 5, 5},
+			},
+		},
+		{
+			name: "restored after a restart",
+			store: memUsage{
+				{"test", "2026-02-28"}: 1000,
+				{"test", "2026-03-01"}: 300,
+				{"test", "2026-03-02"}: 40,
+			},
+			steps: []step{
+				{at(3, 2, 12), 0, 40, 340},
+				{at(3, 3, 12), 1, 1, 341},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DataBudgetOptions{Name: "test"}
+			if tt.store != nil {
+				opts.Store = tt.store
+			}
+			b := NewDataBudget(opts)
+			for i, s := range tt.steps {
+				b.now = func() time.Time { return s.at }
+				b.Record(s.record)
+				if used, month := b.Used(), b.MonthUsed(); used != s.wantUsed || month != s.wantMonth {
+					t.Fatalf("step %d: used %d this day and %d this month, want %d and %d",
+						i, used, month, s.wantUsed, s.wantMonth)
+				}
+			}
+		})
+	}
+}
+
+func TestDataBudgetRemaining(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      DataBudgetOptions
+		parent    *DataBudgetOptions
+		record    int64
+		want      int64
+		wantAllow bool
+	}{
+		{
+			name:      "unlimited",
+			record:    1 << 40,
+			want:      math.MaxInt64,
+			wantAllow: true,
+		},
+		{
+			name:      "daily limit",
+			opts:      DataBudgetOptions{DailyLimit: 1000},
+			record:    400,
+			want:      600,
+			wantAllow: true,
+		},
+		{
+			name:   "monthly limit is tighter",
+			opts:   DataBudgetOptions{DailyLimit: 1000, MonthlyLimit: 500},
+			record: 400,
+			want:   100,
+		},
+		{
+			name:   "overspent",
+			opts:   DataBudgetOptions{DailyLimit: 1000},
+			record: 1200,
+			want:   0,
+		},
+		{
+			name:   "parent is tighter",
+			opts:   DataBudgetOptions{DailyLimit: 1000},
+			parent: &DataBudgetOptions{DailyLimit: 600},
+			record: 400,
+			want:   200,
+		},
+		{
+			name:      "unlimited child of a limited parent",
+			parent:    &DataBudgetOptions{MonthlyLimit: 1000},
+			record:    400,
+			want:      600,
+			wantAllow: true,
+		},
+	}
+
+	now := func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.parent != nil {
+				tt.opts.Parent = NewDataBudget(*tt.parent)
+				tt.opts.Parent.now = now
+			}
+			b := NewDataBudget(tt.opts)
+			b.now = now
+			b.Record(tt.record)
+
+			if got := b.Remaining(); got != tt.want {
+				t.Errorf("Remaining() = %d, want %d", got, tt.want)
+			}
+			if got := b.Allow(500); got != tt.wantAllow {
+				t.Errorf("Allow(500) = %v, want %v", got, tt.wantAllow)
+			}
+			if tt.opts.Parent != nil && tt.opts.Parent.Used() != tt.record {
+				t.Errorf("parent used %d, want %d", tt.opts.Parent.Used(), tt.record)
+			}
+		})
+	}
+
+	var disabled *DataBudget
+	if !disabled.Allow(math.MaxInt64) || disabled.Remaining() != math.MaxInt64 {
+		t.Error("nil budget is not unlimited")
+	}
+}
+
+func TestCountingReaderLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int64
+		start   int64
+		limit   int64
+		wantN   int64
+		wantErr error
+	}{
+		{name: "no limit", size: 10000, wantN: 10000},
+		{name: "under the limit", size: 1000, limit: 5000, wantN: 1000},
+		{name: "stops at the limit", size: 10000, limit: 5000, wantN: 5000, wantErr: ErrBudgetExhausted},
+		{name: "shared counter", size: 10000, start: 4000, limit: 5000, wantN: 1000, wantErr: ErrBudgetExhausted},
+		{name: "already spent", size: 10000, start: 5000, limit: 5000, wantErr: ErrBudgetExhausted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var counter atomic.Int64
+			counter.Store(tt.start)
+			r := &countingReader{r: io.LimitReader(zeroReader{}, tt.size), n: &counter, limit: tt.limit}
+
+			n, err := io.Copy(io.Discard, r)
+			if n != tt.wantN || !errors.Is(err, tt.wantErr) {
+				t.Errorf("copied %d bytes with error %v, want %d and %v", n, err, tt.wantN, tt.wantErr)
+			}
+			if got := counter.Load(); got != tt.start+tt.wantN {
+				t.Errorf("counter = %d, want %d", got, tt.start+tt.wantN)
+			}
+		})
+	}
+}
@@ -2,19 +2,33 @@ package probe
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sync/atomic"
 	"time"
 )
 
+// uploadBytes bounds the upload phase body. The upload is cancelled once
+// the loaded pings finish, so this only needs to outlast them.
+const uploadBytes = 50 << 20
+
 type BufferbloatProbe struct {
 	pingTarget  string
 	downloadURL string
+	uploadURL   string
 	pingCount   int
+	budget      *DataBudget
+	// runEstimate is the budget a run needs left before it starts.
+	runEstimate int64
 }
 
-func NewBufferbloatProbe(pingTarget string, downloadURL string) *BufferbloatProbe {
+// NewBufferbloatProbe creates a probe that compares idle latency with
+// latency while saturating the downlink and, when uploadURL is set, the
+// uplink. Runs only start when budget has runEstimate bytes left, and
+// fail once they have used what was left. A nil budget means unlimited.
+func NewBufferbloatProbe(pingTarget string, downloadURL string, uploadURL string, budget *DataBudget, runEstimate int64) *BufferbloatProbe {
 	if pingTarget == "" {
 		pingTarget = "1.1.1.1"
 	}
@@ -24,7 +38,10 @@ func NewBufferbloatProbe(pingTarget string, downloadURL string) *BufferbloatProb
 	return &BufferbloatProbe{
 		pingTarget:  pingTarget,
 		downloadURL: downloadURL,
+		uploadURL:   uploadURL,
 		pingCount:   10,
+		budget:      budget,
+		runEstimate: runEstimate,
 	}
 }
 
@@ -32,51 +49,90 @@ func (b *BufferbloatProbe) Type() ProbeType {
 	return ProbeTypeBufferbloat
 }
 
-func (b *BufferbloatProbe) Run() ([]Measurement, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+func (b *BufferbloatProbe) Run(ctx context.Context) ([]Measurement, error) {
+	if !b.budget.Allow(b.runEstimate) {
+		return nil, ErrBudgetExhausted
+	}
+	limit := b.budget.Remaining()
+
+	// Failed runs are charged too, since the data was transferred either
+	// way.
+	var transferred atomic.Int64
+	defer func() { b.budget.Record(transferred.Load()) }()
+	download := func(ctx context.Context) error { return b.runDownload(ctx, &transferred, limit) }
+	upload := func(ctx context.Context) error { return b.runUpload(ctx, &transferred, limit) }
 
 	idleLatency, err := b.measureLatency(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to measure idle latency: %w", err)
 	}
 
-	loadedLatency, err := b.measureLatencyUnderLoad(ctx)
+	downloadLatency, err := b.measureLatencyUnderLoad(ctx, download)
 	if err != nil {
-		return nil, fmt.Errorf("failed to measure loaded latency: %w", err)
+		return nil, fmt.Errorf("failed to measure download loaded latency: %w", err)
 	}
 
-	bufferbloatMs := loadedLatency - idleLatency
+	downloadBloat := downloadLatency - idleLatency
 
 	measurement := Measurement{
-		Timestamp:   time.Now(),
-		ProbeType:   ProbeTypeBufferbloat,
-		Target:      b.pingTarget,
-		LatencyAvg:  F64(idleLatency),
-		Bufferbloat: F64(bufferbloatMs),
+		Timestamp:             time.Now(),
+		ProbeType:             ProbeTypeBufferbloat,
+		Target:                b.pingTarget,
+		LatencyAvg:            F64(idleLatency),
+		LatencyIdle:           F64(idleLatency),
+		LatencyLoadedDownload: F64(downloadLatency),
+		BufferbloatDownload:   F64(downloadBloat),
+		Bufferbloat:           F64(downloadBloat),
 	}
 
+	if b.uploadURL != "" {
+		uploadLatency, err := b.measureLatencyUnderLoad(ctx, upload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to measure upload loaded latency: %w", err)
+		}
+
+		uploadBloat := uploadLatency - idleLatency
+		measurement.LatencyLoadedUpload = F64(uploadLatency)
+		measurement.BufferbloatUpload = F64(uploadBloat)
+
+		// The headline figure is the worse of the two directions.
+		if uploadBloat > downloadBloat {
+			measurement.Bufferbloat = F64(uploadBloat)
+		}
+	}
+
+	total := transferred.Load()
+	measurement.BytesTransferred = &total
+
 	return []Measurement{measurement}, nil
 }
 
 func (b *BufferbloatProbe) measureLatency(ctx context.Context) (float64, error) {
-	stats := pingWithFallback(b.pingTarget, b.pingCount, 10*time.Second)
+	stats := pingWithFallback(ctx, b.pingTarget, b.pingCount, 10*time.Second)
 	if stats == nil || stats.PacketsRecv == 0 {
 		return 0, fmt.Errorf("no successful pings")
 	}
 	return stats.AvgRtt.Seconds() * 1000, nil
 }
 
-func (b *BufferbloatProbe) measureLatencyUnderLoad(ctx context.Context) (float64, error) {
-	downloadCtx, downloadCancel := context.WithCancel(ctx)
-	defer downloadCancel()
+// measureLatencyUnderLoad pings while load saturates the link. If the load
+// fails before the pings finish, the result would not reflect a loaded
+// link, so that is reported as an error.
+func (b *BufferbloatProbe) measureLatencyUnderLoad(ctx context.Context, load func(context.Context) error) (float64, error) {
+	loadCtx, loadCancel := context.WithCancel(ctx)
+	defer loadCancel()
 
 	errChan := make(chan error, 1)
 	go func() {
-		errChan <- b.runDownload(downloadCtx)
+		errChan <- load(loadCtx)
 	}()
 
-	time.Sleep(500 * time.Millisecond)
+	// Give the load a moment to fill the queues before pinging.
+	select {
+	case <-time.After(500 * time.Millisecond):
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
 
 	pingCtx, pingCancel := context.WithTimeout(ctx, 10*time.Second)
 	defer pingCancel()
@@ -86,20 +142,27 @@ func (b *BufferbloatProbe) measureLatencyUnderLoad(ctx context.Context) (float64
 		return 0, fmt.Errorf("loaded ping failed: %w", err)
 	}
 
-	downloadCancel()
-
 	select {
-	case downloadErr := <-errChan:
-		if downloadErr != nil && downloadErr != context.Canceled {
-			return latency, nil
+	case loadErr := <-errChan:
+		if loadErr != nil && !errors.Is(loadErr, context.Canceled) {
+			return 0, fmt.Errorf("load ended early: %w", loadErr)
 		}
+		return latency, nil
+	default:
+	}
+
+	loadCancel()
+
+	select {
+	case <-errChan:
 	case <-time.After(1 * time.Second):
 	}
 
 	return latency, nil
 }
 
-func (b *BufferbloatProbe) runDownload(ctx context.Context) error {
+// runDownload fetches downloadURL, stopping once counter reaches limit.
+func (b *BufferbloatProbe) runDownload(ctx context.Context, counter *atomic.Int64, limit int64) error {
 	req, err := http.NewRequestWithContext(ctx, "GET", b.downloadURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
@@ -119,10 +182,51 @@ func (b *BufferbloatProbe) runDownload(ctx context.Context) error {
 		return fmt.Errorf("download failed with status: %d", resp.StatusCode)
 	}
 
-	_, err = io.Copy(io.Discard, resp.Body)
+	_, err = io.Copy(io.Discard, &countingReader{r: resp.Body, n: counter, limit: limit})
 	if err != nil && err != context.Canceled {
 		return fmt.Errorf("failed to consume download: %w", err)
 	}
 
 	return nil
 }
+
+// runUpload posts up to uploadBytes to uploadURL, stopping once counter
+// reaches limit.
+func (b *BufferbloatProbe) runUpload(ctx context.Context, counter *atomic.Int64, limit int64) error {
+	body := &countingReader{r: io.LimitReader(zeroReader{}, uploadBytes), n: counter, limit: limit}
+	req, err := http.NewRequestWithContext(ctx, "POST", b.uploadURL, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.ContentLength = uploadBytes
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	client := &http.Client{
+		Timeout: 25 * time.Second,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("upload request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("upload failed with status: %d", resp.StatusCode)
+	}
+
+	_, err = io.Copy(io.Discard, resp.Body)
+	if err != nil && err != context.Canceled {
+		return fmt.Errorf("failed to consume upload response: %w", err)
+	}
+
+	return nil
+}
+
+// zeroReader is an endless source of zero bytes for upload bodies.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
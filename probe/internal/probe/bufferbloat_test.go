@@ -0,0 +1,76 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBufferbloatRunUpload(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		limit     int64
+		wantBytes int64
+		wantErr   bool
+	}{
+		{name: "whole body", status: http.StatusOK, wantBytes: uploadBytes},
+		{name: "cut off at the budget", status: http.StatusOK, limit: 1 << 20, wantBytes: 1 << 20, wantErr: true},
+		{name: "sink rejects the upload", status: http.StatusForbidden, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received atomic.Int64
+			sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.status != http.StatusOK {
+					w.WriteHeader(tt.status)
+					return
+				}
+				n, _ := io.Copy(io.Discard, r.Body)
+				received.Store(n)
+			}))
+			defer sink.Close()
+
+			b := NewBufferbloatProbe("", "", sink.URL, nil, 0)
+			var counter atomic.Int64
+			err := b.runUpload(context.Background(), &counter, tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if got := counter.Load(); got != tt.wantBytes {
+				t.Errorf("counted %d bytes, want %d", got, tt.wantBytes)
+			}
+			sink.Close()
+			if got := received.Load(); got > tt.wantBytes || (!tt.wantErr && got != tt.wantBytes) {
+				t.Errorf("sink received %d bytes, want %d", got, tt.wantBytes)
+			}
+		})
+	}
+}
+
+func TestBufferbloatLoadHonoursCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	b := NewBufferbloatProbe("", "", "", nil, 0)
+	start := time.Now()
+	_, err := b.measureLatencyUnderLoad(ctx, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Errorf("took %v to notice cancellation", elapsed)
+	}
+}
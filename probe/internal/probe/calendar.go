@@ -0,0 +1,299 @@
+package probe
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timetable restricts when a probe runs, for example keeping load tests to
+// the small hours or off the link during business hours. Times are local.
+type Timetable struct {
+	// Cron, when set, fires runs at its times instead of every interval.
+	Cron *CronSchedule
+	// Only limits runs to these windows; empty allows any time.
+	Only []Window
+	// Except blocks runs during these windows.
+	Except []Window
+}
+
+// Allows reports whether a run may start at t.
+func (tt Timetable) Allows(t time.Time) bool {
+	for _, w := range tt.Except {
+		if w.Contains(t) {
+			return false
+		}
+	}
+	if len(tt.Only) == 0 {
+		return true
+	}
+	for _, w := range tt.Only {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+var weekdayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+// Window is a daily time range, optionally limited to some weekdays. A
+// range that ends before it starts runs past midnight into the next day.
+type Window struct {
+	days       [7]bool
+	start, end int // minutes since midnight
+}
+
+// ParseWindow parses "HH:MM-HH:MM", optionally preceded by weekdays such
+// as "Mon-Fri" or "Sat,Sun". A weekday range may wrap past Saturday, as in
+// "Fri-Mon". "24:00" is accepted as an end time.
+func ParseWindow(s string) (Window, error) {
+	var w Window
+	fields := strings.Fields(s)
+	span := ""
+	switch len(fields) {
+	case 1:
+		span = fields[0]
+		for d := range w.days {
+			w.days[d] = true
+		}
+	case 2:
+		span = fields[1]
+		bits, err := parseCronField(unwrapWeekdays(strings.ToLower(fields[0])), 0, 6, weekdayNames)
+		if err != nil {
+			return Window{}, fmt.Errorf("window %q: days: %w", s, err)
+		}
+		for d := range w.days {
+			w.days[d] = bits&(1<<d) != 0
+		}
+	default:
+		return Window{}, fmt.Errorf("window %q: want [days] HH:MM-HH:MM", s)
+	}
+
+	from, to, ok := strings.Cut(span, "-")
+	if !ok {
+		return Window{}, fmt.Errorf("window %q: want HH:MM-HH:MM", s)
+	}
+	var err error
+	if w.start, err = parseClock(from, false); err != nil {
+		return Window{}, fmt.Errorf("window %q: %w", s, err)
+	}
+	if w.end, err = parseClock(to, true); err != nil {
+		return Window{}, fmt.Errorf("window %q: %w", s, err)
+	}
+	if w.start == w.end {
+		return Window{}, fmt.Errorf("window %q is empty", s)
+	}
+	return w, nil
+}
+
+// unwrapWeekdays splits ranges that wrap past Saturday, such as "fri-mon",
+// into two that don't, "5-6,0-1", which parseCronField accepts. Anything
+// else is left for parseCronField to judge.
+func unwrapWeekdays(field string) string {
+	day := func(s string) (int, bool) {
+		if n, ok := weekdayNames[s]; ok {
+			return n, true
+		}
+		n, err := strconv.Atoi(s)
+		return n, err == nil && n >= 0 && n <= 6
+	}
+
+	parts := strings.Split(field, ",")
+	for i, part := range parts {
+		from, to, ok := strings.Cut(part, "-")
+		if !ok {
+			continue
+		}
+		lo, okLo := day(from)
+		hi, okHi := day(to)
+		if okLo && okHi && lo > hi {
+			parts[i] = fmt.Sprintf("%d-6,0-%d", lo, hi)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseClock(s string, allowMidnight bool) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err == nil {
+		return t.Hour()*60 + t.Minute(), nil
+	}
+	if allowMidnight && s == "24:00" {
+		return 24 * 60, nil
+	}
+	return 0, fmt.Errorf("invalid time %q", s)
+}
+
+// Contains reports whether t falls inside the window. A window running
+// past midnight belongs to the day it starts on.
+func (w Window) Contains(t time.Time) bool {
+	day := int(t.Weekday())
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return w.days[day] && minute >= w.start && minute < w.end
+	}
+	return (w.days[day] && minute >= w.start) || (w.days[(day+6)%7] && minute < w.end)
+}
+
+// CronSchedule is a standard five-field cron expression: minute, hour,
+// day of month, month and day of week. Fields accept *, lists, ranges,
+// steps and, for months and weekdays, three-letter names. As in cron, when
+// both day fields are restricted a day matching either one fires; a field
+// starting with *, such as */2, does not count as restricted, so it
+// narrows the other instead.
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+// ParseCron parses a five-field cron expression.
+func ParseCron(expr string) (*CronSchedule, error) {
+	fields := strings.Fields(strings.ToLower(expr))
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: want 5 fields, got %d", expr, len(fields))
+	}
+
+	c := &CronSchedule{
+		domAny: strings.HasPrefix(fields[2], "*"),
+		dowAny: strings.HasPrefix(fields[4], "*"),
+	}
+	var err error
+	specs := []struct {
+		dst      *uint64
+		min, max int
+		names    map[string]int
+	}{
+		{&c.minute, 0, 59, nil},
+		{&c.hour, 0, 23, nil},
+		{&c.dom, 1, 31, nil},
+		{&c.month, 1, 12, monthNames},
+		{&c.dow, 0, 7, weekdayNames},
+	}
+	for i, spec := range specs {
+		if *spec.dst, err = parseCronField(fields[i], spec.min, spec.max, spec.names); err != nil {
+			return nil, fmt.Errorf("cron %q: %w", expr, err)
+		}
+	}
+	// Both 0 and 7 mean Sunday.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron %q never fires", expr)
+	}
+	return c, nil
+}
+
+// parseCronField returns a bitmask of the values a field matches.
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	value := func(s string) (int, error) {
+		if n, ok := names[s]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("%q out of range %d-%d", s, min, max)
+		}
+		return n, nil
+	}
+
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		switch from, to, isRange := strings.Cut(rng, "-"); {
+		case rng == "*":
+		case isRange:
+			var err error
+			if lo, err = value(from); err != nil {
+				return 0, err
+			}
+			if hi, err = value(to); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		default:
+			n, err := value(rng)
+			if err != nil {
+				return 0, err
+			}
+			lo = n
+			if !hasStep {
+				hi = n
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the first minute after t that the schedule matches, or the
+// zero time if there is none within five years. Times skipped when clocks
+// go forward never match, and times repeated when they go back match only
+// the first time round.
+func (c *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	loc := t.Location()
+
+	for t.Before(limit) {
+		var next time.Time
+		switch {
+		case c.month&(1<<int(t.Month())) == 0:
+			next = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<t.Hour()) == 0:
+			next = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<t.Minute()) == 0:
+			next = t.Add(time.Minute)
+			// Clocks went back and the hour is starting over.
+			if next.Hour() == t.Hour() && next.Minute() == 0 {
+				next = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			}
+		default:
+			return t
+		}
+
+		// time.Date places a wall time that clocks skipped over before
+		// the skip, which can put it back at or before t.
+		for !next.After(t) {
+			next = next.Add(time.Hour)
+		}
+		t = next
+	}
+	return time.Time{}
+}
+
+func (c *CronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
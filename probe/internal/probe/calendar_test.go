@@ -0,0 +1,197 @@
+package probe
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{expr: "0 3 * * *"},
+		{expr: "*/15 * * * *"},
+		{expr: "0 9-17/2 * * Mon-Fri"},
+		{expr: "0,30 0 1 jan,jul *"},
+		{expr: "0 0 * * 7"},
+		{expr: "0 0 29 2 *"},
+		{expr: "0 3 * *", wantErr: true},
+		{expr: "0 3 * * * *", wantErr: true},
+		{expr: "60 * * * *", wantErr: true},
+		{expr: "* 24 * * *", wantErr: true},
+		{expr: "* * 0 * *", wantErr: true},
+		{expr: "* * * * 8", wantErr: true},
+		{expr: "5-1 * * * *", wantErr: true},
+		{expr: "*/0 * * * *", wantErr: true},
+		{expr: "* * * foo *", wantErr: true},
+		{expr: "0 0 31 2 *", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseCron(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCron(%q) error = %v, want error %v", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.UTC)
+	}
+	// 2026-03-01 is a Sunday. New York clocks go forward at 02:00 on
+	// 2026-03-08 and back at 02:00 on 2026-11-01.
+	edt := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.FixedZone("EDT", -4*3600))
+	}
+	est := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.FixedZone("EST", -5*3600))
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"later today", "0 3 * * *", utc(3, 1, 2, 59), utc(3, 1, 3, 0)},
+		{"strictly after from", "0 3 * * *", utc(3, 1, 3, 0), utc(3, 2, 3, 0)},
+		{"seconds are dropped", "*/15 * * * *", utc(3, 1, 10, 7).Add(30 * time.Second), utc(3, 1, 10, 15)},
+		{"over the weekend", "0 9 * * mon-fri", utc(3, 6, 10, 0), utc(3, 9, 9, 0)},
+		{"seven is Sunday", "0 0 * * 7", utc(3, 2, 0, 0), utc(3, 8, 0, 0)},
+		{"day of month only", "0 0 10 * *", utc(3, 7, 0, 0), utc(3, 10, 0, 0)},
+		{"day of week only", "0 0 * * fri", utc(3, 7, 0, 0), utc(3, 13, 0, 0)},
+		{"either day field", "0 0 10 * fri", utc(3, 7, 0, 0), utc(3, 10, 0, 0)},
+		{"either day field, weekday first", "0 0 20 * fri", utc(3, 7, 0, 0), utc(3, 13, 0, 0)},
+		{"stepped day of month narrows weekday", "0 0 */2 * Mon", utc(3, 1, 0, 0), utc(3, 9, 0, 0)},
+		{"stepped day of month skips even Mondays", "0 0 */2 * Mon", utc(3, 9, 0, 0), utc(3, 23, 0, 0)},
+		{"stepped day of month into next month", "0 0 */2 * Mon", utc(3, 23, 0, 0), utc(4, 13, 0, 0)},
+		{"month rollover", "0 0 1 * *", utc(12, 15, 0, 0), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", utc(3, 1, 0, 0), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"skipped by spring forward", "30 2 * * *", time.Date(2026, 3, 7, 23, 0, 0, 0, ny), edt(3, 9, 2, 30)},
+		{"hourly across spring forward", "0 * * * *", est(3, 8, 1, 30).In(ny), edt(3, 8, 3, 0)},
+		{"repeated by fall back fires once", "30 1 * * *", edt(11, 1, 1, 30).In(ny), est(11, 2, 1, 30)},
+		{"first of a repeated hour", "0 * * * *", edt(11, 1, 0, 30).In(ny), edt(11, 1, 1, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+			}
+			if got := c.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{spec: "02:00-05:00"},
+		{spec: "22:00-06:00"},
+		{spec: "00:00-24:00"},
+		{spec: "Mon-Fri 09:00-17:00"},
+		{spec: "sat,sun 10:00-12:00"},
+		{spec: "Fri-Mon 09:00-17:00"},
+		{spec: "Sat-Sun 09:00-17:00"},
+		{spec: "5-1 09:00-17:00"},
+		{spec: "09:00", wantErr: true},
+		{spec: "10:00-10:00", wantErr: true},
+		{spec: "24:00-06:00", wantErr: true},
+		{spec: "09:00-25:00", wantErr: true},
+		{spec: "Mon-Fri 09:00", wantErr: true},
+		{spec: "Funday 09:00-17:00", wantErr: true},
+		{spec: "Mon-Fri 09:00-17:00 extra", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			_, err := ParseWindow(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseWindow(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	// 2026-03-06 is a Friday.
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2026, 3, day, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec string
+		at   time.Time
+		want bool
+	}{
+		{"02:00-05:00", at(6, 2, 0), true},
+		{"02:00-05:00", at(6, 4, 59), true},
+		{"02:00-05:00", at(6, 5, 0), false},
+		{"00:00-24:00", at(6, 23, 59), true},
+		{"Mon-Fri 09:00-17:00", at(6, 12, 0), true},
+		{"Mon-Fri 09:00-17:00", at(7, 12, 0), false},
+		{"Fri 22:00-06:00", at(6, 23, 0), true},
+		{"Fri 22:00-06:00", at(7, 5, 59), true},
+		{"Fri 22:00-06:00", at(6, 5, 0), false},
+		{"Fri 22:00-06:00", at(7, 23, 0), false},
+		{"Fri-Mon 09:00-17:00", at(8, 12, 0), true},
+		{"Fri-Mon 09:00-17:00", at(9, 12, 0), true},
+		{"Fri-Mon 09:00-17:00", at(10, 12, 0), false},
+		{"Fri-Mon 09:00-17:00", at(5, 12, 0), false},
+		{"Sat-Sun 09:00-17:00", at(8, 12, 0), true},
+		{"Sat-Sun 09:00-17:00", at(9, 12, 0), false},
+	}
+
+	for _, tt := range tests {
+		w, err := ParseWindow(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseWindow(%q): %v", tt.spec, err)
+		}
+		if got := w.Contains(tt.at); got != tt.want {
+			t.Errorf("%q contains %v = %v, want %v", tt.spec, tt.at.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestTimetableAllows(t *testing.T) {
+	night, _ := ParseWindow("01:00-05:00")
+	weekend, _ := ParseWindow("Sat,Sun 00:00-24:00")
+	// 2026-03-07 is a Saturday.
+	sat3am := time.Date(2026, 3, 7, 3, 0, 0, 0, time.UTC)
+	fri3am := time.Date(2026, 3, 6, 3, 0, 0, 0, time.UTC)
+	fri3pm := time.Date(2026, 3, 6, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		tt   Timetable
+		at   time.Time
+		want bool
+	}{
+		{"no windows", Timetable{}, fri3pm, true},
+		{"inside only", Timetable{Only: []Window{night}}, fri3am, true},
+		{"outside only", Timetable{Only: []Window{night}}, fri3pm, false},
+		{"inside except", Timetable{Except: []Window{weekend}}, sat3am, false},
+		{"except wins over only", Timetable{Only: []Window{night}, Except: []Window{weekend}}, sat3am, false},
+		{"any only window", Timetable{Only: []Window{night, weekend}}, sat3am, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.tt.Allows(tt.at); got != tt.want {
+			t.Errorf("%s: Allows(%v) = %v, want %v", tt.name, tt.at, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package probe
+
+import (
+	"sync"
+	"time"
+)
+
+// ClockTrust tracks how far the system clock is from NTP time and flags
+// measurements taken while the offset exceeds a threshold, correcting
+// their timestamps by it. A probe that boots without a real-time clock can
+// be hours off until it syncs, and the dashboard rejects timestamps too
+// far in the future. It is safe for concurrent use.
+type ClockTrust struct {
+	threshold time.Duration
+
+	mu        sync.Mutex
+	offset    *float64
+	untrusted bool
+	// observed is when offset was measured, with a monotonic reading so
+	// later steps of the wall clock can be detected.
+	observed time.Time
+}
+
+// NewClockTrust distrusts the clock once its offset exceeds threshold.
+func NewClockTrust(threshold time.Duration) *ClockTrust {
+	return &ClockTrust{threshold: threshold}
+}
+
+// Observe updates the offset from any NTP measurements in ms, taking the
+// server with the lowest delay as the most accurate. It reports whether
+// the clock's trust changed.
+func (c *ClockTrust) Observe(ms []Measurement) bool {
+	var best *Measurement
+	for i := range ms {
+		m := &ms[i]
+		if m.ProbeType != ProbeTypeNTP || m.ClockOffset == nil || m.LatencyAvg == nil {
+			continue
+		}
+		if best == nil || *m.LatencyAvg < *best.LatencyAvg {
+			best = m
+		}
+	}
+	if best == nil {
+		return false
+	}
+
+	offset := *best.ClockOffset
+	untrusted := offset > durationMs(c.threshold) || offset < -durationMs(c.threshold)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	changed := c.offset == nil || untrusted != c.untrusted
+	c.offset = F64(offset)
+	c.untrusted = untrusted
+	c.observed = time.Now()
+	return changed
+}
+
+// Offset returns the latest clock offset in milliseconds, nil before any
+// NTP reply, and whether the clock is untrusted.
+func (c *ClockTrust) Offset() (*float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.offset, c.untrusted
+}
+
+// Annotate sets ClockUntrusted on m once the offset is known and, while
+// the clock is untrusted, moves m's Timestamp onto NTP time.
+func (c *ClockTrust) Annotate(m *Measurement) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.offset == nil {
+		return
+	}
+
+	// If the wall clock was stepped since the offset was measured, say by
+	// an NTP daemon catching up, it has moved apart from the monotonic
+	// clock by the size of the step, which is then no longer owed. The
+	// two readings are not taken at quite the same instant, so the
+	// difference is rounded to drop that noise.
+	now := time.Now()
+	step := (now.Round(0).Sub(c.observed.Round(0)) - now.Sub(c.observed)).Round(time.Millisecond)
+	offset := time.Duration(*c.offset*float64(time.Millisecond)) - step
+
+	untrusted := offset > c.threshold || offset < -c.threshold
+	m.ClockUntrusted = Bool(untrusted)
+	if untrusted {
+		m.Timestamp = m.Timestamp.Add(offset)
+	}
+}
@@ -0,0 +1,60 @@
+package probe
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockTrustAnnotate(t *testing.T) {
+	ts := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		offsetMs      *float64
+		wantUntrusted *bool
+		wantTimestamp time.Time
+	}{
+		{
+			name:          "no NTP reply yet",
+			wantTimestamp: ts,
+		},
+		{
+			name:          "within tolerance",
+			offsetMs:      F64(250),
+			wantUntrusted: Bool(false),
+			wantTimestamp: ts,
+		},
+		{
+			name:          "clock behind",
+			offsetMs:      F64(3_600_000),
+			wantUntrusted: Bool(true),
+			wantTimestamp: ts.Add(time.Hour),
+		},
+		{
+			name:          "clock ahead",
+			offsetMs:      F64(-90_000),
+			wantUntrusted: Bool(true),
+			wantTimestamp: ts.Add(-90 * time.Second),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClockTrust(time.Second)
+			if tt.offsetMs != nil {
+				c.Observe([]Measurement{{ProbeType: ProbeTypeNTP, ClockOffset: tt.offsetMs, LatencyAvg: F64(10)}})
+			}
+
+			m := Measurement{ProbeType: ProbeTypePing, Timestamp: ts}
+			c.Annotate(&m)
+
+			if (m.ClockUntrusted == nil) != (tt.wantUntrusted == nil) ||
+				(m.ClockUntrusted != nil && *m.ClockUntrusted != *tt.wantUntrusted) {
+				t.Errorf("ClockUntrusted = %v, want %v", m.ClockUntrusted, tt.wantUntrusted)
+			}
+			if !m.Timestamp.Equal(tt.wantTimestamp) {
+				t.Errorf("Timestamp = %v, want %v", m.Timestamp, tt.wantTimestamp)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package probe
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -11,15 +13,56 @@ import (
 	"github.com/miekg/dns"
 )
 
+// DNSQuery is a name and record type asked of every resolver.
+type DNSQuery struct {
+	Name string
+	// Type is a record type name such as "A", "AAAA", "HTTPS" or "MX".
+	Type string
+	// Expected lists the addresses Name should resolve to. When empty,
+	// answers are compared across resolvers instead.
+	Expected []string
+}
+
+// DNSOptions configures what DNSProbe queries and which integrity checks
+// it runs alongside the timing queries.
+type DNSOptions struct {
+	Queries []DNSQuery
+	// CacheBust times a query for a random label under each name, which no
+	// resolver has cached. Parent delegations stay cached, so the cold time
+	// covers the authoritative lookup for the leaf name rather than a walk
+	// from the root. It also primes the cache before the warm query.
+	CacheBust bool
+	// NXDomainCheck queries a random non-existent name to detect resolvers
+	// that redirect NXDOMAIN to ad or search pages.
+	NXDomainCheck bool
+	// InterceptionCanary is an address that runs no DNS server. Any
+	// answer from it means port 53 traffic is being intercepted.
+	InterceptionCanary string
+	// DNSSECZones are signed zones whose answers are requested with the DO
+	// bit and checked for the AD flag and valid RRSIGs.
+	DNSSECZones []string
+	// LargeResponseName has a TXT answer too big for 512 bytes, used to
+	// test EDNS0 large responses and truncation fallback to TCP.
+	LargeResponseName string
+	// DualStack queries resolvers given by hostname over IPv4 and IPv6
+	// separately.
+	DualStack bool
+}
+
 type DNSProbe struct {
-	resolvers   []string
-	queryDomain string
+	resolvers []string
+	opts      DNSOptions
+	timeout   time.Duration
 }
 
-func NewDNSProbe(resolvers []string, queryDomain string) *DNSProbe {
+func NewDNSProbe(resolvers []string, opts DNSOptions) *DNSProbe {
+	if len(opts.Queries) == 0 {
+		opts.Queries = []DNSQuery{{Name: "example.com", Type: "A"}}
+	}
 	return &DNSProbe{
-		resolvers:   resolvers,
-		queryDomain: queryDomain,
+		resolvers: resolvers,
+		opts:      opts,
+		timeout:   5 * time.Second,
 	}
 }
 
@@ -27,21 +70,30 @@ func (p *DNSProbe) Type() ProbeType {
 	return ProbeTypeDNS
 }
 
-func (p *DNSProbe) Run() ([]Measurement, error) {
+func (p *DNSProbe) Run(ctx context.Context) ([]Measurement, error) {
 	var wg sync.WaitGroup
-	results := make(chan Measurement, len(p.resolvers))
+	results := make(chan []Measurement, len(p.resolvers))
 	errors := make(chan error, len(p.resolvers))
 
+	var intercepted *bool
+	if p.opts.InterceptionCanary != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			intercepted = Bool(p.checkInterception(ctx))
+		}()
+	}
+
 	for _, resolver := range p.resolvers {
 		wg.Add(1)
 		go func(res string) {
 			defer wg.Done()
-			m, err := p.queryResolver(res)
+			ms, err := p.queryResolver(ctx, res)
 			if err != nil {
 				errors <- fmt.Errorf("resolver %s: %w", res, err)
 				return
 			}
-			results <- m
+			results <- ms
 		}(resolver)
 	}
 
@@ -50,8 +102,14 @@ func (p *DNSProbe) Run() ([]Measurement, error) {
 	close(errors)
 
 	var measurements []Measurement
-	for m := range results {
-		measurements = append(measurements, m)
+	for ms := range results {
+		for _, m := range ms {
+			// Interception rewrites plaintext port 53 traffic only.
+			if m.Protocol == dnsProtocolUDP {
+				m.DNSIntercepted = intercepted
+			}
+			measurements = append(measurements, m)
+		}
 	}
 
 	var errs []error
@@ -63,50 +121,179 @@ func (p *DNSProbe) Run() ([]Measurement, error) {
 		return nil, fmt.Errorf("all resolvers failed: %v", errs)
 	}
 
+	// Answers are only comparable between resolvers for the same question.
+	for _, q := range p.opts.Queries {
+		var same []int
+		for i, m := range measurements {
+			if m.QueryName == q.Name && m.QueryType == queryTypeName(q.Type) {
+				same = append(same, i)
+			}
+		}
+		group := make([]Measurement, len(same))
+		for j, i := range same {
+			group[j] = measurements[i]
+		}
+		markAnswerMismatches(group, q.Expected)
+		for j, i := range same {
+			measurements[i] = group[j]
+		}
+	}
+
 	return measurements, nil
 }
 
-func (p *DNSProbe) queryResolver(resolver string) (Measurement, error) {
-	var target string
-	var serverAddr string
+// queryResolver asks one resolver every configured query and returns a
+// measurement per query that got an answer. In dual-stack mode a resolver
+// given by hostname is queried once per IP family.
+func (p *DNSProbe) queryResolver(ctx context.Context, resolver string) ([]Measurement, error) {
+	spec, err := parseResolver(resolver)
+	if err != nil {
+		return nil, err
+	}
+	if !p.opts.DualStack || spec.family != "" {
+		return p.querySpec(ctx, spec)
+	}
 
-	if resolver == "system" {
-		systemDNS, err := getSystemDNS()
+	var measurements []Measurement
+	var errs []error
+	for _, family := range []string{FamilyIPv4, FamilyIPv6} {
+		familySpec := spec
+		familySpec.family = family
+		ms, err := p.querySpec(ctx, familySpec)
 		if err != nil {
-			return Measurement{}, fmt.Errorf("failed to get system DNS: %w", err)
+			errs = append(errs, fmt.Errorf("%s: %w", family, err))
+			continue
 		}
-		target = fmt.Sprintf("system-%s", systemDNS)
-		serverAddr = fmt.Sprintf("%s:53", systemDNS)
-	} else {
-		target = resolver
-		serverAddr = fmt.Sprintf("%s:53", resolver)
+		measurements = append(measurements, ms...)
+	}
+	if len(measurements) == 0 {
+		return nil, errors.Join(errs...)
 	}
 
-	msg := new(dns.Msg)
-	msg.SetQuestion(dns.Fqdn(p.queryDomain), dns.TypeA)
-	msg.RecursionDesired = true
+	markHappyEyeballs(measurements)
+	return measurements, nil
+}
 
-	client := &dns.Client{
-		Net:     "udp",
-		Timeout: 5 * time.Second,
+// markHappyEyeballs pairs the IPv4 and IPv6 measurements of each query and
+// records which family would win. Connection setup is what Happy Eyeballs
+// races, so the TCP connect or QUIC handshake time is compared where there
+// is one, and the query time for plain UDP.
+func markHappyEyeballs(ms []Measurement) {
+	setup := func(m Measurement) *float64 {
+		if m.ConnectTime != nil {
+			return m.ConnectTime
+		}
+		if m.TLSTime != nil {
+			return m.TLSTime
+		}
+		return m.DNSTime
 	}
 
-	start := time.Now()
-	_, _, err := client.Exchange(msg, serverAddr)
-	duration := time.Since(start)
+	type question struct{ name, qtype string }
+	times := make(map[question][2]*float64)
+	for _, m := range ms {
+		q := question{m.QueryName, m.QueryType}
+		t := times[q]
+		if m.IPFamily == FamilyIPv4 {
+			t[0] = setup(m)
+		} else {
+			t[1] = setup(m)
+		}
+		times[q] = t
+	}
 
-	if err != nil {
-		return Measurement{}, fmt.Errorf("DNS query failed: %w", err)
+	for i := range ms {
+		t := times[question{ms[i].QueryName, ms[i].QueryType}]
+		ms[i].HappyEyeballs = happyEyeballs(t[0], t[1])
+	}
+}
+
+// querySpec runs every configured query against one resolver endpoint.
+func (p *DNSProbe) querySpec(ctx context.Context, spec resolverSpec) ([]Measurement, error) {
+	var measurements []Measurement
+	var errs []error
+	for _, q := range p.opts.Queries {
+		m, err := p.runQuery(ctx, spec, q)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", q.Name, queryTypeName(q.Type), err))
+			continue
+		}
+		measurements = append(measurements, m)
+	}
+
+	if len(measurements) == 0 {
+		return nil, fmt.Errorf("DNS query failed: %w", errors.Join(errs...))
+	}
+
+	p.runResolverChecks(ctx, spec, measurements)
+
+	return measurements, nil
+}
+
+// runQuery times a single query against spec. With cache busting the name
+// is resolved once untimed so the timed lookup is served from cache, then
+// a random label under it is timed as the cold lookup.
+func (p *DNSProbe) runQuery(ctx context.Context, spec resolverSpec, q DNSQuery) (Measurement, error) {
+	qtype, ok := dns.StringToType[queryTypeName(q.Type)]
+	if !ok {
+		return Measurement{}, fmt.Errorf("unsupported record type %q", q.Type)
+	}
+	name := dns.Fqdn(q.Name)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*p.timeout)
+	defer cancel()
+
+	if p.opts.CacheBust {
+		p.exchange(ctx, spec, newDNSQuery(name, qtype))
 	}
 
-	dnsTimeMs := float64(duration.Milliseconds())
+	resp, timing, err := p.exchange(ctx, spec, newDNSQuery(name, qtype))
+	if err != nil {
+		return Measurement{}, err
+	}
 
-	return Measurement{
+	m := Measurement{
 		Timestamp: time.Now(),
 		ProbeType: ProbeTypeDNS,
-		Target:    target,
-		DNSTime:   F64(dnsTimeMs),
-	}, nil
+		Target:    spec.target,
+		DNSTime:   F64(durationMs(timing.query)),
+		Protocol:  spec.protocol,
+		IPFamily:  spec.family,
+		QueryName: q.Name,
+		QueryType: queryTypeName(q.Type),
+	}
+	if timing.connect > 0 {
+		m.ConnectTime = F64(durationMs(timing.connect))
+	}
+	if timing.handshake > 0 {
+		m.TLSTime = F64(durationMs(timing.handshake))
+	}
+	recordAnswer(&m, resp)
+
+	if p.opts.CacheBust {
+		_, cold, err := p.exchange(ctx, spec, newDNSQuery(randomLabel()+"."+name, qtype))
+		if err == nil {
+			m.DNSTimeCold = F64(durationMs(cold.query))
+		}
+	}
+
+	return m, nil
+}
+
+// newDNSQuery builds a recursive query for name.
+func newDNSQuery(name string, qtype uint16) *dns.Msg {
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, qtype)
+	msg.RecursionDesired = true
+	return msg
+}
+
+// queryTypeName normalises a configured record type, defaulting to A.
+func queryTypeName(t string) string {
+	if t == "" {
+		return "A"
+	}
+	return strings.ToUpper(t)
 }
 
 func getSystemDNS() (string, error) {
@@ -0,0 +1,146 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// checkDNSSEC queries each signed zone's SOA and DNSKEY records with the DO
+// bit set. DNSSECAD is true only if the resolver set AD on every answer and
+// DNSSECValid only if every RRSIG verified. A failed query counts against
+// both, since the resolver just answered the plain timing queries and CPEs
+// that mishandle DNSSEC commonly drop or mangle DO queries.
+func (p *DNSProbe) checkDNSSEC(ctx context.Context, spec resolverSpec, r *Measurement) {
+	allAD, allValid := true, true
+	for _, zone := range p.opts.DNSSECZones {
+		zoneCtx, cancel := context.WithTimeout(ctx, 2*p.timeout)
+		ad, valid, err := p.validateZone(zoneCtx, spec, dns.Fqdn(zone))
+		cancel()
+		if err != nil {
+			ad, valid = false, false
+		}
+		allAD = allAD && ad
+		allValid = allValid && valid
+	}
+	r.DNSSECAD = Bool(allAD)
+	r.DNSSECValid = Bool(allValid)
+}
+
+// validateZone checks that zone's SOA RRset is signed by one of its
+// DNSKEYs and that the DNSKEY RRset is self-signed. This proves the
+// signatures survived the path intact; the chain of trust to the root is
+// left to the resolver and reported through the AD flag.
+func (p *DNSProbe) validateZone(ctx context.Context, spec resolverSpec, zone string) (ad, valid bool, err error) {
+	soa, err := p.exchangeComplete(ctx, spec, newDNSSECQuery(zone, dns.TypeSOA))
+	if err != nil {
+		return false, false, fmt.Errorf("SOA query: %w", err)
+	}
+	if soa.Rcode != dns.RcodeSuccess {
+		return false, false, fmt.Errorf("SOA query returned %s", dns.RcodeToString[soa.Rcode])
+	}
+
+	keys, err := p.exchangeComplete(ctx, spec, newDNSSECQuery(zone, dns.TypeDNSKEY))
+	if err != nil {
+		return false, false, fmt.Errorf("DNSKEY query: %w", err)
+	}
+
+	now := time.Now()
+	ad = soa.AuthenticatedData && keys.AuthenticatedData
+	valid = verifyRRSIG(soa.Answer, dns.TypeSOA, keys.Answer, now) &&
+		verifyRRSIG(keys.Answer, dns.TypeDNSKEY, keys.Answer, now)
+	return ad, valid, nil
+}
+
+// verifyRRSIG reports whether answer holds an RRset of type qtype with at
+// least one current RRSIG that verifies against a key in keyRRs.
+func verifyRRSIG(answer []dns.RR, qtype uint16, keyRRs []dns.RR, now time.Time) bool {
+	var rrset []dns.RR
+	var sigs []*dns.RRSIG
+	for _, rr := range answer {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			if sig.TypeCovered == qtype {
+				sigs = append(sigs, sig)
+			}
+			continue
+		}
+		if rr.Header().Rrtype == qtype {
+			rrset = append(rrset, rr)
+		}
+	}
+	if len(rrset) == 0 {
+		return false
+	}
+
+	for _, sig := range sigs {
+		if !sig.ValidityPeriod(now) {
+			continue
+		}
+		for _, rr := range keyRRs {
+			key, ok := rr.(*dns.DNSKEY)
+			if !ok || key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm {
+				continue
+			}
+			if sig.Verify(key, rrset) == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkLargeResponse asks for LargeResponseName's TXT records twice over
+// UDP. With EDNS0 the answer should arrive whole in one large, often
+// fragmented, datagram; CPEs that drop fragments or strip OPT records fail
+// that. Without EDNS0 it cannot fit in 512 bytes, so a healthy resolver
+// truncates it and the client retries over TCP, which is timed end to end.
+func (p *DNSProbe) checkLargeResponse(ctx context.Context, spec resolverSpec, r *Measurement) {
+	ctx, cancel := context.WithTimeout(ctx, 3*p.timeout)
+	defer cancel()
+
+	name := dns.Fqdn(p.opts.LargeResponseName)
+
+	msg := newDNSQuery(name, dns.TypeTXT)
+	msg.SetEdns0(dns.DefaultMsgSize, false)
+	resp, _, err := p.exchangeUDP(ctx, spec, msg)
+	r.DNSLargeResponseOK = Bool(err == nil && resp.Rcode == dns.RcodeSuccess && !resp.Truncated && len(resp.Answer) > 0)
+
+	msg = newDNSQuery(name, dns.TypeTXT)
+	start := time.Now()
+	resp, _, err = p.exchangeUDP(ctx, spec, msg)
+	if err != nil || !resp.Truncated {
+		return
+	}
+	if _, _, err := p.exchangeTCP(ctx, spec, msg); err != nil {
+		r.DNSTCPFallbackOK = Bool(false)
+		return
+	}
+	r.DNSTCPFallbackOK = Bool(true)
+	r.DNSTCPFallbackTime = F64(durationMs(time.Since(start)))
+}
+
+// exchangeComplete sends msg over spec's transport and, for plain UDP,
+// retries over TCP when the answer comes back truncated.
+func (p *DNSProbe) exchangeComplete(ctx context.Context, spec resolverSpec, msg *dns.Msg) (*dns.Msg, error) {
+	resp, _, err := p.exchange(ctx, spec, msg)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Truncated && spec.protocol == dnsProtocolUDP {
+		resp, _, err = p.exchangeTCP(ctx, spec, msg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// newDNSSECQuery builds a recursive query with the DO bit set, asking the
+// resolver to return signatures and validate.
+func newDNSSECQuery(name string, qtype uint16) *dns.Msg {
+	msg := newDNSQuery(name, qtype)
+	msg.SetEdns0(dns.DefaultMsgSize, true)
+	return msg
+}
@@ -0,0 +1,186 @@
+package probe
+
+import (
+	"context"
+	"crypto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// signedZone is a zone with one key, its SOA and DNSKEY RRsets and their
+// signatures.
+type signedZone struct {
+	key     *dns.DNSKEY
+	soa     *dns.SOA
+	soaSig  *dns.RRSIG
+	keySig  *dns.RRSIG
+	private crypto.Signer
+}
+
+func newSignedZone(t *testing.T, zone string, expiration time.Time) *signedZone {
+	t.Helper()
+	z := &signedZone{
+		key: &dns.DNSKEY{
+			Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+			Flags:     257,
+			Protocol:  3,
+			Algorithm: dns.ECDSAP256SHA256,
+		},
+		soa: &dns.SOA{
+			Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600},
+			Ns:      "ns." + zone,
+			Mbox:    "hostmaster." + zone,
+			Serial:  1,
+			Refresh: 3600, Retry: 600, Expire: 86400, Minttl: 300,
+		},
+	}
+	private, err := z.key.Generate(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z.private = private.(crypto.Signer)
+	z.soaSig = z.sign(t, zone, expiration, z.soa)
+	z.keySig = z.sign(t, zone, expiration, z.key)
+	return z
+}
+
+func (z *signedZone) sign(t *testing.T, zone string, expiration time.Time, rr dns.RR) *dns.RRSIG {
+	t.Helper()
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Ttl: 3600},
+		Algorithm:  z.key.Algorithm,
+		Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+		Expiration: uint32(expiration.Unix()),
+		KeyTag:     z.key.KeyTag(),
+		SignerName: zone,
+	}
+	if err := sig.Sign(z.private, []dns.RR{rr}); err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func TestCheckDNSSEC(t *testing.T) {
+	const zone = "example."
+	valid := newSignedZone(t, zone, time.Now().Add(24*time.Hour))
+	expired := newSignedZone(t, zone, time.Now().Add(-time.Minute))
+	tampered := newSignedZone(t, zone, time.Now().Add(24*time.Hour))
+	tamperedSOA := *tampered.soa
+	tamperedSOA.Serial = 2
+
+	tests := []struct {
+		name      string
+		zone      *signedZone
+		soa       dns.RR
+		setAD     bool
+		stripSigs bool
+		rcode     int
+		wantAD    bool
+		wantValid bool
+	}{
+		{name: "validating resolver", zone: valid, setAD: true, wantAD: true, wantValid: true},
+		{name: "non-validating forwarder", zone: valid, wantValid: true},
+		{name: "signatures stripped", zone: valid, setAD: true, stripSigs: true, wantAD: true},
+		{name: "altered on the path", zone: tampered, soa: &tamperedSOA, setAD: true, wantAD: true},
+		{name: "expired signatures", zone: expired, setAD: true, wantAD: true},
+		{name: "DO queries refused", zone: valid, rcode: dns.RcodeServerFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			soa := tt.soa
+			if soa == nil {
+				soa = tt.zone.soa
+			}
+			addr := startDNSServer(t, func(w dns.ResponseWriter, q *dns.Msg) {
+				resp := new(dns.Msg)
+				resp.SetReply(q)
+				resp.Rcode = tt.rcode
+				if tt.rcode == dns.RcodeSuccess {
+					switch q.Question[0].Qtype {
+					case dns.TypeSOA:
+						resp.Answer = []dns.RR{soa, tt.zone.soaSig}
+					case dns.TypeDNSKEY:
+						resp.Answer = []dns.RR{tt.zone.key, tt.zone.keySig}
+					}
+					if tt.stripSigs {
+						resp.Answer = resp.Answer[:1]
+					}
+					opt := q.IsEdns0()
+					resp.AuthenticatedData = tt.setAD && opt != nil && opt.Do()
+				}
+				w.WriteMsg(resp)
+			}, true)
+
+			p := NewDNSProbe(nil, DNSOptions{DNSSECZones: []string{"example"}})
+			var r Measurement
+			p.checkDNSSEC(context.Background(), udpSpec(addr), &r)
+			if *r.DNSSECAD != tt.wantAD || *r.DNSSECValid != tt.wantValid {
+				t.Errorf("AD %v valid %v, want %v and %v", *r.DNSSECAD, *r.DNSSECValid, tt.wantAD, tt.wantValid)
+			}
+		})
+	}
+}
+
+func TestCheckLargeResponse(t *testing.T) {
+	const name = "large.example."
+	// Twenty 60-byte strings cannot fit in a 512-byte datagram.
+	txt := &dns.TXT{
+		Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300},
+		Txt: strings.Split(strings.Repeat(strings.Repeat("x", 60)+" ", 20), " ")[:20],
+	}
+
+	tests := []struct {
+		name         string
+		tcp          bool
+		stripEDNS    bool
+		dropLargeUDP bool
+		wantLargeOK  bool
+		wantFallback *bool
+	}{
+		{name: "healthy path", tcp: true, wantLargeOK: true, wantFallback: Bool(true)},
+		{name: "EDNS stripped", tcp: true, stripEDNS: true, wantFallback: Bool(true)},
+		{name: "fragments dropped", tcp: true, dropLargeUDP: true, wantFallback: Bool(true)},
+		{name: "TCP blocked", wantLargeOK: true, wantFallback: Bool(false)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := startDNSServer(t, func(w dns.ResponseWriter, q *dns.Msg) {
+				resp := new(dns.Msg)
+				resp.SetReply(q)
+				resp.Answer = []dns.RR{txt}
+
+				if w.RemoteAddr().Network() == "udp" {
+					opt := q.IsEdns0()
+					switch {
+					case opt != nil && tt.dropLargeUDP:
+						return
+					case opt == nil || tt.stripEDNS || int(opt.UDPSize()) < resp.Len():
+						resp.Answer = nil
+						resp.Truncated = true
+					}
+				}
+				w.WriteMsg(resp)
+			}, tt.tcp)
+
+			p := NewDNSProbe(nil, DNSOptions{LargeResponseName: "large.example"})
+			p.timeout = 200 * time.Millisecond
+			var r Measurement
+			p.checkLargeResponse(context.Background(), udpSpec(addr), &r)
+
+			if *r.DNSLargeResponseOK != tt.wantLargeOK {
+				t.Errorf("large response OK = %v, want %v", *r.DNSLargeResponseOK, tt.wantLargeOK)
+			}
+			if !equalBool(r.DNSTCPFallbackOK, tt.wantFallback) {
+				t.Errorf("TCP fallback OK = %v, want %v", deref(r.DNSTCPFallbackOK), deref(tt.wantFallback))
+			}
+			if (r.DNSTCPFallbackTime != nil) != (tt.wantFallback != nil && *tt.wantFallback) {
+				t.Errorf("TCP fallback time = %v", deref(r.DNSTCPFallbackTime))
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package probe
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// recordAnswer copies the parts of a response that show whether it can be
+// trusted: rcode, answer count, lowest TTL and the address set.
+func recordAnswer(m *Measurement, resp *dns.Msg) {
+	m.DNSRcode = dns.RcodeToString[resp.Rcode]
+	m.DNSAnswerCount = Int(len(resp.Answer))
+
+	if len(resp.Answer) > 0 {
+		minTTL := resp.Answer[0].Header().Ttl
+		for _, rr := range resp.Answer[1:] {
+			if ttl := rr.Header().Ttl; ttl < minTTL {
+				minTTL = ttl
+			}
+		}
+		m.DNSMinTTL = Int(int(minTTL))
+	}
+
+	m.DNSAnswers = strings.Join(answerAddrs(resp), ",")
+}
+
+// answerAddrs returns the sorted A and AAAA addresses in resp.
+func answerAddrs(resp *dns.Msg) []string {
+	var addrs []string
+	for _, rr := range resp.Answer {
+		switch rec := rr.(type) {
+		case *dns.A:
+			addrs = append(addrs, rec.A.String())
+		case *dns.AAAA:
+			addrs = append(addrs, rec.AAAA.String())
+		}
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// markAnswerMismatches flags measurements whose answers disagree. With an
+// expected set, any address outside it is a mismatch. Otherwise answers
+// are compared with the most common answer set across resolvers; sets
+// that share no address with it are flagged, which tolerates CDNs handing
+// out different subsets of the same pool.
+func markAnswerMismatches(ms []Measurement, expected []string) {
+	if len(expected) > 0 {
+		want := make(map[string]bool, len(expected))
+		for _, addr := range expected {
+			want[addr] = true
+		}
+		for i := range ms {
+			if ms[i].DNSAnswers == "" {
+				continue
+			}
+			mismatch := false
+			for _, addr := range strings.Split(ms[i].DNSAnswers, ",") {
+				if !want[addr] {
+					mismatch = true
+					break
+				}
+			}
+			ms[i].DNSMismatch = Bool(mismatch)
+		}
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, m := range ms {
+		if m.DNSAnswers != "" {
+			counts[m.DNSAnswers]++
+		}
+	}
+	// Two resolvers disagreeing gives no majority to judge against.
+	if len(ms) < 3 || len(counts) == 0 {
+		return
+	}
+
+	consensus, best := "", 0
+	for answers, n := range counts {
+		if n > best || (n == best && answers < consensus) {
+			consensus, best = answers, n
+		}
+	}
+
+	common := make(map[string]bool)
+	for _, addr := range strings.Split(consensus, ",") {
+		common[addr] = true
+	}
+
+	for i := range ms {
+		if ms[i].DNSAnswers == "" {
+			continue
+		}
+		overlap := false
+		for _, addr := range strings.Split(ms[i].DNSAnswers, ",") {
+			if common[addr] {
+				overlap = true
+				break
+			}
+		}
+		ms[i].DNSMismatch = Bool(!overlap)
+	}
+}
+
+// runResolverChecks runs the checks that describe the resolver rather than
+// a single query and copies their results onto every measurement from it.
+func (p *DNSProbe) runResolverChecks(ctx context.Context, spec resolverSpec, ms []Measurement) {
+	var r Measurement
+
+	if p.opts.NXDomainCheck {
+		nxCtx, cancel := context.WithTimeout(ctx, p.timeout)
+		redirected, err := p.checkNXDomain(nxCtx, spec)
+		cancel()
+		if err == nil {
+			r.NXDomainRedirect = Bool(redirected)
+		}
+	}
+
+	if len(p.opts.DNSSECZones) > 0 {
+		p.checkDNSSEC(ctx, spec, &r)
+	}
+
+	// Truncation and fragmentation only affect plain UDP.
+	if p.opts.LargeResponseName != "" && spec.protocol == dnsProtocolUDP {
+		p.checkLargeResponse(ctx, spec, &r)
+	}
+
+	for i := range ms {
+		ms[i].NXDomainRedirect = r.NXDomainRedirect
+		ms[i].DNSSECAD = r.DNSSECAD
+		ms[i].DNSSECValid = r.DNSSECValid
+		ms[i].DNSLargeResponseOK = r.DNSLargeResponseOK
+		ms[i].DNSTCPFallbackOK = r.DNSTCPFallbackOK
+		ms[i].DNSTCPFallbackTime = r.DNSTCPFallbackTime
+	}
+}
+
+// checkNXDomain asks the resolver for a random name that cannot exist. A
+// resolver that returns addresses for it is rewriting NXDOMAIN.
+func (p *DNSProbe) checkNXDomain(ctx context.Context, spec resolverSpec) (bool, error) {
+	resp, _, err := p.exchange(ctx, spec, newDNSQuery(dns.Fqdn(randomLabel()+".com"), dns.TypeA))
+	if err != nil {
+		return false, err
+	}
+
+	return resp.Rcode == dns.RcodeSuccess && len(answerAddrs(resp)) > 0, nil
+}
+
+// checkInterception sends a query to the canary address, which runs no DNS
+// server. A timeout is the expected outcome; any reply means something on
+// the path answered on the canary's behalf.
+func (p *DNSProbe) checkInterception(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	spec := resolverSpec{
+		protocol: dnsProtocolUDP,
+		addr:     withDefaultPort(p.opts.InterceptionCanary, "53"),
+	}
+
+	resp, _, err := p.exchange(ctx, spec, newDNSQuery(dns.Fqdn(p.opts.Queries[0].Name), dns.TypeA))
+	return err == nil && resp != nil
+}
+
+// randomLabel returns a DNS label that will not exist in any zone.
+func randomLabel() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "np-" + hex.EncodeToString(b)
+}
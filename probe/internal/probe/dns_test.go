@@ -0,0 +1,246 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startDNSServer serves handler on a loopback UDP port and, with tcp, on
+// the same TCP port, returning the address.
+func startDNSServer(t *testing.T, handler dns.HandlerFunc, tcp bool) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers := []*dns.Server{{PacketConn: pc, Handler: handler}}
+	if tcp {
+		ln, err := net.Listen("tcp", pc.LocalAddr().String())
+		if err != nil {
+			pc.Close()
+			t.Skipf("TCP port of %s is taken: %v", pc.LocalAddr(), err)
+		}
+		servers = append(servers, &dns.Server{Listener: ln, Handler: handler})
+	}
+
+	for _, srv := range servers {
+		started := make(chan struct{})
+		srv.NotifyStartedFunc = func() { close(started) }
+		go srv.ActivateAndServe()
+		<-started
+		t.Cleanup(func() { srv.Shutdown() })
+	}
+	return pc.LocalAddr().String()
+}
+
+// udpSpec is a plain UDP resolver at addr.
+func udpSpec(addr string) resolverSpec {
+	return resolverSpec{protocol: dnsProtocolUDP, addr: addr, target: addr}
+}
+
+func equalBool(a, b *bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func TestRecordAnswer(t *testing.T) {
+	q := newDNSQuery("example.com.", dns.TypeA)
+	resp := answerA(q, "192.0.2.2", "192.0.2.1")
+	resp.Answer[1].Header().Ttl = 60
+
+	var m Measurement
+	recordAnswer(&m, resp)
+	if m.DNSRcode != "NOERROR" || *m.DNSAnswerCount != 2 || *m.DNSMinTTL != 60 || m.DNSAnswers != "192.0.2.1,192.0.2.2" {
+		t.Errorf("got rcode %q count %d min TTL %d answers %q",
+			m.DNSRcode, *m.DNSAnswerCount, *m.DNSMinTTL, m.DNSAnswers)
+	}
+}
+
+func TestMarkAnswerMismatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		answers  []string
+		expected []string
+		want     []*bool
+	}{
+		{
+			name:     "expected set",
+			answers:  []string{"192.0.2.1", "192.0.2.1,198.51.100.9", ""},
+			expected: []string{"192.0.2.1", "192.0.2.2"},
+			want:     []*bool{Bool(false), Bool(true), nil},
+		},
+		{
+			name:    "odd one out",
+			answers: []string{"192.0.2.1", "192.0.2.1", "198.51.100.9"},
+			want:    []*bool{Bool(false), Bool(false), Bool(true)},
+		},
+		{
+			name:    "CDN subsets overlap",
+			answers: []string{"192.0.2.1,192.0.2.2", "192.0.2.1,192.0.2.2", "192.0.2.2,192.0.2.3"},
+			want:    []*bool{Bool(false), Bool(false), Bool(false)},
+		},
+		{
+			name:    "two resolvers have no majority",
+			answers: []string{"192.0.2.1", "198.51.100.9"},
+			want:    []*bool{nil, nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := make([]Measurement, len(tt.answers))
+			for i, answers := range tt.answers {
+				ms[i].DNSAnswers = answers
+			}
+			markAnswerMismatches(ms, tt.expected)
+			for i, m := range ms {
+				if !equalBool(m.DNSMismatch, tt.want[i]) {
+					t.Errorf("%q: mismatch = %v, want %v", tt.answers[i], deref(m.DNSMismatch), deref(tt.want[i]))
+				}
+			}
+		})
+	}
+}
+
+func TestCheckNXDomain(t *testing.T) {
+	tests := []struct {
+		name     string
+		redirect bool
+	}{
+		{name: "honest resolver"},
+		{name: "redirecting resolver", redirect: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := startDNSServer(t, func(w dns.ResponseWriter, q *dns.Msg) {
+				resp := answerA(q)
+				if tt.redirect {
+					resp = answerA(q, "198.51.100.80")
+				} else {
+					resp.Rcode = dns.RcodeNameError
+				}
+				w.WriteMsg(resp)
+			}, false)
+
+			p := NewDNSProbe(nil, DNSOptions{})
+			redirected, err := p.checkNXDomain(context.Background(), udpSpec(addr))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if redirected != tt.redirect {
+				t.Errorf("redirected = %v, want %v", redirected, tt.redirect)
+			}
+		})
+	}
+}
+
+func TestCheckInterception(t *testing.T) {
+	// Something answering on the canary address is intercepting port 53.
+	interceptor := startDNSServer(t, func(w dns.ResponseWriter, q *dns.Msg) {
+		w.WriteMsg(answerA(q, "192.0.2.1"))
+	}, false)
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	for canary, want := range map[string]bool{interceptor: true, silent.LocalAddr().String(): false} {
+		p := NewDNSProbe(nil, DNSOptions{InterceptionCanary: canary})
+		p.timeout = 200 * time.Millisecond
+		if got := p.checkInterception(context.Background()); got != want {
+			t.Errorf("canary %s: intercepted = %v, want %v", canary, got, want)
+		}
+	}
+}
+
+func TestDNSProbeRunFlagsOddResolver(t *testing.T) {
+	honest := func(w dns.ResponseWriter, q *dns.Msg) { w.WriteMsg(answerA(q, "192.0.2.1")) }
+	resolvers := []string{
+		startDNSServer(t, honest, false),
+		startDNSServer(t, honest, false),
+		startDNSServer(t, func(w dns.ResponseWriter, q *dns.Msg) { w.WriteMsg(answerA(q, "198.51.100.80")) }, false),
+	}
+
+	ms, err := NewDNSProbe(resolvers, DNSOptions{}).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 3 {
+		t.Fatalf("got %d measurements, want 3", len(ms))
+	}
+	for _, m := range ms {
+		want := m.Target == resolvers[2]
+		if m.DNSMismatch == nil || *m.DNSMismatch != want {
+			t.Errorf("%s answered %s: mismatch = %v, want %v", m.Target, m.DNSAnswers, deref(m.DNSMismatch), want)
+		}
+	}
+}
+
+func TestRunQueryCacheBust(t *testing.T) {
+	var mu sync.Mutex
+	asked := make(map[string]int)
+	addr := startDNSServer(t, func(w dns.ResponseWriter, q *dns.Msg) {
+		name := q.Question[0].Name
+		mu.Lock()
+		asked[name]++
+		mu.Unlock()
+
+		// Random labels do not exist, like under any real zone.
+		resp := answerA(q, "192.0.2.1")
+		if name != "example.com." {
+			resp = answerA(q)
+			resp.Rcode = dns.RcodeNameError
+		}
+		w.WriteMsg(resp)
+	}, false)
+
+	tests := []struct {
+		cacheBust bool
+		wantWarm  int
+		wantCold  int
+	}{
+		{cacheBust: false, wantWarm: 1},
+		// The first warm query primes the cache and is not timed.
+		{cacheBust: true, wantWarm: 2, wantCold: 1},
+	}
+
+	for _, tt := range tests {
+		mu.Lock()
+		clear(asked)
+		mu.Unlock()
+		p := NewDNSProbe(nil, DNSOptions{CacheBust: tt.cacheBust})
+		m, err := p.runQuery(context.Background(), udpSpec(addr), DNSQuery{Name: "example.com", Type: "A"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mu.Lock()
+		warm, cold := asked["example.com."], 0
+		for name, n := range asked {
+			if strings.HasPrefix(name, "np-") && strings.HasSuffix(name, ".example.com.") {
+				cold += n
+			}
+		}
+		mu.Unlock()
+		if warm != tt.wantWarm || cold != tt.wantCold {
+			t.Errorf("cache bust %v: asked %d warm and %d cold queries, want %d and %d",
+				tt.cacheBust, warm, cold, tt.wantWarm, tt.wantCold)
+		}
+		if (m.DNSTimeCold != nil) != tt.cacheBust {
+			t.Errorf("cache bust %v: cold time %v", tt.cacheBust, deref(m.DNSTimeCold))
+		}
+		if m.DNSAnswers != "192.0.2.1" {
+			t.Errorf("cache bust %v: answers %q are not the warm query's", tt.cacheBust, m.DNSAnswers)
+		}
+	}
+}
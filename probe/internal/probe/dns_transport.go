@@ -0,0 +1,364 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// DNS transport protocols, recorded in Measurement.Protocol.
+const (
+	dnsProtocolUDP = "udp"
+	dnsProtocolDoT = "dot"
+	dnsProtocolDoH = "doh"
+	dnsProtocolDoQ = "doq"
+)
+
+// resolverSpec describes how to reach a configured resolver.
+type resolverSpec struct {
+	protocol string
+	// addr is host:port, or the endpoint URL for DoH.
+	addr string
+	// serverName is the TLS server name for encrypted transports.
+	serverName string
+	// target is the label stored in Measurement.Target.
+	target string
+	// family pins connections to "ipv4" or "ipv6"; empty lets the
+	// system choose.
+	family string
+}
+
+// host returns the resolver's address or hostname without a port.
+func (s resolverSpec) host() string {
+	if s.protocol == dnsProtocolDoH {
+		if u, err := url.Parse(s.addr); err == nil {
+			return u.Hostname()
+		}
+	}
+	host, _, err := net.SplitHostPort(s.addr)
+	if err != nil {
+		return s.addr
+	}
+	return host
+}
+
+// network restricts base ("udp" or "tcp") to the spec's IP family.
+func (s resolverSpec) network(base string) string {
+	switch s.family {
+	case FamilyIPv4:
+		return base + "4"
+	case FamilyIPv6:
+		return base + "6"
+	}
+	return base
+}
+
+// parseResolver turns a targets.dns entry into a resolverSpec. Entries are
+// "system", a plain address for UDP, or a URI: udp://, tls:// (DoT),
+// https:// (DoH) or quic:// (DoQ).
+func parseResolver(resolver string) (resolverSpec, error) {
+	if resolver == "system" {
+		systemDNS, err := getSystemDNS()
+		if err != nil {
+			return resolverSpec{}, fmt.Errorf("failed to get system DNS: %w", err)
+		}
+		return resolverSpec{
+			protocol: dnsProtocolUDP,
+			addr:     net.JoinHostPort(systemDNS, "53"),
+			target:   fmt.Sprintf("system-%s", systemDNS),
+			family:   ipFamily(net.ParseIP(systemDNS)),
+		}, nil
+	}
+
+	if !strings.Contains(resolver, "://") {
+		spec := resolverSpec{
+			protocol: dnsProtocolUDP,
+			addr:     withDefaultPort(resolver, "53"),
+			target:   resolver,
+		}
+		spec.family = ipFamily(net.ParseIP(spec.host()))
+		return spec, nil
+	}
+
+	u, err := url.Parse(resolver)
+	if err != nil {
+		return resolverSpec{}, fmt.Errorf("invalid resolver URI: %w", err)
+	}
+
+	spec := resolverSpec{
+		serverName: u.Hostname(),
+		target:     resolver,
+	}
+
+	switch u.Scheme {
+	case "udp":
+		spec.protocol = dnsProtocolUDP
+		spec.addr = withDefaultPort(u.Host, "53")
+	case "tls":
+		spec.protocol = dnsProtocolDoT
+		spec.addr = withDefaultPort(u.Host, "853")
+	case "https":
+		spec.protocol = dnsProtocolDoH
+		spec.addr = resolver
+	case "quic":
+		spec.protocol = dnsProtocolDoQ
+		spec.addr = withDefaultPort(u.Host, "853")
+	default:
+		return resolverSpec{}, fmt.Errorf("unsupported resolver scheme %q", u.Scheme)
+	}
+	spec.family = ipFamily(net.ParseIP(spec.host()))
+
+	return spec, nil
+}
+
+// withDefaultPort appends port to host unless it already carries one.
+func withDefaultPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
+// dnsTiming splits a query into connection setup and the query itself so
+// encrypted transports can be compared with plain UDP.
+type dnsTiming struct {
+	connect   time.Duration
+	handshake time.Duration
+	query     time.Duration
+}
+
+// exchange sends msg over the transport described by spec. Every call
+// opens a fresh connection so handshake costs are measured each run.
+func (p *DNSProbe) exchange(ctx context.Context, spec resolverSpec, msg *dns.Msg) (*dns.Msg, dnsTiming, error) {
+	switch spec.protocol {
+	case dnsProtocolDoT:
+		return p.exchangeDoT(ctx, spec, msg)
+	case dnsProtocolDoH:
+		return p.exchangeDoH(ctx, spec, msg)
+	case dnsProtocolDoQ:
+		return p.exchangeDoQ(ctx, spec, msg)
+	default:
+		return p.exchangeUDP(ctx, spec, msg)
+	}
+}
+
+func (p *DNSProbe) exchangeUDP(ctx context.Context, spec resolverSpec, msg *dns.Msg) (*dns.Msg, dnsTiming, error) {
+	return p.exchangePlain(ctx, "udp", spec, msg)
+}
+
+// exchangeTCP sends msg over plain TCP port 53, as clients do when a UDP
+// answer comes back truncated.
+func (p *DNSProbe) exchangeTCP(ctx context.Context, spec resolverSpec, msg *dns.Msg) (*dns.Msg, dnsTiming, error) {
+	return p.exchangePlain(ctx, "tcp", spec, msg)
+}
+
+func (p *DNSProbe) exchangePlain(ctx context.Context, network string, spec resolverSpec, msg *dns.Msg) (*dns.Msg, dnsTiming, error) {
+	client := &dns.Client{
+		Net:     spec.network(network),
+		Timeout: p.timeout,
+	}
+
+	start := time.Now()
+	resp, _, err := client.ExchangeContext(ctx, msg, spec.addr)
+	timing := dnsTiming{query: time.Since(start)}
+	if err != nil {
+		return nil, timing, err
+	}
+	return resp, timing, nil
+}
+
+func (p *DNSProbe) exchangeDoT(ctx context.Context, spec resolverSpec, msg *dns.Msg) (*dns.Msg, dnsTiming, error) {
+	var timing dnsTiming
+	dialer := &net.Dialer{Timeout: p.timeout}
+
+	start := time.Now()
+	raw, err := dialer.DialContext(ctx, spec.network("tcp"), spec.addr)
+	if err != nil {
+		return nil, timing, fmt.Errorf("connect: %w", err)
+	}
+	timing.connect = time.Since(start)
+
+	tlsConn := tls.Client(raw, p.tlsConfig(spec.serverName, "dot"))
+	defer tlsConn.Close()
+
+	start = time.Now()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, timing, fmt.Errorf("TLS handshake: %w", err)
+	}
+	timing.handshake = time.Since(start)
+
+	client := &dns.Client{
+		Net:     "tcp-tls",
+		Timeout: p.timeout,
+	}
+
+	start = time.Now()
+	resp, _, err := client.ExchangeWithConnContext(ctx, msg, &dns.Conn{Conn: tlsConn})
+	timing.query = time.Since(start)
+	if err != nil {
+		return nil, timing, err
+	}
+	return resp, timing, nil
+}
+
+func (p *DNSProbe) exchangeDoH(ctx context.Context, spec resolverSpec, msg *dns.Msg) (*dns.Msg, dnsTiming, error) {
+	var timing dnsTiming
+
+	// RFC 8484 asks for ID 0 so responses are cache friendly.
+	query := msg.Copy()
+	query.Id = 0
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, timing, fmt.Errorf("pack query: %w", err)
+	}
+
+	timings := &httpTimings{}
+	ctx = httptrace.WithClientTrace(ctx, timings.trace())
+
+	req, err := http.NewRequestWithContext(ctx, "POST", spec.addr, bytes.NewReader(packed))
+	if err != nil {
+		return nil, timing, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	dialer := &net.Dialer{Timeout: p.timeout}
+	client := &http.Client{
+		Timeout: p.timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, spec.network("tcp"), addr)
+			},
+			DisableKeepAlives: true,
+			ForceAttemptHTTP2: true,
+			TLSClientConfig:   p.tlsConfig(spec.serverName),
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, timing, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, timing, fmt.Errorf("read response: %w", err)
+	}
+	done := time.Now()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, timing, fmt.Errorf("server returned status %d", resp.StatusCode)
+	}
+
+	timings.mu.Lock()
+	if !timings.connectStart.IsZero() && !timings.connectDone.IsZero() {
+		timing.connect = timings.connectDone.Sub(timings.connectStart)
+	}
+	if !timings.tlsStart.IsZero() && !timings.tlsDone.IsZero() {
+		timing.handshake = timings.tlsDone.Sub(timings.tlsStart)
+	}
+	if !timings.gotConn.IsZero() {
+		timing.query = done.Sub(timings.gotConn)
+	}
+	timings.mu.Unlock()
+
+	reply := new(dns.Msg)
+	if err := reply.Unpack(body); err != nil {
+		return nil, timing, fmt.Errorf("unpack response: %w", err)
+	}
+	reply.Id = msg.Id
+
+	return reply, timing, nil
+}
+
+func (p *DNSProbe) exchangeDoQ(ctx context.Context, spec resolverSpec, msg *dns.Msg) (*dns.Msg, dnsTiming, error) {
+	var timing dnsTiming
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	// Resolving and binding ourselves, rather than quic.DialAddr, lets the
+	// spec pin the IP family.
+	raddr, err := net.ResolveUDPAddr(spec.network("udp"), spec.addr)
+	if err != nil {
+		return nil, timing, fmt.Errorf("resolve: %w", err)
+	}
+	udpConn, err := net.ListenUDP(spec.network("udp"), nil)
+	if err != nil {
+		return nil, timing, fmt.Errorf("listen: %w", err)
+	}
+	defer udpConn.Close()
+
+	// QUIC folds the transport and TLS handshakes together, so the whole
+	// dial counts as handshake.
+	start := time.Now()
+	conn, err := quic.Dial(ctx, udpConn, raddr, p.tlsConfig(spec.serverName, "doq"), nil)
+	if err != nil {
+		return nil, timing, fmt.Errorf("QUIC handshake: %w", err)
+	}
+	defer conn.CloseWithError(0, "")
+	timing.handshake = time.Since(start)
+
+	// RFC 9250: ID 0, one query per stream, two-byte length prefix.
+	query := msg.Copy()
+	query.Id = 0
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, timing, fmt.Errorf("pack query: %w", err)
+	}
+
+	start = time.Now()
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, timing, fmt.Errorf("open stream: %w", err)
+	}
+
+	frame := make([]byte, 2+len(packed))
+	binary.BigEndian.PutUint16(frame, uint16(len(packed)))
+	copy(frame[2:], packed)
+	if _, err := stream.Write(frame); err != nil {
+		return nil, timing, fmt.Errorf("write query: %w", err)
+	}
+	// Closing the send side tells the server the query is complete.
+	stream.Close()
+
+	var length [2]byte
+	if _, err := io.ReadFull(stream, length[:]); err != nil {
+		return nil, timing, fmt.Errorf("read response length: %w", err)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(stream, body); err != nil {
+		return nil, timing, fmt.Errorf("read response: %w", err)
+	}
+	timing.query = time.Since(start)
+
+	reply := new(dns.Msg)
+	if err := reply.Unpack(body); err != nil {
+		return nil, timing, fmt.Errorf("unpack response: %w", err)
+	}
+	reply.Id = msg.Id
+
+	return reply, timing, nil
+}
+
+// tlsConfig returns the TLS settings for an encrypted resolver connection.
+func (p *DNSProbe) tlsConfig(serverName string, alpn ...string) *tls.Config {
+	return &tls.Config{
+		ServerName: serverName,
+		NextProtos: alpn,
+		MinVersion: tls.VersionTLS12,
+	}
+}
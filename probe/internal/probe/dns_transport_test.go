@@ -0,0 +1,142 @@
+package probe
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// answerA replies to q with an A record for each of addrs.
+func answerA(q *dns.Msg, addrs ...string) *dns.Msg {
+	resp := new(dns.Msg)
+	resp.SetReply(q)
+	for _, addr := range addrs {
+		resp.Answer = append(resp.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: q.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+			A:   net.ParseIP(addr),
+		})
+	}
+	return resp
+}
+
+func TestParseResolver(t *testing.T) {
+	tests := []struct {
+		resolver string
+		want     resolverSpec
+		wantErr  bool
+	}{
+		{
+			resolver: "1.1.1.1",
+			want:     resolverSpec{protocol: dnsProtocolUDP, addr: "1.1.1.1:53", target: "1.1.1.1", family: FamilyIPv4},
+		},
+		{
+			resolver: "2606:4700:4700::1111",
+			want:     resolverSpec{protocol: dnsProtocolUDP, addr: "[2606:4700:4700::1111]:53", target: "2606:4700:4700::1111", family: FamilyIPv6},
+		},
+		{
+			resolver: "udp://9.9.9.9:5353",
+			want:     resolverSpec{protocol: dnsProtocolUDP, addr: "9.9.9.9:5353", serverName: "9.9.9.9", target: "udp://9.9.9.9:5353", family: FamilyIPv4},
+		},
+		{
+			resolver: "tls://dns.quad9.net",
+			want:     resolverSpec{protocol: dnsProtocolDoT, addr: "dns.quad9.net:853", serverName: "dns.quad9.net", target: "tls://dns.quad9.net"},
+		},
+		{
+			resolver: "https://cloudflare-dns.com/dns-query",
+			want:     resolverSpec{protocol: dnsProtocolDoH, addr: "https://cloudflare-dns.com/dns-query", serverName: "cloudflare-dns.com", target: "https://cloudflare-dns.com/dns-query"},
+		},
+		{
+			resolver: "quic://[2a10:50c0::ad1:ff]",
+			want:     resolverSpec{protocol: dnsProtocolDoQ, addr: "[2a10:50c0::ad1:ff]:853", serverName: "2a10:50c0::ad1:ff", target: "quic://[2a10:50c0::ad1:ff]", family: FamilyIPv6},
+		},
+		{resolver: "ftp://example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.resolver, func(t *testing.T) {
+			got, err := parseResolver(tt.resolver)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// dohHandler answers RFC 8484 POST queries with resolve.
+func dohHandler(t *testing.T, resolve func(*dns.Msg) *dns.Msg) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		q := new(dns.Msg)
+		if err := q.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if q.Id != 0 {
+			t.Errorf("DoH query ID = %d, want 0", q.Id)
+		}
+		packed, _ := resolve(q).Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(packed)
+	})
+}
+
+func TestDoHExchange(t *testing.T) {
+	resolver := httptest.NewServer(dohHandler(t, func(q *dns.Msg) *dns.Msg {
+		return answerA(q, "192.0.2.10", "192.0.2.11")
+	}))
+	defer resolver.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+	// httptest's certificate is not in the system roots, so this must
+	// fail verification.
+	untrusted := httptest.NewUnstartedServer(dohHandler(t, func(q *dns.Msg) *dns.Msg { return answerA(q) }))
+	untrusted.Config.ErrorLog = log.New(io.Discard, "", 0)
+	untrusted.StartTLS()
+	defer untrusted.Close()
+
+	p := NewDNSProbe(nil, DNSOptions{})
+	doh := func(url string) resolverSpec {
+		return resolverSpec{protocol: dnsProtocolDoH, addr: url, target: url}
+	}
+
+	m, err := p.runQuery(context.Background(), doh(resolver.URL+"/dns-query"), DNSQuery{Name: "example.com", Type: "A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Protocol != dnsProtocolDoH || m.DNSRcode != "NOERROR" || m.DNSAnswers != "192.0.2.10,192.0.2.11" {
+		t.Errorf("got protocol %q rcode %q answers %q", m.Protocol, m.DNSRcode, m.DNSAnswers)
+	}
+	if m.DNSTime == nil || m.ConnectTime == nil {
+		t.Errorf("query time %v, connect time %v, want both", deref(m.DNSTime), deref(m.ConnectTime))
+	}
+
+	q := newDNSQuery("example.com.", dns.TypeA)
+	resp, _, err := p.exchange(context.Background(), doh(resolver.URL), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Id != q.Id {
+		t.Errorf("reply ID %d, want the query's %d restored", resp.Id, q.Id)
+	}
+
+	for name, url := range map[string]string{"error status": broken.URL, "untrusted certificate": untrusted.URL} {
+		if _, _, err := p.exchange(context.Background(), doh(url), q); err == nil {
+			t.Errorf("%s: exchange succeeded", name)
+		}
+	}
+}
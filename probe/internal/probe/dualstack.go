@@ -0,0 +1,63 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// IP families recorded in Measurement.IPFamily and HappyEyeballs.
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// happyEyeballsDelay is the RFC 8305 connection attempt delay: IPv6 starts
+// first and IPv4 only after this long.
+const happyEyeballsDelay = 250 * time.Millisecond
+
+// ipFamily returns the family of ip, or "" when unknown.
+func ipFamily(ip net.IP) string {
+	switch {
+	case ip == nil:
+		return ""
+	case ip.To4() != nil:
+		return FamilyIPv4
+	default:
+		return FamilyIPv6
+	}
+}
+
+// lookupFamilies resolves host and returns its first IPv4 and first IPv6
+// address; either is nil when the host has none.
+func lookupFamilies(ctx context.Context, host string) (v4, v6 net.IP, err error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			if v4 == nil {
+				v4 = addr.IP
+			}
+		} else if v6 == nil {
+			v6 = addr.IP
+		}
+	}
+	return v4, v6, nil
+}
+
+// happyEyeballs returns the family an RFC 8305 client would end up on
+// given each family's time to connect in milliseconds, nil meaning the
+// attempt failed. IPv6 wins unless IPv4 finishes more than
+// happyEyeballsDelay sooner. It returns "" when both failed.
+func happyEyeballs(v4, v6 *float64) string {
+	delay := durationMs(happyEyeballsDelay)
+	switch {
+	case v6 != nil && (v4 == nil || *v6 < *v4+delay):
+		return FamilyIPv6
+	case v4 != nil:
+		return FamilyIPv4
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+package probe
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIPFamily(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.1":        FamilyIPv4,
+		"::ffff:192.0.2.1": FamilyIPv4,
+		"2001:db8::1":      FamilyIPv6,
+		"":                 "",
+	}
+	for addr, want := range tests {
+		if got := ipFamily(net.ParseIP(addr)); got != want {
+			t.Errorf("ipFamily(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestHappyEyeballs(t *testing.T) {
+	tests := []struct {
+		name   string
+		v4, v6 *float64
+		want   string
+	}{
+		{name: "IPv6 faster", v4: F64(30), v6: F64(20), want: FamilyIPv6},
+		{name: "IPv6 slower within the delay", v4: F64(20), v6: F64(260), want: FamilyIPv6},
+		{name: "IPv4 faster by the delay", v4: F64(20), v6: F64(270), want: FamilyIPv4},
+		{name: "IPv6 failed", v4: F64(20), want: FamilyIPv4},
+		{name: "IPv4 failed", v6: F64(900), want: FamilyIPv6},
+		{name: "both failed", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := happyEyeballs(tt.v4, tt.v6); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkHappyEyeballs(t *testing.T) {
+	ms := []Measurement{
+		// Plain UDP queries compare query times.
+		{QueryName: "example.com", QueryType: "A", IPFamily: FamilyIPv4, DNSTime: F64(10)},
+		{QueryName: "example.com", QueryType: "A", IPFamily: FamilyIPv6, DNSTime: F64(400)},
+		// A slow IPv6 answer over a fast IPv6 connection still wins.
+		{QueryName: "example.com", QueryType: "AAAA", IPFamily: FamilyIPv4, ConnectTime: F64(30), DNSTime: F64(35)},
+		{QueryName: "example.com", QueryType: "AAAA", IPFamily: FamilyIPv6, ConnectTime: F64(20), DNSTime: F64(900)},
+		// A failed IPv4 query leaves IPv6 as the only choice.
+		{QueryName: "example.org", QueryType: "A", IPFamily: FamilyIPv4},
+		{QueryName: "example.org", QueryType: "A", IPFamily: FamilyIPv6, TLSTime: F64(80), DNSTime: F64(90)},
+	}
+	want := []string{FamilyIPv4, FamilyIPv4, FamilyIPv6, FamilyIPv6, FamilyIPv6, FamilyIPv6}
+
+	markHappyEyeballs(ms)
+	for i, m := range ms {
+		if m.HappyEyeballs != want[i] {
+			t.Errorf("%s %s over %s: happy eyeballs = %q, want %q",
+				m.QueryName, m.QueryType, m.IPFamily, m.HappyEyeballs, want[i])
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package probe
+
+// Codec identifies the voice codec a call quality estimate assumes.
+type Codec string
+
+const (
+	CodecG711 Codec = "g711"
+	CodecOpus Codec = "opus"
+)
+
+// codecParams are a codec's E-model inputs: equipment impairment Ie, packet
+// loss robustness Bpl, and the one-way delay in milliseconds it adds for
+// framing and look-ahead.
+type codecParams struct {
+	ie    float64
+	bpl   float64
+	delay float64
+}
+
+// codecs holds G.711 with packet loss concealment as listed in ITU-T G.113
+// Appendix I, with 20ms packets. G.113 has no Opus entry; its values are a
+// common approximation for Opus at VoIP bitrates with in-band FEC, which
+// tolerates loss better than G.711 at the cost of look-ahead delay.
+var codecs = map[Codec]codecParams{
+	CodecG711: {ie: 0, bpl: 25.1, delay: 20},
+	CodecOpus: {ie: 0, bpl: 30, delay: 26.5},
+}
+
+// AnnotateCallQuality sets RFactor, MOS and VoIPCodec on measurements that
+// carry latency, jitter and loss for a path a call could take: ping, UDP
+// stream and TWAMP results. Others are left untouched. With total loss
+// there is no latency to rate, but no call would get through either, so R
+// is 0 and MOS 1.
+func AnnotateCallQuality(m *Measurement, codec Codec) {
+	switch m.ProbeType {
+	case ProbeTypePing, ProbeTypeUDPStream, ProbeTypeTWAMP:
+	default:
+		return
+	}
+	if m.PacketLoss == nil {
+		return
+	}
+	var r float64
+	switch {
+	case *m.PacketLoss >= 100:
+		r = 0
+	case m.LatencyAvg == nil || m.Jitter == nil:
+		return
+	default:
+		r = rFactor(*m.LatencyAvg, *m.Jitter, *m.PacketLoss, codec)
+	}
+	m.RFactor = F64(r)
+	m.MOS = F64(mosFromR(r))
+	m.VoIPCodec = string(codec)
+}
+
+// rFactor is the ITU-T G.107 E-model transmission rating with default
+// values for everything but delay and equipment impairment, using the Cole
+// and Rosenbluth approximation of the delay impairment. Mouth-to-ear delay
+// is half the round trip plus a jitter buffer of twice the jitter plus the
+// codec's own delay. Loss is assumed random (BurstR = 1).
+func rFactor(rttMs, jitterMs, lossPct float64, codec Codec) float64 {
+	params := codecs[codec]
+
+	d := rttMs/2 + 2*jitterMs + params.delay
+	id := 0.024 * d
+	if d > 177.3 {
+		id += 0.11 * (d - 177.3)
+	}
+
+	ieEff := params.ie + (95-params.ie)*lossPct/(lossPct+params.bpl)
+
+	// 93.2 is R0 - Is with G.107 default values.
+	return 93.2 - id - ieEff
+}
+
+// mosFromR converts an R-factor to an estimated mean opinion score
+// (ITU-T G.107 Annex B).
+func mosFromR(r float64) float64 {
+	switch {
+	case r <= 0:
+		return 1
+	case r >= 100:
+		return 4.5
+	}
+	return 1 + 0.035*r + r*(r-60)*(100-r)*7e-6
+}
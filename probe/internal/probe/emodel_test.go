@@ -0,0 +1,121 @@
+package probe
+
+import (
+	"math"
+	"testing"
+)
+
+// Reference values are given to the two decimals G.107 publishes.
+const emodelTolerance = 0.01
+
+// roughlyF64 is equalF64 within emodelTolerance.
+func roughlyF64(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return math.Abs(*a-*b) <= emodelTolerance
+}
+
+func TestRFactor(t *testing.T) {
+	tests := []struct {
+		name              string
+		rtt, jitter, loss float64
+		codec             Codec
+		want              float64
+	}{
+		// R0 - Is is 93.2 with G.107 defaults; 20ms of G.711 framing costs
+		// an Id of 0.48.
+		{name: "G.711 without network impairment", codec: CodecG711, want: 92.72},
+		{name: "jitter buffer of twice the jitter", jitter: 10, codec: CodecG711, want: 92.24},
+		{name: "mouth-to-ear delay at the 177.3ms knee", rtt: 314.6, codec: CodecG711, want: 88.94},
+		{name: "mouth-to-ear delay of 200ms", rtt: 360, codec: CodecG711, want: 85.90},
+		// G.113 Appendix I: Ie-eff is 3.64 at 1% and 15.78 at 5% random
+		// loss for G.711 with PLC (Bpl 25.1).
+		{name: "G.711 at 1% loss", loss: 1, codec: CodecG711, want: 89.08},
+		{name: "G.711 at 5% loss", loss: 5, codec: CodecG711, want: 76.94},
+		{name: "Opus at 5% loss", loss: 5, codec: CodecOpus, want: 78.99},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rFactor(tt.rtt, tt.jitter, tt.loss, tt.codec); math.Abs(got-tt.want) > emodelTolerance {
+				t.Errorf("R = %.3f, want %.2f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMOSFromR(t *testing.T) {
+	// ITU-T G.107 Annex B, Figure B.1.
+	tests := []struct{ r, want float64 }{
+		{r: 100, want: 4.5},
+		{r: 93.2, want: 4.41},
+		{r: 90, want: 4.34},
+		{r: 80, want: 4.02},
+		{r: 70, want: 3.60},
+		{r: 60, want: 3.10},
+		{r: 50, want: 2.58},
+		{r: 0, want: 1},
+		{r: -5, want: 1},
+	}
+
+	for _, tt := range tests {
+		if got := mosFromR(tt.r); math.Abs(got-tt.want) > emodelTolerance {
+			t.Errorf("mosFromR(%v) = %.3f, want %.2f", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestAnnotateCallQuality(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       Measurement
+		wantR   *float64
+		wantMOS *float64
+	}{
+		{
+			name:    "clean path",
+			m:       Measurement{ProbeType: ProbeTypePing, LatencyAvg: F64(20), Jitter: F64(1), PacketLoss: F64(0)},
+			wantR:   F64(92.43),
+			wantMOS: F64(4.39),
+		},
+		{
+			name:    "total loss without latency",
+			m:       Measurement{ProbeType: ProbeTypePing, PacketLoss: F64(100)},
+			wantR:   F64(0),
+			wantMOS: F64(1),
+		},
+		{
+			name: "partial result without jitter",
+			m:    Measurement{ProbeType: ProbeTypeTWAMP, LatencyAvg: F64(20), PacketLoss: F64(10)},
+		},
+		{
+			name: "probe type a call would not take",
+			m:    Measurement{ProbeType: ProbeTypeHTTP, LatencyAvg: F64(20), Jitter: F64(1), PacketLoss: F64(0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			AnnotateCallQuality(&tt.m, CodecG711)
+			if !roughlyF64(tt.m.RFactor, tt.wantR) || !roughlyF64(tt.m.MOS, tt.wantMOS) {
+				t.Errorf("got R %v MOS %v, want %v and %v", deref(tt.m.RFactor), deref(tt.m.MOS), deref(tt.wantR), deref(tt.wantMOS))
+			}
+		})
+	}
+}
+
+func equalF64(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// deref returns *p, or nil for printing when p is nil.
+func deref[T any](p *T) any {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
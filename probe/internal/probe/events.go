@@ -0,0 +1,86 @@
+package probe
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType identifies a change in the probe's network situation.
+type EventType string
+
+const (
+	EventPublicIPChanged EventType = "public_ip_changed"
+	EventASNChanged      EventType = "asn_changed"
+	EventCGNATChanged    EventType = "cgnat_changed"
+
+	// Findings that stop users browsing. Current is "true" while detected
+	// and "false" once cleared.
+	EventCaptivePortal    EventType = "captive_portal"
+	EventContentInjected  EventType = "content_injected"
+	EventTransparentProxy EventType = "transparent_proxy"
+	EventTLSInterception  EventType = "tls_interception"
+)
+
+// IsFinding reports whether events of type t flag a problem that is
+// either present or cleared.
+func IsFinding(t EventType) bool {
+	switch t {
+	case EventCaptivePortal, EventContentInjected, EventTransparentProxy, EventTLSInterception:
+		return true
+	}
+	return false
+}
+
+// Event records a change worth pinning on a timeline, such as a new public
+// IP, rather than a periodic measurement. Previous is empty the first time
+// a value is seen.
+type Event struct {
+	Timestamp time.Time `json:"timestamp"`
+	Type      EventType `json:"type"`
+	Previous  string    `json:"previous,omitempty"`
+	Current   string    `json:"current"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+// EventHandler is called when a probe detects events.
+type EventHandler func([]Event)
+
+// changeTracker remembers the latest value of each event type and turns
+// changes into events. It is safe for concurrent use.
+type changeTracker struct {
+	mu   sync.Mutex
+	last map[EventType]string
+}
+
+func newChangeTracker() *changeTracker {
+	return &changeTracker{last: make(map[EventType]string)}
+}
+
+// restore seeds the latest values, typically from stored events, so that
+// a change across a restart is still reported.
+func (t *changeTracker) restore(events []Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, e := range events {
+		t.last[e.Type] = e.Current
+	}
+}
+
+// update records value for typ and returns an event if it differs from
+// the previous one.
+func (t *changeTracker) update(ts time.Time, typ EventType, value, detail string) (Event, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	previous := t.last[typ]
+	if value == previous {
+		return Event{}, false
+	}
+	t.last[typ] = value
+	return Event{
+		Timestamp: ts,
+		Type:      typ,
+		Previous:  previous,
+		Current:   value,
+		Detail:    detail,
+	}, true
+}
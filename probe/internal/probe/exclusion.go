@@ -0,0 +1,99 @@
+package probe
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// UnderLoadPolicy decides how passive probes coexist with load-generating
+// ones.
+type UnderLoadPolicy string
+
+const (
+	// UnderLoadWait holds passive runs until no load run is in progress,
+	// and holds load runs until passive runs in progress have finished.
+	UnderLoadWait UnderLoadPolicy = "wait"
+	// UnderLoadTag lets passive runs go ahead and marks their measurements
+	// UnderLoad when a load run overlapped them.
+	UnderLoadTag UnderLoadPolicy = "tag"
+)
+
+// ExclusionGroups names the probes that saturate the link and the probes
+// whose results that would distort.
+type ExclusionGroups struct {
+	Load    []ProbeType
+	Passive []ProbeType
+	Policy  UnderLoadPolicy
+}
+
+// loadGate keeps load-generating runs apart from each other and, under
+// UnderLoadWait, from passive runs. Load runs hold it exclusively.
+type loadGate struct {
+	policy  UnderLoadPolicy
+	load    map[ProbeType]bool
+	passive map[ProbeType]bool
+
+	mu sync.RWMutex
+	// active counts load runs in progress; started counts every load run
+	// ever begun, so a passive run can tell if one began and ended within
+	// it.
+	active  atomic.Int64
+	started atomic.Int64
+}
+
+func newLoadGate(groups ExclusionGroups) *loadGate {
+	g := &loadGate{
+		policy:  groups.Policy,
+		load:    make(map[ProbeType]bool),
+		passive: make(map[ProbeType]bool),
+	}
+	if g.policy == "" {
+		g.policy = UnderLoadWait
+	}
+	for _, t := range groups.Load {
+		g.load[t] = true
+	}
+	for _, t := range groups.Passive {
+		g.passive[t] = true
+	}
+	return g
+}
+
+// enter blocks until a run of probeType may start and returns the
+// function to call once it has finished. For passive probes, that
+// function reports whether a load run overlapped the run; it returns
+// false for everything else.
+func (g *loadGate) enter(probeType ProbeType) (exit func() (underLoad bool)) {
+	switch {
+	case g.load[probeType]:
+		g.mu.Lock()
+		g.active.Add(1)
+		g.started.Add(1)
+		return func() bool {
+			g.active.Add(-1)
+			g.mu.Unlock()
+			return false
+		}
+
+	case g.passive[probeType]:
+		if g.policy == UnderLoadWait {
+			g.mu.RLock()
+		}
+		loaded := g.active.Load() > 0
+		started := g.started.Load()
+		return func() bool {
+			overlapped := loaded || g.active.Load() > 0 || g.started.Load() != started
+			if g.policy == UnderLoadWait {
+				g.mu.RUnlock()
+			}
+			return overlapped
+		}
+	}
+
+	return func() bool { return false }
+}
+
+// isPassive reports whether probeType's measurements carry UnderLoad.
+func (g *loadGate) isPassive(probeType ProbeType) bool {
+	return g.passive[probeType]
+}
@@ -0,0 +1,141 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScopeLAN marks measurements taken inside the local network, so loss on
+// the LAN segment can be told apart from loss beyond the ISP edge.
+const ScopeLAN = "lan"
+
+// routeFile is where Linux exposes the IPv4 routing table.
+const routeFile = "/proc/net/route"
+
+// Route flags from <linux/route.h>.
+const (
+	rtfUp      = 0x1
+	rtfGateway = 0x2
+)
+
+// GatewayProbe pings the default gateway. With gateway set to "auto" the
+// address is read from the routing table on every run, so it follows DHCP
+// renewals, Wi-Fi roaming and VPN route changes.
+type GatewayProbe struct {
+	gateway string
+	count   int
+	// discover returns the current default gateway.
+	discover func() (net.IP, error)
+}
+
+func NewGatewayProbe(gateway string, count int) *GatewayProbe {
+	return &GatewayProbe{
+		gateway:  gateway,
+		count:    count,
+		discover: discoverGateway,
+	}
+}
+
+func (p *GatewayProbe) Type() ProbeType {
+	return ProbeTypeGateway
+}
+
+func (p *GatewayProbe) Run(ctx context.Context) ([]Measurement, error) {
+	target := p.gateway
+	if target == "auto" {
+		gw, err := p.discover()
+		if err != nil {
+			return nil, fmt.Errorf("discover gateway: %w", err)
+		}
+		target = gw.String()
+	}
+
+	measurement := Measurement{
+		Timestamp: time.Now(),
+		ProbeType: ProbeTypeGateway,
+		Target:    target,
+		Scope:     ScopeLAN,
+	}
+
+	// pingWithFallback returns nil when nothing answered, which for the
+	// gateway is a result worth recording rather than an error.
+	stats := pingWithFallback(ctx, target, p.count, 10*time.Second)
+	if stats == nil {
+		measurement.PacketLoss = F64(100)
+		return []Measurement{measurement}, nil
+	}
+
+	measurement.PacketLoss = F64(stats.PacketLoss)
+	applyRTTStats(&measurement, stats.Rtts)
+
+	return []Measurement{measurement}, nil
+}
+
+// discoverGateway reads the default gateway from the kernel routing table.
+func discoverGateway() (net.IP, error) {
+	f, err := os.Open(routeFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseDefaultGateway(f)
+}
+
+// parseDefaultGateway returns the gateway of the lowest-metric default
+// route in /proc/net/route format. Addresses there are hex encoded in host
+// byte order, which is little-endian on every platform we ship.
+func parseDefaultGateway(r io.Reader) (net.IP, error) {
+	scanner := bufio.NewScanner(r)
+
+	var best net.IP
+	bestMetric := -1
+	header := true
+	for scanner.Scan() {
+		if header {
+			header = false
+			continue
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+		// Columns: Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+		if fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil || flags&(rtfUp|rtfGateway) != rtfUp|rtfGateway {
+			continue
+		}
+		gw, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil {
+			continue
+		}
+		metric, err := strconv.Atoi(fields[6])
+		if err != nil {
+			continue
+		}
+
+		if bestMetric == -1 || metric < bestMetric {
+			best = net.IPv4(byte(gw), byte(gw>>8), byte(gw>>16), byte(gw>>24))
+			bestMetric = metric
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no default route")
+	}
+	return best, nil
+}
@@ -0,0 +1,95 @@
+package probe
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseDefaultGateway(t *testing.T) {
+	const header = "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n"
+
+	tests := []struct {
+		name    string
+		routes  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "single default route",
+			routes: "eth0\t00000000\t0101A8C0\t0003\t0\t0\t100\t00000000\t0\t0\t0\n" +
+				"eth0\t0001A8C0\t00000000\t0001\t0\t0\t100\t00FFFFFF\t0\t0\t0\n",
+			want: "192.168.1.1",
+		},
+		{
+			name: "lowest metric wins",
+			routes: "wlan0\t00000000\t0100000A\t0003\t0\t0\t600\t00000000\t0\t0\t0\n" +
+				"eth0\t00000000\t0101A8C0\t0003\t0\t0\t100\t00000000\t0\t0\t0\n",
+			want: "192.168.1.1",
+		},
+		{
+			// Flags 0002 is RTF_GATEWAY without RTF_UP.
+			name:    "route that is down is ignored",
+			routes:  "eth0\t00000000\t0101A8C0\t0002\t0\t0\t100\t00000000\t0\t0\t0\n",
+			wantErr: true,
+		},
+		{
+			name:    "default route without a gateway is ignored",
+			routes:  "wg0\t00000000\t00000000\t0001\t0\t0\t0\t00000000\t0\t0\t0\n",
+			wantErr: true,
+		},
+		{
+			name:    "non-default routes only",
+			routes:  "eth0\t0001A8C0\t0101A8C0\t0003\t0\t0\t100\t00FFFFFF\t0\t0\t0\n",
+			wantErr: true,
+		},
+		{
+			name: "malformed lines are skipped",
+			routes: "garbage\n" +
+				"eth0\t00000000\tZZZZZZZZ\t0003\t0\t0\t100\t00000000\t0\t0\t0\n" +
+				"eth1\t00000000\t0100000A\t0003\t0\t0\t200\t00000000\t0\t0\t0\n",
+			want: "10.0.0.1",
+		},
+		{
+			name:    "empty table",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDefaultGateway(strings.NewReader(header + tt.routes))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDefaultGateway: %v", err)
+			}
+			if !got.Equal(net.ParseIP(tt.want)) {
+				t.Errorf("got %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDefaultGatewayRouteFile(t *testing.T) {
+	// A laptop on wired and wireless with a WireGuard tunnel and Docker,
+	// captured from /proc/net/route with its trailing padding.
+	f, err := os.Open("testdata/route")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	got, err := parseDefaultGateway(f)
+	if err != nil {
+		t.Fatalf("parseDefaultGateway: %v", err)
+	}
+	if want := net.ParseIP("192.168.2.1"); !got.Equal(want) {
+		t.Errorf("got %v, want the wired gateway %v", got, want)
+	}
+}
@@ -0,0 +1,194 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// maxHTTPBody caps how much of a response body is read, so a misconfigured
+// target cannot turn the probe into a bulk download.
+const maxHTTPBody = 10 << 20
+
+// HTTPProbe fetches URLs and breaks each request down into its DNS, TCP
+// connect, TLS handshake, time-to-first-byte and transfer phases.
+type HTTPProbe struct {
+	urls    []string
+	client  *http.Client
+	timeout time.Duration
+}
+
+func NewHTTPProbe(urls []string) *HTTPProbe {
+	transport := &http.Transport{
+		// A fresh connection per request so every run sees every phase.
+		DisableKeepAlives:   true,
+		TLSHandshakeTimeout: 10 * time.Second,
+		ForceAttemptHTTP2:   true,
+	}
+
+	return &HTTPProbe{
+		urls: urls,
+		client: &http.Client{
+			Transport: transport,
+			// Time the configured URL itself, not wherever it redirects to.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		timeout: 15 * time.Second,
+	}
+}
+
+func (p *HTTPProbe) Type() ProbeType {
+	return ProbeTypeHTTP
+}
+
+func (p *HTTPProbe) Run(ctx context.Context) ([]Measurement, error) {
+	var wg sync.WaitGroup
+	results := make(chan Measurement, len(p.urls))
+	errors := make(chan error, len(p.urls))
+
+	for _, url := range p.urls {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			m, err := p.fetch(ctx, u)
+			if err != nil {
+				errors <- fmt.Errorf("url %s: %w", u, err)
+				return
+			}
+			results <- m
+		}(url)
+	}
+
+	wg.Wait()
+	close(results)
+	close(errors)
+
+	var measurements []Measurement
+	for m := range results {
+		measurements = append(measurements, m)
+	}
+
+	var errs []error
+	for err := range errors {
+		errs = append(errs, err)
+	}
+
+	if len(measurements) == 0 && len(errs) > 0 {
+		return nil, fmt.Errorf("all URLs failed: %v", errs)
+	}
+
+	return measurements, nil
+}
+
+// httpTimings collects phase timestamps from an httptrace.ClientTrace.
+type httpTimings struct {
+	mu           sync.Mutex
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	firstByte    time.Time
+}
+
+func (t *httpTimings) trace() *httptrace.ClientTrace {
+	// Callbacks may fire from dialer goroutines, hence the lock.
+	set := func(field *time.Time) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if field.IsZero() {
+			*field = time.Now()
+		}
+	}
+
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { set(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { set(&t.dnsDone) },
+		ConnectStart: func(network, addr string) {
+			set(&t.connectStart)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				set(&t.connectDone)
+			}
+		},
+		TLSHandshakeStart: func() { set(&t.tlsStart) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			set(&t.tlsDone)
+		},
+		GotConn:              func(httptrace.GotConnInfo) { set(&t.gotConn) },
+		GotFirstResponseByte: func() { set(&t.firstByte) },
+	}
+}
+
+func (p *HTTPProbe) fetch(ctx context.Context, url string) (Measurement, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	timings := &httpTimings{}
+	ctx = httptrace.WithClientTrace(ctx, timings.trace())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return Measurement{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "netpulse-probe")
+
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Measurement{}, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(io.Discard, io.LimitReader(resp.Body, maxHTTPBody)); err != nil {
+		return Measurement{}, fmt.Errorf("failed to read body: %w", err)
+	}
+	done := time.Now()
+
+	timings.mu.Lock()
+	defer timings.mu.Unlock()
+
+	m := Measurement{
+		Timestamp:  time.Now(),
+		ProbeType:  ProbeTypeHTTP,
+		Target:     url,
+		TotalTime:  F64(durationMs(done.Sub(start))),
+		StatusCode: Int(resp.StatusCode),
+	}
+
+	// Phases that did not happen (IP literal, plain HTTP) stay nil.
+	if !timings.dnsStart.IsZero() && !timings.dnsDone.IsZero() {
+		m.ResolveTime = F64(durationMs(timings.dnsDone.Sub(timings.dnsStart)))
+	}
+	if !timings.connectStart.IsZero() && !timings.connectDone.IsZero() {
+		m.ConnectTime = F64(durationMs(timings.connectDone.Sub(timings.connectStart)))
+	}
+	if !timings.tlsStart.IsZero() && !timings.tlsDone.IsZero() {
+		m.TLSTime = F64(durationMs(timings.tlsDone.Sub(timings.tlsStart)))
+	}
+	// TTFB is measured from having a usable connection, so it covers
+	// request transmission and server think time but not connection setup.
+	if !timings.gotConn.IsZero() && !timings.firstByte.IsZero() {
+		m.TTFB = F64(durationMs(timings.firstByte.Sub(timings.gotConn)))
+	}
+	if !timings.firstByte.IsZero() {
+		m.TransferTime = F64(durationMs(done.Sub(timings.firstByte)))
+	}
+
+	return m, nil
+}
+
+// durationMs converts a duration to fractional milliseconds.
+func durationMs(d time.Duration) float64 {
+	return d.Seconds() * 1000
+}
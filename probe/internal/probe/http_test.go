@@ -0,0 +1,94 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPProbeFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/slow", http.StatusFound)
+	})
+
+	plain := httptest.NewServer(mux)
+	defer plain.Close()
+	secure := httptest.NewTLSServer(mux)
+	defer secure.Close()
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantTLS    bool
+		minTTFB    float64
+	}{
+		{name: "plain", url: plain.URL + "/slow", wantStatus: 204, minTTFB: 50},
+		{name: "TLS", url: secure.URL + "/slow", wantStatus: 204, wantTLS: true, minTTFB: 50},
+		{name: "redirect not followed", url: plain.URL + "/moved", wantStatus: 302},
+	}
+
+	p := NewHTTPProbe(nil)
+	p.client.Transport.(*http.Transport).TLSClientConfig = secure.Client().Transport.(*http.Transport).TLSClientConfig
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := p.fetch(context.Background(), tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if m.StatusCode == nil || *m.StatusCode != tt.wantStatus {
+				t.Errorf("status = %v, want %d", deref(m.StatusCode), tt.wantStatus)
+			}
+			// The servers listen on IP literals, so there is no DNS phase.
+			if m.ResolveTime != nil {
+				t.Errorf("resolve time = %v, want none", *m.ResolveTime)
+			}
+			if m.ConnectTime == nil || m.TTFB == nil || m.TransferTime == nil || m.TotalTime == nil {
+				t.Fatalf("missing phases: connect %v ttfb %v transfer %v total %v",
+					m.ConnectTime, m.TTFB, m.TransferTime, m.TotalTime)
+			}
+			if (m.TLSTime != nil) != tt.wantTLS {
+				t.Errorf("TLS time = %v, want present %v", m.TLSTime, tt.wantTLS)
+			}
+			if *m.TTFB < tt.minTTFB {
+				t.Errorf("TTFB = %.1fms, want at least %.0fms of server time", *m.TTFB, tt.minTTFB)
+			}
+			phases := *m.ConnectTime + *m.TTFB + *m.TransferTime
+			if m.TLSTime != nil {
+				phases += *m.TLSTime
+			}
+			if phases > *m.TotalTime {
+				t.Errorf("phases add up to %.2fms, more than the %.2fms total", phases, *m.TotalTime)
+			}
+		})
+	}
+}
+
+func TestHTTPProbeRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	down := httptest.NewServer(nil)
+	down.Close()
+
+	ms, err := NewHTTPProbe([]string{srv.URL, down.URL}).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || ms[0].Target != srv.URL || ms[0].ProbeType != ProbeTypeHTTP {
+		t.Errorf("got %+v, want one HTTP measurement of %s", ms, srv.URL)
+	}
+
+	if _, err := NewHTTPProbe([]string{down.URL}).Run(context.Background()); err == nil {
+		t.Error("Run succeeded with every URL down")
+	}
+}
@@ -0,0 +1,169 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ntpPort is the NTP service port used when a server has none.
+const ntpPort = "123"
+
+// ntpPacketLen is the size of an NTP header without extensions or MAC.
+const ntpPacketLen = 48
+
+// ntpClientHeader is the first byte of an SNTP request: no leap warning,
+// version 4, mode 3 (client).
+const ntpClientHeader = 0<<6 | 4<<3 | 3
+
+// NTPProbe queries NTP servers with SNTP (RFC 4330) and records the local
+// clock's offset from each, the round-trip delay and the server stratum.
+// It does not adjust the clock; ClockTrust uses the offsets to flag
+// measurements whose timestamps cannot be trusted.
+type NTPProbe struct {
+	servers []string
+	timeout time.Duration
+}
+
+// NewNTPProbe queries each server (host or host:port, port 123 by
+// default), waiting up to timeout for each reply.
+func NewNTPProbe(servers []string, timeout time.Duration) *NTPProbe {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &NTPProbe{
+		servers: servers,
+		timeout: timeout,
+	}
+}
+
+func (p *NTPProbe) Type() ProbeType {
+	return ProbeTypeNTP
+}
+
+func (p *NTPProbe) Run(ctx context.Context) ([]Measurement, error) {
+	var wg sync.WaitGroup
+	results := make([]Measurement, len(p.servers))
+	errors := make([]error, len(p.servers))
+
+	for i, server := range p.servers {
+		wg.Add(1)
+		go func(idx int, srv string) {
+			defer wg.Done()
+			measurement, err := p.queryServer(ctx, srv)
+			if err != nil {
+				errors[idx] = err
+				return
+			}
+			results[idx] = measurement
+		}(i, server)
+	}
+
+	wg.Wait()
+
+	var validResults []Measurement
+	var errs []error
+	for i, result := range results {
+		if errors[i] != nil {
+			errs = append(errs, fmt.Errorf("server %s: %w", p.servers[i], errors[i]))
+		} else {
+			validResults = append(validResults, result)
+		}
+	}
+
+	if len(validResults) == 0 && len(errs) > 0 {
+		return nil, fmt.Errorf("all servers failed: %v", errs)
+	}
+
+	return validResults, nil
+}
+
+func (p *NTPProbe) queryServer(ctx context.Context, server string) (Measurement, error) {
+	addr := server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		addr = net.JoinHostPort(server, ntpPort)
+	}
+
+	dialer := &net.Dialer{Timeout: p.timeout}
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return Measurement{}, fmt.Errorf("failed to dial: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	conn.SetDeadline(time.Now().Add(p.timeout))
+
+	req := make([]byte, ntpPacketLen)
+	req[0] = ntpClientHeader
+	t1 := time.Now()
+	putNTPTimestamp(req[40:48], t1)
+	if _, err := conn.Write(req); err != nil {
+		return Measurement{}, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	resp := make([]byte, 1024)
+	for {
+		n, err := conn.Read(resp)
+		if err != nil {
+			return Measurement{}, fmt.Errorf("no reply: %w", err)
+		}
+		t4 := time.Now()
+
+		// Replies must echo our transmit timestamp; anything else is stale
+		// or spoofed.
+		if n < ntpPacketLen || !bytes.Equal(resp[24:32], req[40:48]) {
+			continue
+		}
+		offset, delay, stratum, err := parseNTPReply(resp[:n], t1, t4)
+		if err != nil {
+			return Measurement{}, err
+		}
+
+		return Measurement{
+			Timestamp:   time.Now(),
+			ProbeType:   ProbeTypeNTP,
+			Target:      server,
+			LatencyAvg:  F64(durationMs(delay)),
+			ClockOffset: F64(durationMs(offset)),
+			Stratum:     Int(stratum),
+		}, nil
+	}
+}
+
+// parseNTPReply validates a server reply to a request sent at t1 and
+// received at t4, and returns the local clock's offset (positive when it
+// is behind the server), the round-trip delay excluding server processing,
+// and the server's stratum.
+func parseNTPReply(b []byte, t1, t4 time.Time) (offset, delay time.Duration, stratum int, err error) {
+	if len(b) < ntpPacketLen {
+		return 0, 0, 0, fmt.Errorf("short reply: %d bytes", len(b))
+	}
+	if mode := b[0] & 0x7; mode != 4 {
+		return 0, 0, 0, fmt.Errorf("unexpected mode %d in reply", mode)
+	}
+	if b[0]>>6 == 3 {
+		return 0, 0, 0, fmt.Errorf("server clock is not synchronized")
+	}
+	stratum = int(b[1])
+	if stratum == 0 {
+		return 0, 0, 0, fmt.Errorf("kiss-o'-death %q", bytes.TrimRight(b[12:16], "\x00"))
+	}
+	if stratum > 15 {
+		return 0, 0, 0, fmt.Errorf("server stratum %d is unsynchronized", stratum)
+	}
+
+	if binary.BigEndian.Uint64(b[40:48]) == 0 {
+		return 0, 0, 0, fmt.Errorf("reply has no transmit timestamp")
+	}
+	t2 := readNTPTimestamp(b[32:40])
+	t3 := readNTPTimestamp(b[40:48])
+
+	offset = (t2.Sub(t1) + t3.Sub(t4)) / 2
+	delay = t4.Sub(t1) - t3.Sub(t2)
+	return offset, delay, stratum, nil
+}
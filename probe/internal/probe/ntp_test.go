@@ -0,0 +1,142 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ntpReply builds a server's answer to req with its clock skew ahead of
+// ours, as version 4 mode 4 with the given leap indicator and stratum.
+type ntpReply func(req []byte, skew time.Duration) []byte
+
+func serverReply(leap, stratum byte) ntpReply {
+	return func(req []byte, skew time.Duration) []byte {
+		resp := make([]byte, ntpPacketLen)
+		resp[0] = leap<<6 | 4<<3 | 4
+		resp[1] = stratum
+		copy(resp[24:32], req[40:48])
+		putNTPTimestamp(resp[32:40], time.Now().Add(skew))
+		putNTPTimestamp(resp[40:48], time.Now().Add(skew))
+		return resp
+	}
+}
+
+// startNTPServer answers SNTP requests on a loopback port until the test
+// ends and returns its address.
+func startNTPServer(t *testing.T, skew time.Duration, reply ntpReply) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, peer, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < ntpPacketLen || buf[0] != ntpClientHeader {
+				continue
+			}
+			conn.WriteTo(reply(buf[:n], skew), peer)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestNTPProbeQueryServer(t *testing.T) {
+	kissOfDeath := func(req []byte, skew time.Duration) []byte {
+		resp := serverReply(0, 0)(req, skew)
+		copy(resp[12:16], "RATE")
+		return resp
+	}
+	// Answers that do not echo our transmit timestamp are ignored.
+	spoofed := func(req []byte, skew time.Duration) []byte {
+		resp := serverReply(0, 2)(req, skew)
+		binary.BigEndian.PutUint64(resp[24:32], 1)
+		return resp
+	}
+
+	tests := []struct {
+		name        string
+		skew        time.Duration
+		reply       ntpReply
+		wantOffset  time.Duration
+		wantStratum int
+		wantErr     string
+	}{
+		{name: "server in step", reply: serverReply(0, 1), wantStratum: 1},
+		{name: "local clock behind", skew: 2 * time.Second, reply: serverReply(0, 2), wantOffset: 2 * time.Second, wantStratum: 2},
+		{name: "local clock ahead", skew: -time.Hour, reply: serverReply(0, 3), wantOffset: -time.Hour, wantStratum: 3},
+		{name: "leap second warning", reply: serverReply(1, 2), wantStratum: 2},
+		{name: "unsynchronized server", reply: serverReply(3, 2), wantErr: "not synchronized"},
+		{name: "kiss-o'-death", reply: kissOfDeath, wantErr: `"RATE"`},
+		{name: "spoofed reply", reply: spoofed, wantErr: "no reply"},
+	}
+
+	p := NewNTPProbe(nil, 200*time.Millisecond)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := startNTPServer(t, tt.skew, tt.reply)
+			m, err := p.queryServer(context.Background(), addr)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if m.ProbeType != ProbeTypeNTP || m.Target != addr || m.Stratum == nil || *m.Stratum != tt.wantStratum {
+				t.Errorf("got %s measurement of %q at stratum %v", m.ProbeType, m.Target, deref(m.Stratum))
+			}
+			// Loopback round trips are well under the 10ms allowed.
+			offset := time.Duration(*m.ClockOffset * float64(time.Millisecond))
+			if (offset - tt.wantOffset).Abs() > 10*time.Millisecond {
+				t.Errorf("offset = %v, want %v", offset, tt.wantOffset)
+			}
+			if *m.LatencyAvg < 0 || *m.LatencyAvg > 10 {
+				t.Errorf("delay = %vms", *m.LatencyAvg)
+			}
+		})
+	}
+}
+
+func TestNTPProbeRunCorrectsClock(t *testing.T) {
+	servers := []string{
+		startNTPServer(t, time.Hour, serverReply(0, 2)),
+		startNTPServer(t, 0, serverReply(3, 2)),
+	}
+
+	ms, err := NewNTPProbe(servers, 200*time.Millisecond).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || ms[0].Target != servers[0] {
+		t.Fatalf("got %+v, want one measurement of the synchronized server", ms)
+	}
+
+	// A clock an hour slow is distrusted and later timestamps corrected.
+	c := NewClockTrust(time.Second)
+	if !c.Observe(ms) {
+		t.Fatal("first NTP reply did not change clock trust")
+	}
+	ts := time.Now()
+	m := Measurement{ProbeType: ProbeTypePing, Timestamp: ts}
+	c.Annotate(&m)
+	if m.ClockUntrusted == nil || !*m.ClockUntrusted {
+		t.Fatalf("ClockUntrusted = %v, want true", deref(m.ClockUntrusted))
+	}
+	if d := m.Timestamp.Sub(ts) - time.Hour; d.Abs() > 10*time.Millisecond {
+		t.Errorf("timestamp moved by %v, want an hour", m.Timestamp.Sub(ts))
+	}
+}
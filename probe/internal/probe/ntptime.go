@@ -0,0 +1,41 @@
+package probe
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// ntpEpochOffset is the number of seconds between the NTP epoch
+// (1900-01-01) and the Unix epoch.
+const ntpEpochOffset = 2208988800
+
+// ntpTimestamp converts t to the 64-bit NTP timestamp format used by NTP
+// and TWAMP: whole seconds since 1900 in the high 32 bits and a binary
+// fraction of a second in the low 32 bits.
+func ntpTimestamp(t time.Time) uint64 {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return secs<<32 | frac
+}
+
+// fromNTPTimestamp converts a 64-bit NTP timestamp back to a time. As in
+// RFC 4330, seconds with the top bit clear are taken to be in the era
+// starting 2036, when the 32-bit counter wraps.
+func fromNTPTimestamp(ts uint64) time.Time {
+	secs := int64(ts >> 32)
+	if secs&0x80000000 == 0 {
+		secs += 1 << 32
+	}
+	nanos := (ts & 0xffffffff) * uint64(time.Second) >> 32
+	return time.Unix(secs-ntpEpochOffset, int64(nanos))
+}
+
+// putNTPTimestamp writes t into b[:8] in network byte order.
+func putNTPTimestamp(b []byte, t time.Time) {
+	binary.BigEndian.PutUint64(b, ntpTimestamp(t))
+}
+
+// readNTPTimestamp reads a network byte order NTP timestamp from b[:8].
+func readNTPTimestamp(b []byte) time.Time {
+	return fromNTPTimestamp(binary.BigEndian.Uint64(b))
+}
@@ -1,8 +1,10 @@
 package probe
 
 import (
+	"context"
 	"fmt"
 	"math"
+	"net"
 	"sort"
 	"sync"
 	"time"
@@ -13,12 +15,15 @@ import (
 type PingProbe struct {
 	targets []string
 	count   int
+	// dualStack pings hostname targets over IPv4 and IPv6 separately.
+	dualStack bool
 }
 
-func NewPingProbe(targets []string, count int) *PingProbe {
+func NewPingProbe(targets []string, count int, dualStack bool) *PingProbe {
 	return &PingProbe{
-		targets: targets,
-		count:   count,
+		targets:   targets,
+		count:     count,
+		dualStack: dualStack,
 	}
 }
 
@@ -26,21 +31,25 @@ func (p *PingProbe) Type() ProbeType {
 	return ProbeTypePing
 }
 
-func (p *PingProbe) Run() ([]Measurement, error) {
+func (p *PingProbe) Run(ctx context.Context) ([]Measurement, error) {
 	var wg sync.WaitGroup
-	results := make([]Measurement, len(p.targets))
+	results := make([][]Measurement, len(p.targets))
 	errors := make([]error, len(p.targets))
 
 	for i, target := range p.targets {
 		wg.Add(1)
 		go func(idx int, tgt string) {
 			defer wg.Done()
-			measurement, err := p.pingTarget(tgt)
+			if p.dualStack && net.ParseIP(tgt) == nil {
+				results[idx], errors[idx] = p.pingDualStack(ctx, tgt)
+				return
+			}
+			measurement, err := p.pingTarget(ctx, tgt)
 			if err != nil {
 				errors[idx] = err
 				return
 			}
-			results[idx] = measurement
+			results[idx] = []Measurement{measurement}
 		}(i, target)
 	}
 
@@ -52,7 +61,7 @@ func (p *PingProbe) Run() ([]Measurement, error) {
 		if errors[i] != nil {
 			errs = append(errs, fmt.Errorf("target %s: %w", p.targets[i], errors[i]))
 		} else {
-			validResults = append(validResults, result)
+			validResults = append(validResults, result...)
 		}
 	}
 
@@ -63,8 +72,14 @@ func (p *PingProbe) Run() ([]Measurement, error) {
 	return validResults, nil
 }
 
-func (p *PingProbe) pingTarget(target string) (Measurement, error) {
-	stats := pingWithFallback(target, p.count, 10*time.Second)
+func (p *PingProbe) pingTarget(ctx context.Context, target string) (Measurement, error) {
+	return p.pingAddr(ctx, target, target)
+}
+
+// pingAddr pings addr and records the result under target, so each family
+// of a dual-stack hostname keeps the hostname as its target.
+func (p *PingProbe) pingAddr(ctx context.Context, target, addr string) (Measurement, error) {
+	stats := pingWithFallback(ctx, addr, p.count, 10*time.Second)
 
 	if stats == nil || stats.PacketsSent == 0 {
 		return Measurement{}, fmt.Errorf("no packets sent")
@@ -75,6 +90,9 @@ func (p *PingProbe) pingTarget(target string) (Measurement, error) {
 		ProbeType: ProbeTypePing,
 		Target:    target,
 	}
+	if stats.IPAddr != nil {
+		measurement.IPFamily = ipFamily(stats.IPAddr.IP)
+	}
 
 	packetLoss := float64(stats.PacketLoss)
 	measurement.PacketLoss = F64(packetLoss)
@@ -98,9 +116,69 @@ func (p *PingProbe) pingTarget(target string) (Measurement, error) {
 	return measurement, nil
 }
 
+// pingDualStack pings the first IPv4 and first IPv6 address of target in
+// parallel. A family that gets no replies is recorded as 100% loss rather
+// than dropped, since a dead IPv6 path is exactly what the comparison is
+// for. Both measurements carry the family Happy Eyeballs would choose.
+func (p *PingProbe) pingDualStack(ctx context.Context, target string) ([]Measurement, error) {
+	lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	v4, v6, err := lookupFamilies(lookupCtx, target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve target: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	var results []Measurement
+	var mu sync.Mutex
+	for _, ip := range []net.IP{v4, v6} {
+		if ip == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(ip net.IP) {
+			defer wg.Done()
+			m, err := p.pingAddr(ctx, target, ip.String())
+			if err != nil {
+				m = Measurement{
+					Timestamp:  time.Now(),
+					ProbeType:  ProbeTypePing,
+					Target:     target,
+					PacketLoss: F64(100),
+				}
+			}
+			m.IPFamily = ipFamily(ip)
+			mu.Lock()
+			results = append(results, m)
+			mu.Unlock()
+		}(ip)
+	}
+	wg.Wait()
+
+	var rtt4, rtt6 *float64
+	for _, m := range results {
+		if m.IPFamily == FamilyIPv4 {
+			rtt4 = m.LatencyAvg
+		} else {
+			rtt6 = m.LatencyAvg
+		}
+	}
+	if rtt4 == nil && rtt6 == nil {
+		return nil, fmt.Errorf("no replies over IPv4 or IPv6")
+	}
+	winner := happyEyeballs(rtt4, rtt6)
+	for i := range results {
+		results[i].HappyEyeballs = winner
+	}
+
+	return results, nil
+}
+
 // pingWithFallback tries privileged ICMP (raw socket) first, then
-// unprivileged (UDP) if no replies are received.
-func pingWithFallback(target string, count int, timeout time.Duration) *probing.Statistics {
+// unprivileged (UDP) if no replies are received. Cancelling ctx stops the
+// ping early.
+func pingWithFallback(ctx context.Context, target string, count int, timeout time.Duration) *probing.Statistics {
 	pinger, err := probing.NewPinger(target)
 	if err != nil {
 		return nil
@@ -109,13 +187,17 @@ func pingWithFallback(target string, count int, timeout time.Duration) *probing.
 	pinger.Timeout = timeout
 
 	pinger.SetPrivileged(true)
-	if err := pinger.Run(); err == nil {
+	if err := pinger.RunWithContext(ctx); err == nil {
 		stats := pinger.Statistics()
 		if stats.PacketsRecv > 0 {
 			return stats
 		}
 	}
 
+	if ctx.Err() != nil {
+		return nil
+	}
+
 	unprivPinger, err := probing.NewPinger(target)
 	if err != nil {
 		return nil
@@ -124,7 +206,7 @@ func pingWithFallback(target string, count int, timeout time.Duration) *probing.
 	unprivPinger.Timeout = timeout
 	unprivPinger.SetPrivileged(false)
 
-	if err := unprivPinger.Run(); err == nil {
+	if err := unprivPinger.RunWithContext(ctx); err == nil {
 		stats := unprivPinger.Statistics()
 		if stats.PacketsRecv > 0 {
 			return stats
@@ -134,6 +216,33 @@ func pingWithFallback(target string, count int, timeout time.Duration) *probing.
 	return nil
 }
 
+// applyRTTStats fills the latency and jitter fields of m from raw RTT
+// samples, matching what pingTarget derives from probing.Statistics.
+func applyRTTStats(m *Measurement, rtts []time.Duration) {
+	if len(rtts) == 0 {
+		return
+	}
+
+	minRtt, maxRtt := rtts[0], rtts[0]
+	var total time.Duration
+	for _, rtt := range rtts {
+		if rtt < minRtt {
+			minRtt = rtt
+		}
+		if rtt > maxRtt {
+			maxRtt = rtt
+		}
+		total += rtt
+	}
+	avgRtt := total / time.Duration(len(rtts))
+
+	m.LatencyMin = F64(minRtt.Seconds() * 1000)
+	m.LatencyAvg = F64(avgRtt.Seconds() * 1000)
+	m.LatencyMax = F64(maxRtt.Seconds() * 1000)
+	m.LatencyP95 = F64(calculateP95(rtts))
+	m.Jitter = F64(calculateJitter(rtts))
+}
+
 func calculateP95(rtts []time.Duration) float64 {
 	if len(rtts) == 0 {
 		return 0
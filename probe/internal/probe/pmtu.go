@@ -0,0 +1,225 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// pmtuMinSize is the smallest packet every IPv4 path must carry unfragmented
+// in practice. A target that does not answer at this size is unreachable
+// rather than MTU limited.
+const pmtuMinSize = 576
+
+// pmtuOutcome is what became of a single don't-fragment probe.
+type pmtuOutcome int
+
+const (
+	// pmtuLost means nothing came back before the timeout.
+	pmtuLost pmtuOutcome = iota
+	// pmtuDelivered means the echo reply arrived.
+	pmtuDelivered
+	// pmtuTooBig means a router returned "fragmentation needed" or the
+	// local stack refused the size for the route.
+	pmtuTooBig
+)
+
+// pmtuSender sends one don't-fragment echo request of size bytes, IP
+// header included, and reports the outcome along with any next-hop MTU a
+// router quoted. The Linux implementation uses a real socket; tests can
+// substitute a fake path.
+type pmtuSender interface {
+	Send(dst net.IP, size int) (pmtuOutcome, int, error)
+	Close() error
+}
+
+// PMTUProbe finds the largest packet that reaches each target without
+// fragmentation by bisecting don't-fragment echo sizes. It also flags
+// black holes, where oversized packets vanish without the ICMP error
+// that PMTU discovery relies on, which shows up as hung TLS connections.
+type PMTUProbe struct {
+	targets []string
+	maxSize int
+	timeout time.Duration
+	// tries is how often a size is retried before counting it as lost.
+	tries int
+	// dial opens a pmtuSender that waits timeout for each outcome.
+	dial func(timeout time.Duration) (pmtuSender, error)
+}
+
+func NewPMTUProbe(targets []string, maxSize int, timeout time.Duration) *PMTUProbe {
+	if maxSize <= pmtuMinSize {
+		maxSize = 1500
+	}
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	return &PMTUProbe{
+		targets: targets,
+		maxSize: maxSize,
+		timeout: timeout,
+		tries:   2,
+		dial:    dialPMTUSender,
+	}
+}
+
+func (p *PMTUProbe) Type() ProbeType {
+	return ProbeTypePMTU
+}
+
+func (p *PMTUProbe) Run(ctx context.Context) ([]Measurement, error) {
+	var wg sync.WaitGroup
+	results := make([]Measurement, len(p.targets))
+	errors := make([]error, len(p.targets))
+
+	for i, target := range p.targets {
+		wg.Add(1)
+		go func(idx int, tgt string) {
+			defer wg.Done()
+			measurement, err := p.probeTarget(ctx, tgt)
+			if err != nil {
+				errors[idx] = err
+				return
+			}
+			results[idx] = measurement
+		}(i, target)
+	}
+
+	wg.Wait()
+
+	var validResults []Measurement
+	var errs []error
+	for i, result := range results {
+		if errors[i] != nil {
+			errs = append(errs, fmt.Errorf("target %s: %w", p.targets[i], errors[i]))
+		} else {
+			validResults = append(validResults, result)
+		}
+	}
+
+	if len(validResults) == 0 && len(errs) > 0 {
+		return nil, fmt.Errorf("all targets failed: %v", errs)
+	}
+
+	return validResults, nil
+}
+
+func (p *PMTUProbe) probeTarget(ctx context.Context, target string) (Measurement, error) {
+	dst, err := net.ResolveIPAddr("ip4", target)
+	if err != nil {
+		return Measurement{}, fmt.Errorf("failed to resolve target: %w", err)
+	}
+
+	sender, err := p.dial(p.timeout)
+	if err != nil {
+		return Measurement{}, fmt.Errorf("failed to open ICMP socket: %w", err)
+	}
+	defer sender.Close()
+	stop := context.AfterFunc(ctx, func() { sender.Close() })
+	defer stop()
+
+	mtu, blackhole, err := p.discover(sender, dst.IP)
+	if err != nil {
+		return Measurement{}, err
+	}
+
+	return Measurement{
+		Timestamp:     time.Now(),
+		ProbeType:     ProbeTypePMTU,
+		Target:        target,
+		PathMTU:       Int(mtu),
+		PMTUBlackhole: Bool(blackhole),
+	}, nil
+}
+
+// discover bisects between pmtuMinSize and p.maxSize for the largest size
+// that is delivered. The maximum is tried first since most paths carry it,
+// and a next-hop MTU quoted by a router is tried as soon as it is seen.
+// The path is a black hole when some size was lost but no router ever
+// reported it too big.
+func (p *PMTUProbe) discover(s pmtuSender, dst net.IP) (int, bool, error) {
+	outcome, _, err := p.try(s, dst, pmtuMinSize)
+	if err != nil {
+		return 0, false, err
+	}
+	if outcome != pmtuDelivered {
+		return 0, false, fmt.Errorf("no reply at %d bytes", pmtuMinSize)
+	}
+
+	good, bad := pmtuMinSize, p.maxSize+1
+	sawLost, sawTooBig := false, false
+	next := p.maxSize
+
+	for bad-good > 1 {
+		size := next
+		outcome, hint, err := p.try(s, dst, size)
+		if err != nil {
+			return 0, false, err
+		}
+
+		switch outcome {
+		case pmtuDelivered:
+			good = size
+		case pmtuTooBig:
+			bad = size
+			sawTooBig = true
+		case pmtuLost:
+			bad = size
+			sawLost = true
+		}
+
+		next = (good + bad) / 2
+		if outcome == pmtuTooBig && hint > good && hint < bad {
+			next = hint
+		}
+	}
+
+	return good, sawLost && !sawTooBig, nil
+}
+
+// try sends size up to p.tries times, stopping at the first definite
+// answer so ordinary packet loss is not mistaken for an MTU limit.
+func (p *PMTUProbe) try(s pmtuSender, dst net.IP, size int) (pmtuOutcome, int, error) {
+	for i := 0; i < p.tries; i++ {
+		outcome, hint, err := s.Send(dst, size)
+		if err != nil {
+			return pmtuLost, 0, fmt.Errorf("send %d byte probe: %w", size, err)
+		}
+		if outcome != pmtuLost {
+			return outcome, hint, nil
+		}
+	}
+	return pmtuLost, 0, nil
+}
+
+// parsePMTUReply classifies an ICMP message read back after a probe. It
+// returns the echo ID and sequence the message refers to and, for
+// "fragmentation needed", the next-hop MTU carried in bytes 6-7 of the
+// header, which x/net/icmp does not expose.
+func parsePMTUReply(b []byte) (outcome pmtuOutcome, id, seq, mtu int, ok bool) {
+	if len(b) < 8 {
+		return pmtuLost, 0, 0, 0, false
+	}
+
+	switch ipv4.ICMPType(b[0]) {
+	case ipv4.ICMPTypeEchoReply:
+		return pmtuDelivered, int(binary.BigEndian.Uint16(b[4:6])), int(binary.BigEndian.Uint16(b[6:8])), 0, true
+	case ipv4.ICMPTypeDestinationUnreachable:
+		// Code 4 is "fragmentation needed and DF set".
+		if b[1] != 4 {
+			return pmtuLost, 0, 0, 0, false
+		}
+		id, seq, ok := parseQuotedEcho(b[8:])
+		if !ok {
+			return pmtuLost, 0, 0, 0, false
+		}
+		return pmtuTooBig, id, seq, int(binary.BigEndian.Uint16(b[6:8])), true
+	}
+
+	return pmtuLost, 0, 0, 0, false
+}
@@ -0,0 +1,156 @@
+//go:build linux
+
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// icmpPMTUSender is a pmtuSender over an ICMP socket with IP_PMTUDISC_DO
+// set, so the kernel marks every packet don't-fragment and refuses sizes
+// above the MTU it already knows for the route.
+type icmpPMTUSender struct {
+	conn       net.PacketConn
+	privileged bool
+	id         int
+	seq        int
+	timeout    time.Duration
+	buf        []byte
+}
+
+// dialPMTUSender tries a raw ICMP socket first, then an unprivileged
+// datagram ICMP socket. Only raw sockets see "fragmentation needed"
+// replies directly; on datagram sockets the kernel still records the
+// reported MTU, so a retry of the same size fails with EMSGSIZE instead.
+func dialPMTUSender(timeout time.Duration) (pmtuSender, error) {
+	s := &icmpPMTUSender{
+		id:      rand.Intn(0xffff),
+		timeout: timeout,
+		buf:     make([]byte, 1<<16),
+	}
+
+	if conn, err := net.ListenPacket("ip4:icmp", "0.0.0.0"); err == nil {
+		if err := setDontFragment(conn.(*net.IPConn)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		s.conn = conn
+		s.privileged = true
+		return s, nil
+	}
+
+	conn, err := listenDatagramICMP()
+	if err != nil {
+		return nil, err
+	}
+	s.conn = conn
+	return s, nil
+}
+
+// listenDatagramICMP opens an unprivileged ICMP "ping" socket the way
+// x/net/icmp does, but sets IP_PMTUDISC_DO before handing it to net.
+func listenDatagramICMP() (net.PacketConn, error) {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, syscall.IPPROTO_ICMP)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_DO); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("setsockopt", err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrInet4{}); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+
+	f := os.NewFile(uintptr(fd), "icmp")
+	defer f.Close()
+	return net.FilePacketConn(f)
+}
+
+// setDontFragment sets IP_PMTUDISC_DO on conn.
+func setDontFragment(conn *net.IPConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_DO)
+	})
+	if err != nil {
+		return err
+	}
+	if sockErr != nil {
+		return os.NewSyscallError("setsockopt", sockErr)
+	}
+	return nil
+}
+
+func (s *icmpPMTUSender) Send(dst net.IP, size int) (pmtuOutcome, int, error) {
+	payload := size - ipv4.HeaderLen - 8
+	if payload < 0 {
+		return pmtuLost, 0, fmt.Errorf("probe size %d too small", size)
+	}
+
+	s.seq = (s.seq + 1) & 0xffff
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Body: &icmp.Echo{
+			ID:   s.id,
+			Seq:  s.seq,
+			Data: make([]byte, payload),
+		},
+	}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return pmtuLost, 0, fmt.Errorf("marshal echo request: %w", err)
+	}
+
+	var addr net.Addr = &net.IPAddr{IP: dst}
+	if !s.privileged {
+		addr = &net.UDPAddr{IP: dst}
+	}
+	if _, err := s.conn.WriteTo(b, addr); err != nil {
+		if errors.Is(err, syscall.EMSGSIZE) {
+			return pmtuTooBig, 0, nil
+		}
+		return pmtuLost, 0, err
+	}
+
+	if err := s.conn.SetReadDeadline(time.Now().Add(s.timeout)); err != nil {
+		return pmtuLost, 0, fmt.Errorf("set read deadline: %w", err)
+	}
+
+	for {
+		n, _, err := s.conn.ReadFrom(s.buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return pmtuLost, 0, nil
+			}
+			return pmtuLost, 0, fmt.Errorf("read reply: %w", err)
+		}
+
+		outcome, id, seq, mtu, ok := parsePMTUReply(s.buf[:n])
+		// Datagram sockets rewrite the echo ID, so only raw sockets can
+		// check it.
+		if !ok || seq != s.seq || (s.privileged && id != s.id) {
+			continue
+		}
+		return outcome, mtu, nil
+	}
+}
+
+func (s *icmpPMTUSender) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package probe
+
+import (
+	"errors"
+	"time"
+)
+
+// dialPMTUSender needs a portable way to force the don't-fragment bit,
+// which only the Linux implementation has.
+func dialPMTUSender(timeout time.Duration) (pmtuSender, error) {
+	return nil, errors.New("path MTU discovery is only supported on Linux")
+}
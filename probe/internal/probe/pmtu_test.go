@@ -0,0 +1,215 @@
+package probe
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// fakePath is a pmtuSender for a path that carries packets up to mtu
+// bytes. Larger packets are reported too big, quoting mtu when quoteMTU is
+// set, or silently dropped when blackhole is set.
+type fakePath struct {
+	mtu       int
+	blackhole bool
+	quoteMTU  bool
+	// dropFirst loses the first probe of each listed size.
+	dropFirst map[int]bool
+	err       error
+	sent      []int
+}
+
+func (f *fakePath) Send(dst net.IP, size int) (pmtuOutcome, int, error) {
+	if f.err != nil {
+		return pmtuLost, 0, f.err
+	}
+	f.sent = append(f.sent, size)
+	if f.dropFirst[size] {
+		delete(f.dropFirst, size)
+		return pmtuLost, 0, nil
+	}
+	switch {
+	case size <= f.mtu:
+		return pmtuDelivered, 0, nil
+	case f.blackhole:
+		return pmtuLost, 0, nil
+	case f.quoteMTU:
+		return pmtuTooBig, f.mtu, nil
+	}
+	return pmtuTooBig, 0, nil
+}
+
+func (f *fakePath) Close() error { return nil }
+
+func TestPMTUDiscover(t *testing.T) {
+	tests := []struct {
+		name          string
+		path          *fakePath
+		maxSize       int
+		wantMTU       int
+		wantBlackhole bool
+		wantErr       bool
+		// maxSends bounds the probes sent, when the case is about how
+		// quickly discovery converges.
+		maxSends int
+	}{
+		{
+			name:     "full size path stops after one probe at the maximum",
+			path:     &fakePath{mtu: 1500},
+			maxSize:  1500,
+			wantMTU:  1500,
+			maxSends: 2,
+		},
+		{
+			name:    "router reports too big without a next-hop MTU",
+			path:    &fakePath{mtu: 1492},
+			maxSize: 1500,
+			wantMTU: 1492,
+		},
+		{
+			name:    "router quotes the next-hop MTU",
+			path:    &fakePath{mtu: 1400, quoteMTU: true},
+			maxSize: 1500,
+			wantMTU: 1400,
+		},
+		{
+			name:          "black hole drops oversized packets silently",
+			path:          &fakePath{mtu: 1420, blackhole: true},
+			maxSize:       1500,
+			wantMTU:       1420,
+			wantBlackhole: true,
+		},
+		{
+			name:     "single lost probe is retried rather than taken as a limit",
+			path:     &fakePath{mtu: 1500, dropFirst: map[int]bool{1500: true}},
+			maxSize:  1500,
+			wantMTU:  1500,
+			maxSends: 3,
+		},
+		{
+			name:    "jumbo frames",
+			path:    &fakePath{mtu: 9000},
+			maxSize: 9000,
+			wantMTU: 9000,
+		},
+		{
+			name:    "unreachable target",
+			path:    &fakePath{mtu: 0, blackhole: true},
+			maxSize: 1500,
+			wantErr: true,
+		},
+		{
+			name:    "send error",
+			path:    &fakePath{mtu: 1500, err: errors.New("network is unreachable")},
+			maxSize: 1500,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPMTUProbe(nil, tt.maxSize, 0)
+			mtu, blackhole, err := p.discover(tt.path, net.IPv4(192, 0, 2, 1))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got MTU %d, want an error", mtu)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("discover: %v", err)
+			}
+			if mtu != tt.wantMTU || blackhole != tt.wantBlackhole {
+				t.Errorf("got MTU %d black hole %v, want %d and %v", mtu, blackhole, tt.wantMTU, tt.wantBlackhole)
+			}
+			if tt.maxSends > 0 && len(tt.path.sent) > tt.maxSends {
+				t.Errorf("sent %v, want at most %d probes", tt.path.sent, tt.maxSends)
+			}
+		})
+	}
+}
+
+func TestParsePMTUReply(t *testing.T) {
+	echo := marshalICMP(t, icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: 9, Seq: 3}})
+	fragNeeded := func(code, mtu int, quoted []byte) []byte {
+		b := marshalICMP(t, icmp.Message{
+			Type: ipv4.ICMPTypeDestinationUnreachable,
+			Code: code,
+			Body: &icmp.DstUnreach{Data: quoteIPv4(quoted)},
+		})
+		binary.BigEndian.PutUint16(b[6:8], uint16(mtu))
+		return b
+	}
+
+	tests := []struct {
+		name        string
+		reply       []byte
+		wantOutcome pmtuOutcome
+		wantID      int
+		wantSeq     int
+		wantMTU     int
+		wantOK      bool
+	}{
+		{
+			name:        "echo reply",
+			reply:       marshalICMP(t, icmp.Message{Type: ipv4.ICMPTypeEchoReply, Body: &icmp.Echo{ID: 9, Seq: 3}}),
+			wantOutcome: pmtuDelivered,
+			wantID:      9,
+			wantSeq:     3,
+			wantOK:      true,
+		},
+		{
+			name:        "fragmentation needed",
+			reply:       fragNeeded(4, 1400, echo),
+			wantOutcome: pmtuTooBig,
+			wantID:      9,
+			wantSeq:     3,
+			wantMTU:     1400,
+			wantOK:      true,
+		},
+		{
+			name:        "fragmentation needed without a next-hop MTU",
+			reply:       fragNeeded(4, 0, echo),
+			wantOutcome: pmtuTooBig,
+			wantID:      9,
+			wantSeq:     3,
+			wantOK:      true,
+		},
+		{
+			name:  "other unreachable code",
+			reply: fragNeeded(1, 0, echo),
+		},
+		{
+			name:  "fragmentation needed quoting another protocol",
+			reply: fragNeeded(4, 1400, make([]byte, 8)),
+		},
+		{
+			name:  "own echo request",
+			reply: echo,
+		},
+		{
+			name:  "truncated",
+			reply: echo[:4],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcome, id, seq, mtu, ok := parsePMTUReply(tt.reply)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if outcome != tt.wantOutcome || id != tt.wantID || seq != tt.wantSeq || mtu != tt.wantMTU {
+				t.Errorf("got outcome %d id %d seq %d mtu %d, want %d %d %d %d",
+					outcome, id, seq, mtu, tt.wantOutcome, tt.wantID, tt.wantSeq, tt.wantMTU)
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package probe
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// proxyHeaders are response headers added by common caching and filtering
+// proxies. Connectivity-check endpoints are served straight from their
+// origins, so seeing one means something in the path rewrote the reply.
+var proxyHeaders = []string{"Via", "X-Cache", "X-Cache-Lookup", "X-Squid-Error", "X-BlueCoat-Via"}
+
+// PortalCheck is a plain-HTTP URL with a known response. An empty Body
+// means the response must have no body; otherwise it must contain Body.
+type PortalCheck struct {
+	URL    string
+	Status int
+	Body   string
+}
+
+// TLSPin is a TLS endpoint (host:port) whose chain must verify against
+// the system roots and, when Fingerprints are given, include a
+// certificate whose base64 SHA-256 SPKI fingerprint is listed.
+type TLSPin struct {
+	Host         string
+	Fingerprints []string
+}
+
+// PortalProbe detects networks that get in the way of browsing even when
+// latency looks fine: captive portals that redirect or replace known
+// responses, middleboxes that inject content or proxy HTTP transparently,
+// and TLS interception that presents its own certificates. Each check
+// yields a measurement; findings appearing or clearing are reported as
+// events.
+type PortalProbe struct {
+	checks  []PortalCheck
+	pins    []TLSPin
+	timeout time.Duration
+	client  *http.Client
+	onEvent EventHandler
+	tracker *changeTracker
+}
+
+// NewPortalProbe creates a probe that reports changes in findings to
+// onEvent.
+func NewPortalProbe(checks []PortalCheck, pins []TLSPin, timeout time.Duration, onEvent EventHandler) *PortalProbe {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &PortalProbe{
+		checks:  checks,
+		pins:    pins,
+		timeout: timeout,
+		client: &http.Client{
+			Timeout: timeout,
+			// A portal's redirect is the evidence; don't follow it.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+			// Go straight to the network so a configured proxy isn't
+			// mistaken for a transparent one.
+			Transport: &http.Transport{
+				Proxy:             nil,
+				DisableKeepAlives: true,
+			},
+		},
+		onEvent: onEvent,
+		tracker: newChangeTracker(),
+	}
+}
+
+// Restore seeds the last known findings from previously stored events so
+// that a change across a restart is still reported.
+func (p *PortalProbe) Restore(events []Event) {
+	p.tracker.restore(events)
+}
+
+func (p *PortalProbe) Type() ProbeType {
+	return ProbeTypePortal
+}
+
+// portalFinding accumulates one kind of finding across checks.
+type portalFinding struct {
+	checked bool
+	details []string
+}
+
+func (f *portalFinding) add(found bool, detail string) *bool {
+	f.checked = true
+	if found {
+		f.details = append(f.details, detail)
+	}
+	return Bool(found)
+}
+
+func (p *PortalProbe) Run(ctx context.Context) ([]Measurement, error) {
+	findings := map[EventType]*portalFinding{
+		EventCaptivePortal:    {},
+		EventContentInjected:  {},
+		EventTransparentProxy: {},
+		EventTLSInterception:  {},
+	}
+
+	var results []Measurement
+	var errs []error
+	for _, check := range p.checks {
+		m, err := p.checkHTTP(ctx, check, findings)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", check.URL, err))
+			continue
+		}
+		results = append(results, m)
+	}
+	for _, pin := range p.pins {
+		m, err := p.checkTLS(ctx, pin, findings)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", pin.Host, err))
+			continue
+		}
+		results = append(results, m)
+	}
+
+	if len(results) == 0 && len(errs) > 0 {
+		return nil, fmt.Errorf("all checks failed: %v", errs)
+	}
+
+	p.report(time.Now(), findings)
+	return results, nil
+}
+
+// checkHTTP fetches a known-content URL and classifies any difference.
+func (p *PortalProbe) checkHTTP(ctx context.Context, check PortalCheck, findings map[EventType]*portalFinding) (Measurement, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", check.URL, nil)
+	if err != nil {
+		return Measurement{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Measurement{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return Measurement{}, fmt.Errorf("failed to read body: %w", err)
+	}
+	total := time.Since(start)
+
+	// A different status, usually a redirect to a login page, is a portal.
+	// The right status with the wrong body means the content was altered.
+	portal := resp.StatusCode != check.Status
+	portalDetail := fmt.Sprintf("%s returned %d, want %d", check.URL, resp.StatusCode, check.Status)
+	if location := resp.Header.Get("Location"); location != "" {
+		portalDetail += " redirecting to " + location
+	}
+
+	injected := false
+	if !portal {
+		if check.Body == "" {
+			injected = len(strings.TrimSpace(string(body))) > 0
+		} else {
+			injected = !strings.Contains(string(body), check.Body)
+		}
+	}
+
+	var proxied []string
+	for _, h := range proxyHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			proxied = append(proxied, h+": "+v)
+		}
+	}
+
+	return Measurement{
+		Timestamp:        time.Now(),
+		ProbeType:        ProbeTypePortal,
+		Target:           check.URL,
+		StatusCode:       Int(resp.StatusCode),
+		TotalTime:        F64(durationMs(total)),
+		CaptivePortal:    findings[EventCaptivePortal].add(portal, portalDetail),
+		ContentInjected:  findings[EventContentInjected].add(injected, check.URL+" body differs from expected content"),
+		TransparentProxy: findings[EventTransparentProxy].add(len(proxied) > 0, check.URL+" "+strings.Join(proxied, ", ")),
+	}, nil
+}
+
+// checkTLS handshakes with a pinned endpoint and flags a chain that does
+// not verify against the system roots or carries none of the pinned keys.
+func (p *PortalProbe) checkTLS(ctx context.Context, pin TLSPin, findings map[EventType]*portalFinding) (Measurement, error) {
+	host, _, err := net.SplitHostPort(pin.Host)
+	if err != nil {
+		return Measurement{}, fmt.Errorf("invalid host: %w", err)
+	}
+
+	// Verification happens below so that a failure is a finding rather
+	// than a connection error.
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: p.timeout},
+		Config: &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: true,
+		},
+	}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", pin.Host)
+	if err != nil {
+		return Measurement{}, err
+	}
+	defer conn.Close()
+	handshake := time.Since(start)
+
+	chain := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	intercepted, detail := checkChain(host, chain, pin.Fingerprints)
+
+	return Measurement{
+		Timestamp:      time.Now(),
+		ProbeType:      ProbeTypePortal,
+		Target:         pin.Host,
+		TLSTime:        F64(durationMs(handshake)),
+		TLSIntercepted: findings[EventTLSInterception].add(intercepted, pin.Host+" "+detail),
+	}, nil
+}
+
+// checkChain reports whether a presented chain looks intercepted, with a
+// description of why.
+func checkChain(host string, chain []*x509.Certificate, fingerprints []string) (bool, string) {
+	if len(chain) == 0 {
+		return true, "presented no certificate"
+	}
+	leaf := chain[0]
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		return true, fmt.Sprintf("chain issued by %q does not verify: %v", leaf.Issuer.String(), err)
+	}
+
+	if len(fingerprints) == 0 {
+		return false, ""
+	}
+	for _, cert := range chain {
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		fp := base64.StdEncoding.EncodeToString(sum[:])
+		for _, want := range fingerprints {
+			if fp == want {
+				return false, ""
+			}
+		}
+	}
+	return true, fmt.Sprintf("chain issued by %q matches no pinned key", leaf.Issuer.String())
+}
+
+// report turns findings that appeared or cleared into events. Kinds no
+// check could evaluate keep their previous state, and a first run that
+// finds nothing stays quiet.
+func (p *PortalProbe) report(ts time.Time, findings map[EventType]*portalFinding) {
+	var events []Event
+	for _, typ := range []EventType{EventCaptivePortal, EventContentInjected, EventTransparentProxy, EventTLSInterception} {
+		f := findings[typ]
+		if !f.checked {
+			continue
+		}
+		found := len(f.details) > 0
+		e, changed := p.tracker.update(ts, typ, strconv.FormatBool(found), strings.Join(f.details, "; "))
+		if changed && (found || e.Previous != "") {
+			events = append(events, e)
+		}
+	}
+
+	if len(events) > 0 && p.onEvent != nil {
+		p.onEvent(events)
+	}
+}
@@ -0,0 +1,193 @@
+package probe
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func newPortalFindings() map[EventType]*portalFinding {
+	return map[EventType]*portalFinding{
+		EventCaptivePortal:    {},
+		EventContentInjected:  {},
+		EventTransparentProxy: {},
+		EventTLSInterception:  {},
+	}
+}
+
+func TestPortalProbeCheckHTTP(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/generate_204", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/portal", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://login.hotel.example/", http.StatusFound)
+	})
+	mux.HandleFunc("/success.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<script src=\"http://ads.example/x.js\"></script>success\n"))
+	})
+	mux.HandleFunc("/injected.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body>Data limit reached</body></html>"))
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<script>track()</script>"))
+	})
+	mux.HandleFunc("/cached", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Via", "1.1 squid (squid/5.7)")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		name         string
+		check        PortalCheck
+		wantStatus   int
+		wantPortal   bool
+		wantInjected bool
+		wantProxy    bool
+		wantDetail   string
+	}{
+		{name: "open network", check: PortalCheck{URL: "/generate_204", Status: 204}, wantStatus: 204},
+		{
+			name:       "portal redirect",
+			check:      PortalCheck{URL: "/portal", Status: 204},
+			wantStatus: 302,
+			wantPortal: true,
+			wantDetail: "redirecting to http://login.hotel.example/",
+		},
+		{name: "expected text among additions", check: PortalCheck{URL: "/success.txt", Status: 200, Body: "success"}, wantStatus: 200},
+		{
+			name:         "body replaced",
+			check:        PortalCheck{URL: "/injected.txt", Status: 200, Body: "success"},
+			wantStatus:   200,
+			wantInjected: true,
+			wantDetail:   "body differs",
+		},
+		{
+			name:         "body where none is expected",
+			check:        PortalCheck{URL: "/empty", Status: 200},
+			wantStatus:   200,
+			wantInjected: true,
+			wantDetail:   "body differs",
+		},
+		{
+			name:       "proxy header",
+			check:      PortalCheck{URL: "/cached", Status: 204},
+			wantStatus: 204,
+			wantProxy:  true,
+			wantDetail: "Via: 1.1 squid",
+		},
+	}
+
+	p := NewPortalProbe(nil, nil, 0, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check.URL = srv.URL + tt.check.URL
+			findings := newPortalFindings()
+			m, err := p.checkHTTP(context.Background(), tt.check, findings)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if m.ProbeType != ProbeTypePortal || m.Target != tt.check.URL || m.TotalTime == nil {
+				t.Errorf("got %s measurement of %q taking %v", m.ProbeType, m.Target, deref(m.TotalTime))
+			}
+			if m.StatusCode == nil || *m.StatusCode != tt.wantStatus {
+				t.Errorf("status = %v, want %d", deref(m.StatusCode), tt.wantStatus)
+			}
+			if *m.CaptivePortal != tt.wantPortal || *m.ContentInjected != tt.wantInjected || *m.TransparentProxy != tt.wantProxy {
+				t.Errorf("portal %v injected %v proxy %v, want %v %v %v", *m.CaptivePortal, *m.ContentInjected,
+					*m.TransparentProxy, tt.wantPortal, tt.wantInjected, tt.wantProxy)
+			}
+
+			var details []string
+			for _, f := range findings {
+				details = append(details, f.details...)
+			}
+			if tt.wantDetail == "" && len(details) > 0 {
+				t.Errorf("got findings %q, want none", details)
+			}
+			if tt.wantDetail != "" && (len(details) != 1 || !strings.Contains(details[0], tt.wantDetail)) {
+				t.Errorf("got findings %q, want one mentioning %q", details, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestCheckChain(t *testing.T) {
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+
+	if intercepted, detail := checkChain("example.com", nil, nil); !intercepted || detail != "presented no certificate" {
+		t.Errorf("empty chain: intercepted %v %q", intercepted, detail)
+	}
+
+	// The test server's self-signed certificate is what an intercepting
+	// middlebox presents when its root is not installed.
+	intercepted, detail := checkChain("example.com", []*x509.Certificate{srv.Certificate()}, nil)
+	if !intercepted || !strings.Contains(detail, "Acme Co") || !strings.Contains(detail, "does not verify") {
+		t.Errorf("untrusted chain: intercepted %v %q", intercepted, detail)
+	}
+}
+
+// TestCheckChainTrustedRoot covers chains that verify by re-running itself
+// with the test server's certificate as a system root, which Go reads from
+// SSL_CERT_FILE on Linux.
+func TestCheckChainTrustedRoot(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("SSL_CERT_FILE only sets the system roots on Linux")
+	}
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	cert := srv.Certificate()
+
+	if os.Getenv("NETPULSE_TEST_TRUSTED_ROOT") == "" {
+		roots := filepath.Join(t.TempDir(), "roots.pem")
+		if err := os.WriteFile(roots, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command(os.Args[0], "-test.run=^TestCheckChainTrustedRoot$")
+		cmd.Env = append(os.Environ(), "NETPULSE_TEST_TRUSTED_ROOT=1", "SSL_CERT_FILE="+roots)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v\n%s", err, out)
+		}
+		return
+	}
+
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	pinned := base64.StdEncoding.EncodeToString(sum[:])
+	other := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	tests := []struct {
+		name            string
+		host            string
+		fingerprints    []string
+		wantIntercepted bool
+		wantDetail      string
+	}{
+		{name: "trusted chain", host: "example.com"},
+		{name: "pinned key present", host: "example.com", fingerprints: []string{other, pinned}},
+		{name: "pinned key missing", host: "example.com", fingerprints: []string{other}, wantIntercepted: true, wantDetail: "matches no pinned key"},
+		{name: "wrong host", host: "www.google.com", wantIntercepted: true, wantDetail: "does not verify"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			intercepted, detail := checkChain(tt.host, []*x509.Certificate{cert}, tt.fingerprints)
+			if intercepted != tt.wantIntercepted || !strings.Contains(detail, tt.wantDetail) {
+				t.Errorf("intercepted %v %q, want %v mentioning %q", intercepted, detail, tt.wantIntercepted, tt.wantDetail)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// cgnatRange is the RFC 6598 shared address space used by carrier-grade
+// NAT between subscribers and the carrier's translators.
+var cgnatRange = netip.MustParsePrefix("100.64.0.0/10")
+
+// PublicIPOptions selects how PublicIPProbe learns the egress address.
+type PublicIPOptions struct {
+	// EchoURL returns the caller's address, either as the whole body or
+	// as an "ip=" line like Cloudflare's /cdn-cgi/trace.
+	EchoURL string
+	// STUNServer (host:port), when set, is used instead of EchoURL.
+	STUNServer string
+	// ASNDatabase is a MaxMind-format ASN database (e.g. GeoLite2-ASN)
+	// used to name the ISP. Empty skips the lookup.
+	ASNDatabase string
+	Timeout     time.Duration
+}
+
+// PublicIPProbe tracks the probe's public egress address, the network it
+// belongs to and whether it sits behind carrier-grade NAT. Each run yields
+// a measurement; changes since the previous run are also reported as
+// events, since a new address often follows an outage or re-provisioning.
+type PublicIPProbe struct {
+	opts    PublicIPOptions
+	client  *http.Client
+	onEvent EventHandler
+	tracker *changeTracker
+}
+
+// NewPublicIPProbe creates a probe that reports changes to onEvent.
+func NewPublicIPProbe(opts PublicIPOptions, onEvent EventHandler) *PublicIPProbe {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	return &PublicIPProbe{
+		opts: opts,
+		client: &http.Client{
+			Timeout: opts.Timeout,
+		},
+		onEvent: onEvent,
+		tracker: newChangeTracker(),
+	}
+}
+
+// Restore seeds the last known values from previously stored events so
+// that a change across a restart is still reported.
+func (p *PublicIPProbe) Restore(events []Event) {
+	p.tracker.restore(events)
+}
+
+func (p *PublicIPProbe) Type() ProbeType {
+	return ProbeTypePublicIP
+}
+
+func (p *PublicIPProbe) Run(ctx context.Context) ([]Measurement, error) {
+	var public, local net.IP
+	var err error
+	target := p.opts.EchoURL
+	if p.opts.STUNServer != "" {
+		target = p.opts.STUNServer
+		public, local, err = stunMappedAddress(ctx, p.opts.STUNServer, p.opts.Timeout)
+	} else {
+		public, local, err = p.echoAddress(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := Measurement{
+		Timestamp: time.Now(),
+		ProbeType: ProbeTypePublicIP,
+		Target:    target,
+		PublicIP:  public.String(),
+		IPFamily:  ipFamily(public),
+		CGNAT:     detectCGNAT(local, public),
+	}
+
+	// A missing or unreadable database only costs the ISP name; the
+	// address itself is still worth recording.
+	if p.opts.ASNDatabase != "" {
+		if asn, org, err := lookupASN(p.opts.ASNDatabase, public); err == nil {
+			m.ASN = Int(asn)
+			m.ASOrg = org
+		}
+	}
+
+	p.report(m)
+	return []Measurement{m}, nil
+}
+
+// echoAddress fetches the echo URL and returns the address it reports
+// along with the local address of the connection that carried it.
+func (p *PublicIPProbe) echoAddress(ctx context.Context) (public, local net.IP, err error) {
+	ctx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+	defer cancel()
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if addr, ok := info.Conn.LocalAddr().(*net.TCPAddr); ok {
+				local = addr.IP
+			}
+		},
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), "GET", p.opts.EchoURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("echo request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("echo URL returned %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read echo response: %w", err)
+	}
+
+	public = parseEchoBody(string(body))
+	if public == nil {
+		return nil, nil, fmt.Errorf("echo response has no IP address")
+	}
+	return public, local, nil
+}
+
+// parseEchoBody accepts a bare address or key=value lines with an ip key.
+func parseEchoBody(body string) net.IP {
+	if ip := net.ParseIP(strings.TrimSpace(body)); ip != nil {
+		return ip
+	}
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "ip="); ok {
+			return net.ParseIP(value)
+		}
+	}
+	return nil
+}
+
+// detectCGNAT reports whether the path to the internet crosses a carrier
+// NAT: the interface address is in the RFC 6598 shared range, or it is a
+// public IPv4 address that still gets translated on the way out. A private
+// interface address only proves a home NAT, so it yields false. It returns
+// nil when the local address is unknown.
+func detectCGNAT(local, public net.IP) *bool {
+	if local == nil {
+		return nil
+	}
+	localAddr, ok := netip.AddrFromSlice(local)
+	if !ok {
+		return nil
+	}
+	localAddr = localAddr.Unmap()
+	if !localAddr.Is4() || public.To4() == nil {
+		return Bool(false)
+	}
+
+	if cgnatRange.Contains(localAddr) {
+		return Bool(true)
+	}
+	translated := !local.Equal(public)
+	return Bool(translated && localAddr.IsGlobalUnicast() && !localAddr.IsPrivate())
+}
+
+// asnRecord is the part of a GeoLite2-ASN record the probe uses.
+type asnRecord struct {
+	Number       int    `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// lookupASN finds ip's autonomous system in a MaxMind-format database. The
+// file is reopened on every lookup so database updates are picked up
+// without a restart.
+func lookupASN(path string, ip net.IP) (int, string, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to open ASN database: %w", err)
+	}
+	defer db.Close()
+
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return 0, "", fmt.Errorf("invalid address %s", ip)
+	}
+
+	var record asnRecord
+	result := db.Lookup(addr.Unmap())
+	if !result.Found() {
+		return 0, "", fmt.Errorf("%s not found in ASN database", ip)
+	}
+	if err := result.Decode(&record); err != nil {
+		return 0, "", fmt.Errorf("failed to decode ASN record: %w", err)
+	}
+	return record.Number, record.Organization, nil
+}
+
+// report compares m with the last known values and sends an event for
+// each one that changed.
+func (p *PublicIPProbe) report(m Measurement) {
+	current := map[EventType]string{
+		EventPublicIPChanged: m.PublicIP,
+	}
+	if m.ASN != nil {
+		current[EventASNChanged] = "AS" + strconv.Itoa(*m.ASN)
+	}
+	if m.CGNAT != nil {
+		current[EventCGNATChanged] = strconv.FormatBool(*m.CGNAT)
+	}
+
+	var events []Event
+	for _, typ := range []EventType{EventPublicIPChanged, EventASNChanged, EventCGNATChanged} {
+		value, ok := current[typ]
+		if !ok {
+			continue
+		}
+		if e, changed := p.tracker.update(m.Timestamp, typ, value, m.ASOrg); changed {
+			events = append(events, e)
+		}
+	}
+
+	if len(events) > 0 && p.onEvent != nil {
+		p.onEvent(events)
+	}
+}
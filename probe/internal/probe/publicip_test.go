@@ -0,0 +1,127 @@
+package probe
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestParseEchoBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "bare IPv4", body: "203.0.113.7\n", want: "203.0.113.7"},
+		{name: "bare IPv6", body: "  2001:db8::7 ", want: "2001:db8::7"},
+		{
+			name: "Cloudflare trace",
+			body: "fl=123f45\nh=www.cloudflare.com\nip=198.51.100.23\nts=1700000000.123\nvisit_scheme=https\n",
+			want: "198.51.100.23",
+		},
+		{name: "no ip line", body: "h=www.cloudflare.com\nloc=NL\n"},
+		{name: "HTML error page", body: "<html><body>Service Unavailable</body></html>"},
+		{name: "empty", body: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseEchoBody(tt.body)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("got %v, want no address", got)
+				}
+				return
+			}
+			if !got.Equal(net.ParseIP(tt.want)) {
+				t.Errorf("got %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectCGNAT(t *testing.T) {
+	tests := []struct {
+		name          string
+		local, public string
+		want          *bool
+	}{
+		{name: "local address unknown", public: "203.0.113.7"},
+		{name: "shared address space", local: "100.72.10.5", public: "203.0.113.7", want: Bool(true)},
+		{name: "IPv4-mapped shared address", local: "::ffff:100.64.0.1", public: "203.0.113.7", want: Bool(true)},
+		{name: "public address translated again", local: "198.51.100.4", public: "203.0.113.7", want: Bool(true)},
+		{name: "public address used as is", local: "203.0.113.7", public: "203.0.113.7", want: Bool(false)},
+		{name: "home NAT", local: "192.168.1.20", public: "203.0.113.7", want: Bool(false)},
+		{name: "IPv6 egress", local: "2001:db8::20", public: "2001:db8::20", want: Bool(false)},
+		{name: "IPv4 interface with IPv6 egress", local: "100.72.10.5", public: "2001:db8::20", want: Bool(false)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := detectCGNAT(net.ParseIP(tt.local), net.ParseIP(tt.public))
+			if !equalBool(got, tt.want) {
+				t.Errorf("got %v, want %v", deref(got), deref(tt.want))
+			}
+		})
+	}
+}
+
+func TestPublicIPProbeEcho(t *testing.T) {
+	var mu sync.Mutex
+	address := "203.0.113.7"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		io.WriteString(w, "fl=123f45\nip="+address+"\nvisit_scheme=http\n")
+	}))
+	defer srv.Close()
+
+	var events []Event
+	p := NewPublicIPProbe(PublicIPOptions{EchoURL: srv.URL}, func(e []Event) { events = append(events, e...) })
+	p.Restore([]Event{{Type: EventPublicIPChanged, Current: "203.0.113.7"}})
+
+	run := func() Measurement {
+		t.Helper()
+		ms, err := p.Run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ms) != 1 {
+			t.Fatalf("got %d measurements, want 1", len(ms))
+		}
+		return ms[0]
+	}
+
+	m := run()
+	if m.ProbeType != ProbeTypePublicIP || m.Target != srv.URL || m.PublicIP != address || m.IPFamily != FamilyIPv4 {
+		t.Errorf("got %s measurement of %q: %s over %s", m.ProbeType, m.Target, m.PublicIP, m.IPFamily)
+	}
+	// The connection leaves from loopback, which no carrier translates.
+	if m.CGNAT == nil || *m.CGNAT {
+		t.Errorf("CGNAT = %v, want false", deref(m.CGNAT))
+	}
+	for _, e := range events {
+		if e.Type == EventPublicIPChanged {
+			t.Errorf("restored address reported as changed: %+v", e)
+		}
+	}
+
+	mu.Lock()
+	address = "198.51.100.23"
+	mu.Unlock()
+	events = nil
+	run()
+	if len(events) != 1 || events[0].Type != EventPublicIPChanged ||
+		events[0].Previous != "203.0.113.7" || events[0].Current != "198.51.100.23" {
+		t.Errorf("got events %+v, want one public IP change", events)
+	}
+
+	srv.Close()
+	if _, err := p.Run(context.Background()); err == nil {
+		t.Error("Run succeeded with the echo server down")
+	}
+}
@@ -0,0 +1,245 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// QUICProbe compares QUIC handshakes against TCP+TLS to the same address.
+// Networks that throttle or drop UDP/443 push browsers and call apps back
+// onto TCP, which hurts real-time traffic while ICMP looks healthy. A QUIC
+// handshake that times out while TCP+TLS succeeds is recorded as UDP
+// blocked rather than as a failure.
+type QUICProbe struct {
+	targets []string
+	timeout time.Duration
+	// ticketWait is how long to wait after the first handshake for a
+	// session ticket to resume with.
+	ticketWait time.Duration
+	// rootCAs verifies QUIC servers; nil means the system roots.
+	rootCAs *x509.CertPool
+}
+
+// NewQUICProbe handshakes with each host:port target over QUIC (HTTP/3)
+// and TCP+TLS.
+func NewQUICProbe(targets []string) *QUICProbe {
+	return &QUICProbe{
+		targets:    targets,
+		timeout:    10 * time.Second,
+		ticketWait: time.Second,
+	}
+}
+
+func (p *QUICProbe) Type() ProbeType {
+	return ProbeTypeQUIC
+}
+
+func (p *QUICProbe) Run(ctx context.Context) ([]Measurement, error) {
+	var wg sync.WaitGroup
+	results := make([]Measurement, len(p.targets))
+	errors := make([]error, len(p.targets))
+
+	for i, target := range p.targets {
+		wg.Add(1)
+		go func(idx int, tgt string) {
+			defer wg.Done()
+			measurement, err := p.compare(ctx, tgt)
+			if err != nil {
+				errors[idx] = err
+				return
+			}
+			results[idx] = measurement
+		}(i, target)
+	}
+
+	wg.Wait()
+
+	var validResults []Measurement
+	var errs []error
+	for i, result := range results {
+		if errors[i] != nil {
+			errs = append(errs, fmt.Errorf("target %s: %w", p.targets[i], errors[i]))
+		} else {
+			validResults = append(validResults, result)
+		}
+	}
+
+	if len(validResults) == 0 && len(errs) > 0 {
+		return nil, fmt.Errorf("all targets failed: %v", errs)
+	}
+
+	return validResults, nil
+}
+
+// compare times a TCP+TLS handshake, a full QUIC handshake and a resumed
+// QUIC handshake against the same resolved address. ConnectTime and
+// TLSTime hold the TCP side.
+func (p *QUICProbe) compare(ctx context.Context, target string) (Measurement, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return Measurement{}, fmt.Errorf("invalid target: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*p.timeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return Measurement{}, fmt.Errorf("failed to resolve host: %w", err)
+	}
+	addr := net.JoinHostPort(addrs[0], port)
+
+	m := Measurement{
+		ProbeType: ProbeTypeQUIC,
+		Target:    target,
+	}
+
+	tcpCtx, tcpCancel := context.WithTimeout(ctx, p.timeout)
+	_, connect, handshake, tcpErr := dialTLS(tcpCtx, addr, p.tlsConfig(host, nil, "h2", "http/1.1"))
+	tcpCancel()
+	if tcpErr == nil {
+		m.ConnectTime = F64(durationMs(connect))
+		m.TLSTime = F64(durationMs(handshake))
+	}
+
+	// Resumption needs a ticket from the first connection, which arrives
+	// after its handshake; servers that don't issue one leave the resumed
+	// fields unset.
+	tickets := newTicketCache()
+	gotTicket := false
+	first, err := p.dialQUIC(ctx, addr, p.tlsConfig(host, tickets, "h3"), func() {
+		gotTicket = tickets.wait(p.ticketWait)
+	})
+	switch {
+	case err != nil && isTimeout(err) && tcpErr == nil:
+		m.Timestamp = time.Now()
+		m.UDPBlocked = Bool(true)
+		return m, nil
+	case err != nil && tcpErr != nil:
+		return Measurement{}, fmt.Errorf("QUIC: %v; TCP: %w", err, tcpErr)
+	case err != nil:
+		return Measurement{}, fmt.Errorf("QUIC handshake: %w", err)
+	}
+	m.UDPBlocked = Bool(false)
+	m.QUICHandshake = F64(durationMs(first.handshake))
+	m.QUICVersion = first.version.String()
+
+	if gotTicket {
+		resumed, err := p.dialQUIC(ctx, addr, p.tlsConfig(host, tickets, "h3"), nil)
+		if err == nil {
+			m.QUICResumeHandshake = F64(durationMs(resumed.handshake))
+			m.QUIC0RTT = Bool(resumed.used0RTT)
+		}
+	}
+
+	m.Timestamp = time.Now()
+	return m, nil
+}
+
+// quicDial describes one completed QUIC handshake.
+type quicDial struct {
+	handshake time.Duration
+	version   quic.Version
+	used0RTT  bool
+}
+
+// dialQUIC completes a QUIC handshake with addr, calls linger if set, and
+// closes the connection. Dialing early lets a resumed connection offer
+// 0-RTT; the handshake time still runs until the server confirms it.
+func (p *QUICProbe) dialQUIC(ctx context.Context, addr string, config *tls.Config, linger func()) (quicDial, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return quicDial{}, fmt.Errorf("resolve: %w", err)
+	}
+	udpConn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return quicDial{}, fmt.Errorf("listen: %w", err)
+	}
+	defer udpConn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	start := time.Now()
+	conn, err := quic.DialEarly(ctx, udpConn, raddr, config, &quic.Config{HandshakeIdleTimeout: p.timeout})
+	if err != nil {
+		return quicDial{}, err
+	}
+	defer conn.CloseWithError(0, "")
+
+	select {
+	case <-conn.HandshakeComplete():
+	case <-conn.Context().Done():
+		return quicDial{}, context.Cause(conn.Context())
+	case <-ctx.Done():
+		return quicDial{}, ctx.Err()
+	}
+	handshake := time.Since(start)
+
+	if linger != nil {
+		linger()
+	}
+
+	state := conn.ConnectionState()
+	return quicDial{
+		handshake: handshake,
+		version:   state.Version,
+		used0RTT:  state.Used0RTT,
+	}, nil
+}
+
+func (p *QUICProbe) tlsConfig(serverName string, sessions tls.ClientSessionCache, alpn ...string) *tls.Config {
+	return &tls.Config{
+		ServerName:         serverName,
+		NextProtos:         alpn,
+		RootCAs:            p.rootCAs,
+		ClientSessionCache: sessions,
+	}
+}
+
+// ticketCache is a session cache that signals when a ticket arrives, since
+// QUIC servers send tickets after the handshake completes.
+type ticketCache struct {
+	tls.ClientSessionCache
+	stored chan struct{}
+	once   sync.Once
+}
+
+func newTicketCache() *ticketCache {
+	return &ticketCache{
+		ClientSessionCache: tls.NewLRUClientSessionCache(1),
+		stored:             make(chan struct{}),
+	}
+}
+
+func (c *ticketCache) Put(key string, cs *tls.ClientSessionState) {
+	c.ClientSessionCache.Put(key, cs)
+	if cs != nil {
+		c.once.Do(func() { close(c.stored) })
+	}
+}
+
+// wait reports whether a ticket arrived within timeout.
+func (c *ticketCache) wait(timeout time.Duration) bool {
+	select {
+	case <-c.stored:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// isTimeout reports whether err is a timeout rather than a refusal, which
+// for UDP means packets went unanswered.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
@@ -0,0 +1,159 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// quicTestCert issues a chain for 127.0.0.1 and returns the server
+// certificate along with a pool holding its root.
+func quicTestCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	root, rootKey := issueCert(t, "Test Root", time.Now().Add(24*time.Hour), true, nil, nil)
+	leaf, leafKey := issueCert(t, "127.0.0.1", time.Now().Add(24*time.Hour), false, root, rootKey)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	return tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: leafKey}, roots
+}
+
+// startQUICServer serves QUIC with cert on a loopback UDP port until the
+// test ends, holding each connection open until the client closes it, and
+// returns the address.
+func startQUICServer(t *testing.T, cert tls.Certificate, allow0RTT bool) string {
+	t.Helper()
+	ln, err := quic.ListenAddrEarly("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h3"},
+	}, &quic.Config{Allow0RTT: allow0RTT})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() {
+				<-conn.Context().Done()
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// listenTCPSibling serves TCP+TLS with cert on the TCP port matching addr.
+func listenTCPSibling(t *testing.T, addr string, cert tls.Certificate) {
+	t.Helper()
+	ln, err := tls.Listen("tcp", addr, &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Skipf("TCP port of %s is taken: %v", addr, err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+}
+
+func TestQUICProbeCompare(t *testing.T) {
+	cert, roots := quicTestCert(t)
+
+	// A UDP socket that never answers stands in for a firewall dropping
+	// UDP/443.
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	tests := []struct {
+		name        string
+		addr        string
+		tcp         bool
+		wantBlocked bool
+		wantResumed bool
+		want0RTT    bool
+	}{
+		{name: "0-RTT resumption", addr: startQUICServer(t, cert, true), tcp: true, wantResumed: true, want0RTT: true},
+		{name: "1-RTT resumption", addr: startQUICServer(t, cert, false), tcp: true, wantResumed: true},
+		{name: "QUIC without TCP", addr: startQUICServer(t, cert, true), wantResumed: true, want0RTT: true},
+		{name: "UDP blocked", addr: silent.LocalAddr().String(), tcp: true, wantBlocked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.tcp {
+				listenTCPSibling(t, tt.addr, cert)
+			}
+			p := NewQUICProbe(nil)
+			p.rootCAs = roots
+			p.timeout = 500 * time.Millisecond
+
+			m, err := p.compare(context.Background(), tt.addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if m.ProbeType != ProbeTypeQUIC || m.Target != tt.addr || m.Timestamp.IsZero() {
+				t.Errorf("got %s measurement of %q at %v", m.ProbeType, m.Target, m.Timestamp)
+			}
+			if (m.ConnectTime != nil && m.TLSTime != nil) != tt.tcp {
+				t.Errorf("TCP connect %v handshake %v, want present %v", deref(m.ConnectTime), deref(m.TLSTime), tt.tcp)
+			}
+			if m.UDPBlocked == nil || *m.UDPBlocked != tt.wantBlocked {
+				t.Errorf("UDP blocked = %v, want %v", deref(m.UDPBlocked), tt.wantBlocked)
+			}
+			if tt.wantBlocked {
+				if m.QUICHandshake != nil {
+					t.Errorf("blocked QUIC has handshake time %v", *m.QUICHandshake)
+				}
+				return
+			}
+
+			if m.QUICHandshake == nil || m.QUICVersion != quic.Version1.String() {
+				t.Errorf("QUIC handshake %v over %q", deref(m.QUICHandshake), m.QUICVersion)
+			}
+			if (m.QUICResumeHandshake != nil) != tt.wantResumed {
+				t.Errorf("resumed handshake = %v, want present %v", deref(m.QUICResumeHandshake), tt.wantResumed)
+			}
+			if m.QUIC0RTT == nil || *m.QUIC0RTT != tt.want0RTT {
+				t.Errorf("0-RTT = %v, want %v", deref(m.QUIC0RTT), tt.want0RTT)
+			}
+		})
+	}
+}
+
+func TestQUICProbeUnreachable(t *testing.T) {
+	_, roots := quicTestCert(t)
+
+	// Nothing listens on either protocol, so the QUIC attempt is refused
+	// or times out and TCP is refused.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := conn.LocalAddr().String()
+	conn.Close()
+
+	p := NewQUICProbe([]string{addr})
+	p.rootCAs = roots
+	p.timeout = 300 * time.Millisecond
+	if ms, err := p.Run(context.Background()); err == nil {
+		t.Errorf("got %+v, want an error with nothing listening", ms)
+	}
+}
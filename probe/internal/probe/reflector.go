@@ -0,0 +1,138 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// UDPReflector echoes UDPStreamProbe packets back to their sender, stamped
+// with the time it received them. Replies are the same size as requests
+// and anything without the stream magic is dropped, so the reflector
+// cannot be used to amplify traffic.
+type UDPReflector struct {
+	conn net.PacketConn
+}
+
+// ListenUDPReflector opens a reflector on addr, e.g. ":8620".
+func ListenUDPReflector(addr string) (*UDPReflector, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &UDPReflector{conn: conn}, nil
+}
+
+// Addr returns the address the reflector is listening on.
+func (r *UDPReflector) Addr() net.Addr {
+	return r.conn.LocalAddr()
+}
+
+// Serve reflects packets until ctx is cancelled, then closes the socket.
+func (r *UDPReflector) Serve(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		r.conn.Close()
+	}()
+
+	buf := make([]byte, 64<<10)
+	for {
+		n, peer, err := r.conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		received := time.Now()
+
+		if n < udpStreamHeaderLen || !bytes.Equal(buf[:4], udpStreamMagic) {
+			continue
+		}
+		binary.BigEndian.PutUint64(buf[16:24], uint64(received.UnixNano()))
+		r.conn.WriteTo(buf[:n], peer)
+	}
+}
+
+// TWAMPReflector is a stateless TWAMP-Light Session-Reflector (RFC 5357
+// Appendix I) for carrier peers, CPEs and TWAMPProbe. Each test packet is
+// answered with the reflector's receive and transmit timestamps, the
+// sender's echoed fields and the TTL it arrived with. Packets shorter than
+// a reply are dropped so replies never outgrow requests.
+type TWAMPReflector struct {
+	conn net.PacketConn
+	// ttl reads the received TTL alongside each packet when the platform
+	// supports it; it is nil otherwise.
+	ttl *ipv4.PacketConn
+}
+
+// ListenTWAMPReflector opens a reflector on addr, e.g. ":862".
+func ListenTWAMPReflector(addr string) (*TWAMPReflector, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	r := &TWAMPReflector{conn: conn}
+	pc := ipv4.NewPacketConn(conn)
+	if err := pc.SetControlMessage(ipv4.FlagTTL, true); err == nil {
+		r.ttl = pc
+	}
+	return r, nil
+}
+
+// Addr returns the address the reflector is listening on.
+func (r *TWAMPReflector) Addr() net.Addr {
+	return r.conn.LocalAddr()
+}
+
+// Serve reflects test packets until ctx is cancelled, then closes the
+// socket.
+func (r *TWAMPReflector) Serve(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		r.conn.Close()
+	}()
+
+	buf := make([]byte, 64<<10)
+	reply := make([]byte, 64<<10)
+	for {
+		n, ttl, peer, err := r.read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		received := time.Now()
+
+		if n < twampReplyLen {
+			continue
+		}
+		out := reply[:n]
+		clear(out)
+		copy(out[0:4], buf[0:4])
+		binary.BigEndian.PutUint16(out[12:14], twampErrorEstimate)
+		putNTPTimestamp(out[16:24], received)
+		copy(out[24:38], buf[0:twampSenderHeaderLen])
+		out[40] = byte(ttl)
+		putNTPTimestamp(out[4:12], time.Now())
+		r.conn.WriteTo(out, peer)
+	}
+}
+
+// read receives one packet along with its TTL, which is zero when unknown.
+func (r *TWAMPReflector) read(b []byte) (int, int, net.Addr, error) {
+	if r.ttl == nil {
+		n, peer, err := r.conn.ReadFrom(b)
+		return n, 0, peer, err
+	}
+	n, cm, peer, err := r.ttl.ReadFrom(b)
+	if cm == nil {
+		return n, 0, peer, err
+	}
+	return n, cm.TTL, peer, err
+}
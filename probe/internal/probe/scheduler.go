@@ -2,47 +2,173 @@ package probe
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"math/rand/v2"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // MeasurementHandler is called when new measurements are collected.
 type MeasurementHandler func([]Measurement)
 
+// OverrunPolicy decides what happens when a probe comes due while its
+// previous run is still in progress.
+type OverrunPolicy string
+
+const (
+	// OverrunSkip drops the tick.
+	OverrunSkip OverrunPolicy = "skip"
+	// OverrunQueue runs once more as soon as the current run finishes;
+	// further ticks while one is queued are dropped.
+	OverrunQueue OverrunPolicy = "queue"
+	// OverrunConcurrent starts another run alongside the current one.
+	OverrunConcurrent OverrunPolicy = "concurrent"
+)
+
+// Clock is the scheduler's time source, replaceable in tests.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single-shot timer created by a Clock.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.t.C }
+
+func (t realTimer) Stop() bool { return t.t.Stop() }
+
+// SchedulerOptions tunes how the scheduler paces probes.
+type SchedulerOptions struct {
+	// Timeout cancels a run's context after this long, or after the
+	// probe's current interval if that is shorter; zero means no limit.
+	Timeout time.Duration
+	// StartJitter delays each probe's first run by a random amount up to
+	// this, so probes don't all fire at once and skew each other.
+	StartJitter time.Duration
+	// Jitter delays each later run by a random amount up to this, capped
+	// at half the probe's interval.
+	Jitter time.Duration
+	// Overrun applies when a run is still in progress at the next tick.
+	// The default is OverrunSkip.
+	Overrun OverrunPolicy
+	// Exclusion keeps load-generating probes from distorting passive ones.
+	Exclusion ExclusionGroups
+	// Escalation shortens intervals while the link is degraded; nil keeps
+	// them fixed.
+	Escalation *EscalationPolicy
+	// Timetables restricts when individual probes run. Probes on a cron
+	// schedule keep to it while escalated.
+	Timetables map[ProbeType]Timetable
+	// Clock defaults to the system clock.
+	Clock Clock
+}
+
+// RunStats counts how a probe's scheduled runs went.
+type RunStats struct {
+	// Runs is the number of runs started.
+	Runs int64
+	// Overruns counts ticks that came due while a run was in progress.
+	Overruns int64
+	// Skipped counts ticks that never ran, either dropped by the overrun
+	// policy or missed entirely because the scheduler was held up.
+	Skipped int64
+	// TimedOut counts runs cut off by the timeout.
+	TimedOut int64
+}
+
+type runCounters struct {
+	runs, overruns, skipped, timedOut atomic.Int64
+}
+
 // ScheduledProbe pairs a Prober with its run interval.
 type ScheduledProbe struct {
 	Prober   Prober
 	Interval time.Duration
+
+	stats *runCounters
 }
 
 // Scheduler runs probes on their configured intervals and delivers
 // measurements through a handler callback.
 type Scheduler struct {
-	probes  []ScheduledProbe
-	handler MeasurementHandler
-	logger  *slog.Logger
-	wg      sync.WaitGroup
+	probes     []ScheduledProbe
+	handler    MeasurementHandler
+	opts       SchedulerOptions
+	clock      Clock
+	gate       *loadGate
+	escalation *escalator
+	// random returns a duration in [0, max); it is replaceable in tests.
+	random func(max time.Duration) time.Duration
+	logger *slog.Logger
+	wg     sync.WaitGroup
 }
 
 // NewScheduler creates a scheduler that delivers measurements to handler.
-func NewScheduler(handler MeasurementHandler, logger *slog.Logger) *Scheduler {
+func NewScheduler(handler MeasurementHandler, opts SchedulerOptions, logger *slog.Logger) *Scheduler {
+	if opts.Overrun == "" {
+		opts.Overrun = OverrunSkip
+	}
+	clock := opts.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
 	return &Scheduler{
-		handler: handler,
-		logger:  logger,
+		handler:    handler,
+		opts:       opts,
+		clock:      clock,
+		gate:       newLoadGate(opts.Exclusion),
+		escalation: newEscalator(opts.Escalation),
+		random:     randomDuration,
+		logger:     logger,
 	}
 }
 
+func randomDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return rand.N(max)
+}
+
 // Add registers a probe with its execution interval.
 func (s *Scheduler) Add(p Prober, interval time.Duration) {
 	s.probes = append(s.probes, ScheduledProbe{
 		Prober:   p,
 		Interval: interval,
+		stats:    &runCounters{},
 	})
 }
 
-// Run starts all scheduled probes and blocks until ctx is cancelled.
-// Each probe runs in its own goroutine on a fixed ticker.
+// Stats returns run counters per probe type.
+func (s *Scheduler) Stats() map[ProbeType]RunStats {
+	stats := make(map[ProbeType]RunStats, len(s.probes))
+	for _, sp := range s.probes {
+		st := stats[sp.Prober.Type()]
+		st.Runs += sp.stats.runs.Load()
+		st.Overruns += sp.stats.overruns.Load()
+		st.Skipped += sp.stats.skipped.Load()
+		st.TimedOut += sp.stats.timedOut.Load()
+		stats[sp.Prober.Type()] = st
+	}
+	return stats
+}
+
+// Run starts all scheduled probes and blocks until ctx is cancelled and
+// in-flight runs have returned. Each probe is paced by its own goroutine.
 func (s *Scheduler) Run(ctx context.Context) {
 	for _, sp := range s.probes {
 		s.wg.Add(1)
@@ -54,33 +180,173 @@ func (s *Scheduler) Run(ctx context.Context) {
 	s.logger.Info("scheduler stopped")
 }
 
+// runProbe fires sp on a fixed grid of ticks one interval apart, starting
+// after a random offset. Each tick is delayed by its own jitter without
+// moving the grid, so neither jitter nor slow runs cause drift. The grid
+// is re-anchored when escalation changes the interval. Probes with a cron
+// timetable fire at its times instead, and ticks outside the timetable's
+// windows are passed over.
 func (s *Scheduler) runProbe(ctx context.Context, sp ScheduledProbe) {
 	defer s.wg.Done()
 
 	probeType := sp.Prober.Type()
 	s.logger.Info("starting probe", "type", probeType, "interval", sp.Interval)
 
-	// Run immediately on start, then on ticker.
-	s.executeProbe(probeType, sp.Prober)
+	timetable := s.opts.Timetables[probeType]
+	interval, _, escalationChanged := s.escalation.state(probeType, sp.Interval)
+	if timetable.Cron != nil {
+		interval, escalationChanged = sp.Interval, nil
+	}
+	jitter := min(s.opts.Jitter, interval/2)
 
-	ticker := time.NewTicker(sp.Interval)
-	defer ticker.Stop()
+	done := make(chan struct{})
+	running, queued := 0, false
+	start := func() {
+		running++
+		sp.stats.runs.Add(1)
+		timeout := s.opts.Timeout
+		if timeout > 0 {
+			timeout = min(timeout, interval)
+		}
+		go func() {
+			s.executeProbe(ctx, sp, timeout)
+			done <- struct{}{}
+		}()
+	}
+
+	tick := s.clock.Now().Add(s.random(s.opts.StartJitter))
+	if timetable.Cron != nil {
+		tick = timetable.Cron.Next(s.clock.Now())
+	}
+	timer := s.clock.NewTimer(tick.Sub(s.clock.Now()))
+	defer func() { timer.Stop() }()
 
 	for {
 		select {
 		case <-ctx.Done():
 			s.logger.Info("stopping probe", "type", probeType)
+			for ; running > 0; running-- {
+				<-done
+			}
 			return
-		case <-ticker.C:
-			s.executeProbe(probeType, sp.Prober)
+
+		case <-done:
+			running--
+			if queued && running == 0 {
+				queued = false
+				start()
+			}
+
+		case <-timer.C():
+			if !timetable.Allows(s.clock.Now()) {
+				s.logger.Debug("probe outside its schedule window", "type", probeType)
+			} else if running == 0 {
+				start()
+			} else {
+				sp.stats.overruns.Add(1)
+				switch s.opts.Overrun {
+				case OverrunConcurrent:
+					start()
+				case OverrunQueue:
+					if queued {
+						sp.stats.skipped.Add(1)
+					} else {
+						queued = true
+					}
+				default:
+					sp.stats.skipped.Add(1)
+				}
+				s.logger.Warn("probe overran its interval",
+					"type", probeType,
+					"policy", s.opts.Overrun,
+				)
+			}
+
+			// Ticks missed outright, e.g. while the host was asleep, are
+			// counted and dropped rather than run back to back.
+			now := s.clock.Now()
+			if timetable.Cron != nil {
+				tick = timetable.Cron.Next(now)
+			} else {
+				tick = tick.Add(interval)
+				for !tick.After(now) {
+					tick = tick.Add(interval)
+					sp.stats.skipped.Add(1)
+				}
+			}
+			timer = s.clock.NewTimer(tick.Add(s.random(jitter)).Sub(now))
+
+		case <-escalationChanged:
+			var next time.Duration
+			var escalated bool
+			next, escalated, escalationChanged = s.escalation.state(probeType, sp.Interval)
+			if next == interval {
+				continue
+			}
+			interval = next
+			jitter = min(s.opts.Jitter, interval/2)
+
+			// On escalation an idle probe runs straight away; otherwise
+			// the new interval counts from now.
+			timer.Stop()
+			now := s.clock.Now()
+			tick = now.Add(interval)
+			if escalated && running == 0 {
+				tick = now
+			}
+			timer = s.clock.NewTimer(tick.Sub(now))
+			s.logger.Info("probe interval changed", "type", probeType, "interval", interval)
 		}
 	}
 }
 
-func (s *Scheduler) executeProbe(probeType ProbeType, p Prober) {
+func (s *Scheduler) executeProbe(ctx context.Context, sp ScheduledProbe, timeout time.Duration) {
+	probeType := sp.Prober.Type()
+
+	// Time spent waiting for the gate does not count against the timeout.
+	exit := s.gate.enter(probeType)
+	if ctx.Err() != nil {
+		exit()
+		return
+	}
+
+	var runCtx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		runCtx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
 	start := time.Now()
-	measurements, err := p.Run()
+	measurements, err := sp.Prober.Run(runCtx)
 	elapsed := time.Since(start)
+	underLoad := exit()
+
+	// A run cut short by shutdown is incomplete, so nothing it returned
+	// is kept.
+	if ctx.Err() != nil {
+		s.logger.Info("probe cancelled", "type", probeType, "elapsed", elapsed)
+		return
+	}
+
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		sp.stats.timedOut.Add(1)
+		s.logger.Warn("probe timed out",
+			"type", probeType,
+			"timeout", timeout,
+			"measurements", len(measurements),
+		)
+	}
+
+	if changed, escalated := s.escalation.observe(probeType, measurements, err); changed {
+		if escalated {
+			s.logger.Warn("link degraded, escalating probing", "trigger", probeType)
+		} else {
+			s.logger.Info("link recovered, backing off probing", "trigger", probeType)
+		}
+	}
 
 	if err != nil {
 		s.logger.Error("probe failed",
@@ -97,6 +363,12 @@ func (s *Scheduler) executeProbe(probeType ProbeType, p Prober) {
 		"elapsed", elapsed,
 	)
 
+	if s.gate.isPassive(probeType) {
+		for i := range measurements {
+			measurements[i].UnderLoad = Bool(underLoad)
+		}
+	}
+
 	if len(measurements) > 0 && s.handler != nil {
 		s.handler(measurements)
 	}
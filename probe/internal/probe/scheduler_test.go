@@ -0,0 +1,306 @@
+package probe
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when advanced. Timers due at or
+// before the new time fire on Advance.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool { return true }
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+	} else {
+		c.timers = append(c.timers, t)
+	}
+	return t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	var pending []*fakeTimer
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			t.c <- c.now
+		}
+	}
+	c.timers = pending
+}
+
+func (c *fakeClock) pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// blockingProbe runs until release is closed or its context ends.
+type blockingProbe struct {
+	release chan struct{}
+}
+
+func (p *blockingProbe) Type() ProbeType { return ProbeTypePing }
+
+func (p *blockingProbe) Run(ctx context.Context) ([]Measurement, error) {
+	select {
+	case <-p.release:
+	case <-ctx.Done():
+	}
+	return nil, nil
+}
+
+// loadProbe generates load until release is closed or its context ends.
+type loadProbe struct {
+	release chan struct{}
+	running atomic.Bool
+}
+
+func (p *loadProbe) Type() ProbeType { return ProbeTypeBufferbloat }
+
+func (p *loadProbe) Run(ctx context.Context) ([]Measurement, error) {
+	p.running.Store(true)
+	defer p.running.Store(false)
+	select {
+	case <-p.release:
+	case <-ctx.Done():
+	}
+	return nil, nil
+}
+
+// passiveProbe records whether load was running during each of its runs.
+type passiveProbe struct {
+	load *loadProbe
+
+	mu     sync.Mutex
+	loaded []bool
+}
+
+func (p *passiveProbe) Type() ProbeType { return ProbeTypePing }
+
+func (p *passiveProbe) Run(ctx context.Context) ([]Measurement, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loaded = append(p.loaded, p.load.running.Load())
+	return []Measurement{{ProbeType: ProbeTypePing}}, nil
+}
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// startScheduler runs a scheduler delivering to handler with probes every
+// 10s on a fake clock, with no jitter, and waits for their first runs to
+// have been scheduled.
+func startScheduler(t *testing.T, opts SchedulerOptions, handler MeasurementHandler, probes ...Prober) (*Scheduler, *fakeClock, func()) {
+	t.Helper()
+	clock := &fakeClock{now: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	opts.Clock = clock
+	s := NewScheduler(handler, opts, slog.New(slog.DiscardHandler))
+	s.random = func(time.Duration) time.Duration { return 0 }
+	for _, p := range probes {
+		s.Add(p, 10*time.Second)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	stopped := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(stopped)
+	}()
+	waitFor(t, "first ticks", func() bool { return clock.pending() == len(probes) })
+
+	return s, clock, func() {
+		cancel()
+		<-stopped
+	}
+}
+
+func TestSchedulerOverrunPolicies(t *testing.T) {
+	tests := []struct {
+		policy OverrunPolicy
+		want   RunStats
+	}{
+		{policy: OverrunSkip, want: RunStats{Runs: 1, Overruns: 2, Skipped: 2}},
+		{policy: OverrunQueue, want: RunStats{Runs: 2, Overruns: 2, Skipped: 1}},
+		{policy: OverrunConcurrent, want: RunStats{Runs: 3, Overruns: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			p := &blockingProbe{release: make(chan struct{})}
+			s, clock, stop := startScheduler(t, SchedulerOptions{Overrun: tt.policy}, nil, p)
+
+			// Two ticks come due while the first run is still going.
+			for range 2 {
+				clock.Advance(10 * time.Second)
+				waitFor(t, "next tick", func() bool { return clock.pending() == 1 })
+			}
+
+			close(p.release)
+			waitFor(t, "runs", func() bool { return s.Stats()[ProbeTypePing].Runs == tt.want.Runs })
+			stop()
+
+			if got := s.Stats()[ProbeTypePing]; got != tt.want {
+				t.Errorf("stats = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedulerDropsMissedTicks(t *testing.T) {
+	p := &blockingProbe{release: make(chan struct{})}
+	close(p.release)
+	s, clock, stop := startScheduler(t, SchedulerOptions{Overrun: OverrunQueue}, nil, p)
+
+	// As after a suspend: the 10s tick fires late, at 35s, and the ones
+	// due at 20s and 30s are dropped rather than run back to back.
+	clock.Advance(35 * time.Second)
+	waitFor(t, "next tick", func() bool { return clock.pending() == 1 })
+	waitFor(t, "second run", func() bool { return s.Stats()[ProbeTypePing].Runs == 2 })
+	stop()
+
+	// The first run may not have been reaped when the late tick fired, so
+	// whether it counted as an overrun is left open.
+	if got := s.Stats()[ProbeTypePing]; got.Runs != 2 || got.Skipped != 2 {
+		t.Errorf("stats = %+v, want 2 runs and 2 skipped", got)
+	}
+}
+
+func TestSchedulerTimesOutHungProbe(t *testing.T) {
+	// Never released, so only the timeout ends the run.
+	p := &blockingProbe{release: make(chan struct{})}
+	s, clock, stop := startScheduler(t, SchedulerOptions{Timeout: 20 * time.Millisecond, Overrun: OverrunConcurrent}, nil, p)
+	waitFor(t, "first timeout", func() bool { return s.Stats()[ProbeTypePing].TimedOut == 1 })
+
+	// The next run hangs as well and is cut off in turn.
+	clock.Advance(10 * time.Second)
+	waitFor(t, "second timeout", func() bool { return s.Stats()[ProbeTypePing].TimedOut == 2 })
+	stop()
+
+	if got := s.Stats()[ProbeTypePing]; got.Runs != 2 || got.Skipped != 0 {
+		t.Errorf("stats = %+v, want 2 runs both timed out", got)
+	}
+}
+
+func TestSchedulerExclusion(t *testing.T) {
+	tests := []struct {
+		policy UnderLoadPolicy
+		// wantLoaded is whether the passive run due mid-load overlaps it.
+		wantLoaded bool
+	}{
+		{policy: UnderLoadWait},
+		{policy: UnderLoadTag, wantLoaded: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			load := &loadProbe{release: make(chan struct{})}
+			passive := &passiveProbe{load: load}
+			var mu sync.Mutex
+			var underLoad []bool
+			handler := func(ms []Measurement) {
+				mu.Lock()
+				defer mu.Unlock()
+				for _, m := range ms {
+					underLoad = append(underLoad, m.UnderLoad != nil && *m.UnderLoad)
+				}
+			}
+			delivered := func() int {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(underLoad)
+			}
+
+			opts := SchedulerOptions{
+				Overrun: OverrunConcurrent,
+				Exclusion: ExclusionGroups{
+					Load:    []ProbeType{ProbeTypeBufferbloat},
+					Passive: []ProbeType{ProbeTypePing},
+					Policy:  tt.policy,
+				},
+			}
+			s, clock, stop := startScheduler(t, opts, handler, load, passive)
+			defer stop()
+
+			// Both fire at once; which goes first is left to the gate, so
+			// only the passive run due while load is running is judged.
+			waitFor(t, "load run", load.running.Load)
+			if tt.policy == UnderLoadTag {
+				waitFor(t, "first passive run", func() bool { return delivered() == 1 })
+			}
+			clock.Advance(10 * time.Second)
+			waitFor(t, "second passive tick", func() bool { return s.Stats()[ProbeTypePing].Runs == 2 })
+
+			if tt.policy == UnderLoadWait {
+				// The passive run due mid-load is held at the gate; at
+				// most the first, had it gone before the load, has run.
+				time.Sleep(20 * time.Millisecond)
+				passive.mu.Lock()
+				n := len(passive.loaded)
+				passive.mu.Unlock()
+				if n > 1 {
+					t.Fatalf("%d passive runs went ahead of the load run", n)
+				}
+			} else {
+				waitFor(t, "second passive run", func() bool { return delivered() == 2 })
+			}
+			close(load.release)
+			waitFor(t, "passive runs", func() bool { return delivered() == 2 })
+
+			passive.mu.Lock()
+			defer passive.mu.Unlock()
+			mu.Lock()
+			defer mu.Unlock()
+			if got := passive.loaded[1]; got != tt.wantLoaded {
+				t.Errorf("second passive run saw load %v, want %v", got, tt.wantLoaded)
+			}
+			if tt.policy == UnderLoadWait && passive.loaded[0] {
+				t.Error("first passive run overlapped load")
+			}
+			// Under tag the first run is marked too if it started after
+			// the load run, so only under wait is it checked.
+			if underLoad[1] != tt.wantLoaded || (tt.policy == UnderLoadWait && underLoad[0]) {
+				t.Errorf("UnderLoad = %v, want second %v", underLoad, tt.wantLoaded)
+			}
+		})
+	}
+}
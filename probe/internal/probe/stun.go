@@ -0,0 +1,135 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+// STUN (RFC 5389) constants for a bare Binding request.
+const (
+	stunBindingRequest  = 0x0001
+	stunBindingResponse = 0x0101
+	stunMagicCookie     = 0x2112A442
+	stunHeaderLen       = 20
+
+	stunAttrMappedAddress    = 0x0001
+	stunAttrXORMappedAddress = 0x0020
+)
+
+// stunMappedAddress sends a STUN Binding request to server (host:port) and
+// returns the reflexive address the server saw along with the local
+// address the request was sent from.
+func stunMappedAddress(ctx context.Context, server string, timeout time.Duration) (mapped, local net.IP, err error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to dial STUN server: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	req := make([]byte, stunHeaderLen)
+	binary.BigEndian.PutUint16(req[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint32(req[4:8], stunMagicCookie)
+	rand.Read(req[8:20])
+
+	if _, err := conn.Write(req); err != nil {
+		return nil, nil, fmt.Errorf("failed to send STUN request: %w", err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, nil, fmt.Errorf("no STUN response: %w", err)
+		}
+		if n < stunHeaderLen || !bytes.Equal(buf[8:20], req[8:20]) {
+			continue
+		}
+		mapped, err := parseSTUNResponse(buf[:n])
+		if err != nil {
+			return nil, nil, err
+		}
+		return mapped, conn.LocalAddr().(*net.UDPAddr).IP, nil
+	}
+}
+
+// parseSTUNResponse extracts the mapped address from a Binding success
+// response, preferring XOR-MAPPED-ADDRESS over the legacy MAPPED-ADDRESS.
+func parseSTUNResponse(b []byte) (net.IP, error) {
+	if binary.BigEndian.Uint16(b[0:2]) != stunBindingResponse {
+		return nil, fmt.Errorf("unexpected STUN message type %#04x", binary.BigEndian.Uint16(b[0:2]))
+	}
+	length := int(binary.BigEndian.Uint16(b[2:4]))
+	if stunHeaderLen+length > len(b) {
+		return nil, fmt.Errorf("truncated STUN response")
+	}
+
+	var mapped net.IP
+	attrs := b[stunHeaderLen : stunHeaderLen+length]
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:2])
+		size := int(binary.BigEndian.Uint16(attrs[2:4]))
+		if 4+size > len(attrs) {
+			break
+		}
+		value := attrs[4 : 4+size]
+
+		switch typ {
+		case stunAttrXORMappedAddress:
+			if ip := stunAddress(value, b[4:20]); ip != nil {
+				return ip, nil
+			}
+		case stunAttrMappedAddress:
+			mapped = stunAddress(value, nil)
+		}
+
+		// Attributes are padded to a multiple of four bytes.
+		next := 4 + (size+3)&^3
+		if next > len(attrs) {
+			break
+		}
+		attrs = attrs[next:]
+	}
+
+	if mapped == nil {
+		return nil, fmt.Errorf("STUN response has no mapped address")
+	}
+	return mapped, nil
+}
+
+// stunAddress decodes an address attribute value. For XOR-MAPPED-ADDRESS,
+// key is the magic cookie followed by the transaction ID.
+func stunAddress(value, key []byte) net.IP {
+	if len(value) < 4 {
+		return nil
+	}
+	var size int
+	switch value[1] {
+	case 0x01:
+		size = net.IPv4len
+	case 0x02:
+		size = net.IPv6len
+	default:
+		return nil
+	}
+	if len(value) < 4+size {
+		return nil
+	}
+
+	ip := make(net.IP, size)
+	copy(ip, value[4:4+size])
+	for i := range key {
+		if i < size {
+			ip[i] ^= key[i]
+		}
+	}
+	return ip
+}
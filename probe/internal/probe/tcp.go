@@ -0,0 +1,120 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// TCPProbe measures TCP handshake (SYN to SYN/ACK) time to host:port
+// targets, for hosts that filter ICMP.
+type TCPProbe struct {
+	targets  []string
+	count    int
+	timeout  time.Duration
+	interval time.Duration
+}
+
+func NewTCPProbe(targets []string, count int) *TCPProbe {
+	return &TCPProbe{
+		targets:  targets,
+		count:    count,
+		timeout:  3 * time.Second,
+		interval: 200 * time.Millisecond,
+	}
+}
+
+func (p *TCPProbe) Type() ProbeType {
+	return ProbeTypeTCP
+}
+
+func (p *TCPProbe) Run(ctx context.Context) ([]Measurement, error) {
+	var wg sync.WaitGroup
+	results := make([]Measurement, len(p.targets))
+	errors := make([]error, len(p.targets))
+
+	for i, target := range p.targets {
+		wg.Add(1)
+		go func(idx int, tgt string) {
+			defer wg.Done()
+			measurement, err := p.connectTarget(ctx, tgt)
+			if err != nil {
+				errors[idx] = err
+				return
+			}
+			results[idx] = measurement
+		}(i, target)
+	}
+
+	wg.Wait()
+
+	var validResults []Measurement
+	var errs []error
+	for i, result := range results {
+		if errors[i] != nil {
+			errs = append(errs, fmt.Errorf("target %s: %w", p.targets[i], errors[i]))
+		} else {
+			validResults = append(validResults, result)
+		}
+	}
+
+	if len(validResults) == 0 && len(errs) > 0 {
+		return nil, fmt.Errorf("all targets failed: %v", errs)
+	}
+
+	return validResults, nil
+}
+
+// connectTarget opens count sequential connections to target. Failed or
+// timed-out handshakes count as loss, so an unreachable target still
+// produces a measurement with 100% loss rather than disappearing.
+func (p *TCPProbe) connectTarget(ctx context.Context, target string) (Measurement, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return Measurement{}, fmt.Errorf("invalid target: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(p.count)*(p.timeout+p.interval))
+	defer cancel()
+
+	// Resolve once up front so name lookups are not timed as handshakes.
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return Measurement{}, fmt.Errorf("failed to resolve host: %w", err)
+	}
+	addr := net.JoinHostPort(addrs[0], port)
+
+	dialer := &net.Dialer{Timeout: p.timeout}
+
+	var rtts []time.Duration
+	for i := 0; i < p.count; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(p.interval):
+			case <-ctx.Done():
+				return Measurement{}, ctx.Err()
+			}
+		}
+
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		rtt := time.Since(start)
+		if err != nil {
+			continue
+		}
+		conn.Close()
+		rtts = append(rtts, rtt)
+	}
+
+	measurement := Measurement{
+		Timestamp:  time.Now(),
+		ProbeType:  ProbeTypeTCP,
+		Target:     target,
+		PacketLoss: F64(float64(p.count-len(rtts)) / float64(p.count) * 100),
+	}
+	applyRTTStats(&measurement, rtts)
+
+	return measurement, nil
+}
@@ -0,0 +1,73 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTCPProbeConnectTarget(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	// A port nothing listens on refuses every handshake.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	tests := []struct {
+		name        string
+		target      string
+		wantLoss    float64
+		wantLatency bool
+		wantErr     bool
+	}{
+		{name: "listening", target: ln.Addr().String(), wantLoss: 0, wantLatency: true},
+		{name: "refused", target: closed.Addr().String(), wantLoss: 100},
+		{name: "no port", target: "127.0.0.1", wantErr: true},
+	}
+
+	p := NewTCPProbe(nil, 4)
+	p.timeout = time.Second
+	p.interval = time.Millisecond
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := p.connectTarget(context.Background(), tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if m.ProbeType != ProbeTypeTCP || m.Target != tt.target {
+				t.Errorf("got %s measurement of %q", m.ProbeType, m.Target)
+			}
+			if m.PacketLoss == nil || *m.PacketLoss != tt.wantLoss {
+				t.Errorf("loss = %v, want %v", deref(m.PacketLoss), tt.wantLoss)
+			}
+			if (m.LatencyAvg != nil) != tt.wantLatency {
+				t.Errorf("latency = %v, want present %v", deref(m.LatencyAvg), tt.wantLatency)
+			}
+			if tt.wantLatency && (*m.LatencyMin > *m.LatencyAvg || *m.LatencyAvg > *m.LatencyMax) {
+				t.Errorf("latency min %v avg %v max %v out of order", *m.LatencyMin, *m.LatencyAvg, *m.LatencyMax)
+			}
+		})
+	}
+}
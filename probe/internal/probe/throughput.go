@@ -0,0 +1,266 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// throughputUploadChunk is the body size of each upload request; streams
+// issue new requests until the measurement window closes.
+const throughputUploadChunk = 25 << 20
+
+// ThroughputProbe measures achieved download and upload rates using
+// parallel HTTP streams over a fixed window, discarding a warm-up period
+// so TCP slow start does not drag the average down.
+type ThroughputProbe struct {
+	downloadURL string
+	uploadURL   string
+	streams     int
+	duration    time.Duration
+	warmup      time.Duration
+	budget      *DataBudget
+	// runEstimate is the budget a run needs left before it starts.
+	runEstimate int64
+	client      *http.Client
+}
+
+// NewThroughputProbe creates a speed test that only starts when budget has
+// runEstimate bytes left, and stops once a run has used what was left. A
+// nil budget means unlimited.
+func NewThroughputProbe(downloadURL, uploadURL string, streams int, duration, warmup time.Duration, budget *DataBudget, runEstimate int64) *ThroughputProbe {
+	if streams <= 0 {
+		streams = 4
+	}
+	if duration <= 0 {
+		duration = 10 * time.Second
+	}
+	return &ThroughputProbe{
+		downloadURL: downloadURL,
+		uploadURL:   uploadURL,
+		streams:     streams,
+		duration:    duration,
+		warmup:      warmup,
+		budget:      budget,
+		runEstimate: runEstimate,
+		client:      &http.Client{},
+	}
+}
+
+func (p *ThroughputProbe) Type() ProbeType {
+	return ProbeTypeThroughput
+}
+
+func (p *ThroughputProbe) Run(ctx context.Context) ([]Measurement, error) {
+	if !p.budget.Allow(p.runEstimate) {
+		return nil, ErrBudgetExhausted
+	}
+	left := p.budget.Remaining()
+
+	target := p.downloadURL
+	if target == "" {
+		target = p.uploadURL
+	}
+
+	var total int64
+	measurement := Measurement{
+		Timestamp: time.Now(),
+		ProbeType: ProbeTypeThroughput,
+		Target:    target,
+	}
+
+	if p.downloadURL != "" {
+		mbps, n, err := p.measure(ctx, p.downloadStream, left)
+		total += n
+		if err != nil {
+			p.finish(total)
+			return nil, fmt.Errorf("download: %w", err)
+		}
+		measurement.DownloadMbps = F64(mbps)
+	}
+
+	if p.uploadURL != "" {
+		mbps, n, err := p.measure(ctx, p.uploadStream, left-total)
+		total += n
+		if err != nil {
+			p.finish(total)
+			return nil, fmt.Errorf("upload: %w", err)
+		}
+		measurement.UploadMbps = F64(mbps)
+	}
+
+	p.finish(total)
+	measurement.BytesTransferred = &total
+
+	return []Measurement{measurement}, nil
+}
+
+// finish charges a run's bytes to the budget, including failed runs since
+// the data was transferred either way.
+func (p *ThroughputProbe) finish(total int64) {
+	p.budget.Record(total)
+}
+
+// measure runs p.streams copies of stream for p.duration and returns the
+// steady-state rate in Mbps and the total bytes moved, warm-up included.
+// The streams stop once they have moved limit bytes between them. A run
+// cut short by ctx or by the limit is an error, since its rate would be
+// misleading.
+func (p *ThroughputProbe) measure(parent context.Context, stream func(context.Context, *atomic.Int64, int64) error, limit int64) (float64, int64, error) {
+	if limit <= 0 {
+		return 0, 0, ErrBudgetExhausted
+	}
+
+	ctx, cancel := context.WithTimeout(parent, p.duration)
+	defer cancel()
+
+	var counter atomic.Int64
+	var wg sync.WaitGroup
+	errs := make([]error, p.streams)
+
+	for i := 0; i < p.streams; i++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			errs[idx] = stream(ctx, &counter, limit)
+		}(i)
+	}
+
+	// Snapshot the counter once warm-up is over; everything after it is
+	// steady state.
+	warmupBytes := int64(0)
+	warmupEnd := time.Now()
+	if p.warmup > 0 && p.warmup < p.duration {
+		select {
+		case <-time.After(p.warmup):
+		case <-ctx.Done():
+		}
+		warmupBytes = counter.Load()
+		warmupEnd = time.Now()
+	}
+
+	wg.Wait()
+	end := time.Now()
+	total := counter.Load()
+
+	if err := parent.Err(); err != nil {
+		return 0, total, err
+	}
+	if total >= limit {
+		return 0, total, ErrBudgetExhausted
+	}
+
+	if total == 0 {
+		for _, err := range errs {
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+		return 0, 0, fmt.Errorf("no data transferred")
+	}
+
+	elapsed := end.Sub(warmupEnd).Seconds()
+	if elapsed <= 0 {
+		return 0, total, fmt.Errorf("measurement window too short")
+	}
+
+	mbps := float64(total-warmupBytes) * 8 / elapsed / 1e6
+	return mbps, total, nil
+}
+
+// downloadStream repeatedly fetches downloadURL until ctx ends or counter
+// reaches limit.
+func (p *ThroughputProbe) downloadStream(ctx context.Context, counter *atomic.Int64, limit int64) error {
+	for ctx.Err() == nil {
+		req, err := http.NewRequestWithContext(ctx, "GET", p.downloadURL, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return streamErr(ctx, err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("download failed with status: %d", resp.StatusCode)
+		}
+
+		_, err = io.Copy(io.Discard, &countingReader{r: resp.Body, n: counter, limit: limit})
+		resp.Body.Close()
+		if err != nil {
+			return streamErr(ctx, err)
+		}
+	}
+	return nil
+}
+
+// uploadStream repeatedly posts chunks to uploadURL until ctx ends or
+// counter reaches limit.
+func (p *ThroughputProbe) uploadStream(ctx context.Context, counter *atomic.Int64, limit int64) error {
+	for ctx.Err() == nil {
+		body := &countingReader{
+			r:     io.LimitReader(zeroReader{}, throughputUploadChunk),
+			n:     counter,
+			limit: limit,
+		}
+		req, err := http.NewRequestWithContext(ctx, "POST", p.uploadURL, body)
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.ContentLength = throughputUploadChunk
+		req.Header.Set("Content-Type", "application/octet-stream")
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return streamErr(ctx, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("upload failed with status: %d", resp.StatusCode)
+		}
+	}
+	return nil
+}
+
+// streamErr treats errors caused by the window closing as a clean stop.
+func streamErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	return err
+}
+
+// countingReader adds every byte read through it to n. When limit is
+// positive, reads fail with ErrBudgetExhausted once n reaches it, so a run
+// cannot overspend its data budget. Readers sharing n each read at most up
+// to the limit they last saw, so together they overshoot it by no more
+// than one read apiece.
+type countingReader struct {
+	r     io.Reader
+	n     *atomic.Int64
+	limit int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	if c.limit > 0 {
+		left := c.limit - c.n.Load()
+		if left <= 0 {
+			return 0, ErrBudgetExhausted
+		}
+		if int64(len(p)) > left {
+			p = p[:left]
+		}
+	}
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
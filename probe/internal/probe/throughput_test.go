@@ -0,0 +1,99 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// speedTestServer serves 1 MB downloads on /down and discards uploads on
+// /up, counting requests.
+func speedTestServer(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var requests atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/down", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		io.Copy(w, io.LimitReader(zeroReader{}, 1<<20))
+	})
+	mux.HandleFunc("/up", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		io.Copy(io.Discard, r.Body)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestThroughputProbeRun(t *testing.T) {
+	srv, _ := speedTestServer(t)
+	budget := NewDataBudget(DataBudgetOptions{})
+
+	p := NewThroughputProbe(srv.URL+"/down", srv.URL+"/up", 2, 200*time.Millisecond, 50*time.Millisecond, budget, 1<<20)
+	ms, err := p.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := ms[0]
+	if m.DownloadMbps == nil || *m.DownloadMbps <= 0 || m.UploadMbps == nil || *m.UploadMbps <= 0 {
+		t.Errorf("download %v Mbps, upload %v Mbps, want both positive", deref(m.DownloadMbps), deref(m.UploadMbps))
+	}
+	if m.BytesTransferred == nil || *m.BytesTransferred != budget.Used() {
+		t.Errorf("transferred %v bytes, budget charged %d", deref(m.BytesTransferred), budget.Used())
+	}
+}
+
+func TestThroughputProbeBudget(t *testing.T) {
+	const streams = 4
+	// Streams sharing a counter each overshoot the limit by at most one
+	// io.Copy buffer.
+	const overshoot = streams * 32 << 10
+
+	tests := []struct {
+		name         string
+		downloadPath string
+		uploadPath   string
+		daily        int64
+		runEstimate  int64
+		wantRequests bool
+	}{
+		{name: "download cut off", downloadPath: "/down", daily: 8 << 20, runEstimate: 1 << 20, wantRequests: true},
+		{name: "upload cut off", uploadPath: "/up", daily: 8 << 20, runEstimate: 1 << 20, wantRequests: true},
+		{name: "too little left to start", downloadPath: "/down", daily: 8 << 20, runEstimate: 16 << 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := speedTestServer(t)
+			url := func(path string) string {
+				if path == "" {
+					return ""
+				}
+				return srv.URL + path
+			}
+			budget := NewDataBudget(DataBudgetOptions{DailyLimit: tt.daily})
+
+			// Long enough that only the budget can end the run.
+			p := NewThroughputProbe(url(tt.downloadPath), url(tt.uploadPath), streams, time.Minute, 0, budget, tt.runEstimate)
+			_, err := p.Run(context.Background())
+			if !errors.Is(err, ErrBudgetExhausted) {
+				t.Fatalf("error = %v, want ErrBudgetExhausted", err)
+			}
+			if got := requests.Load() > 0; got != tt.wantRequests {
+				t.Fatalf("made requests %v, want %v", got, tt.wantRequests)
+			}
+			if !tt.wantRequests {
+				return
+			}
+			if used := budget.Used(); used < tt.daily || used > tt.daily+overshoot {
+				t.Errorf("used %d bytes of a %d byte budget", used, tt.daily)
+			}
+		})
+	}
+}
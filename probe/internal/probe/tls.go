@@ -0,0 +1,166 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// TLSProbe handshakes with TLS endpoints and records what was negotiated
+// and how long the certificate chain has left, so expiring certificates
+// and TLS configuration regressions show up before clients break.
+type TLSProbe struct {
+	targets []string
+	timeout time.Duration
+	// rootCAs verifies presented chains; nil means the system roots.
+	rootCAs *x509.CertPool
+}
+
+// NewTLSProbe handshakes with each host:port target.
+func NewTLSProbe(targets []string) *TLSProbe {
+	return &TLSProbe{
+		targets: targets,
+		timeout: 10 * time.Second,
+	}
+}
+
+func (p *TLSProbe) Type() ProbeType {
+	return ProbeTypeTLS
+}
+
+func (p *TLSProbe) Run(ctx context.Context) ([]Measurement, error) {
+	var wg sync.WaitGroup
+	results := make([]Measurement, len(p.targets))
+	errors := make([]error, len(p.targets))
+
+	for i, target := range p.targets {
+		wg.Add(1)
+		go func(idx int, tgt string) {
+			defer wg.Done()
+			measurement, err := p.handshake(ctx, tgt)
+			if err != nil {
+				errors[idx] = err
+				return
+			}
+			results[idx] = measurement
+		}(i, target)
+	}
+
+	wg.Wait()
+
+	var validResults []Measurement
+	var errs []error
+	for i, result := range results {
+		if errors[i] != nil {
+			errs = append(errs, fmt.Errorf("target %s: %w", p.targets[i], errors[i]))
+		} else {
+			validResults = append(validResults, result)
+		}
+	}
+
+	if len(validResults) == 0 && len(errs) > 0 {
+		return nil, fmt.Errorf("all targets failed: %v", errs)
+	}
+
+	return validResults, nil
+}
+
+// handshake connects to target and times the TCP connect and TLS
+// handshake separately. The chain is verified after the handshake so an
+// expired or mismatched certificate is recorded rather than failing the
+// connection.
+func (p *TLSProbe) handshake(ctx context.Context, target string) (Measurement, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return Measurement{}, fmt.Errorf("invalid target: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	// Resolve up front so name lookups are not timed as the connect.
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return Measurement{}, fmt.Errorf("failed to resolve host: %w", err)
+	}
+
+	state, connect, handshake, err := dialTLS(ctx, net.JoinHostPort(addrs[0], port), &tls.Config{
+		ServerName:         host,
+		NextProtos:         []string{"h2", "http/1.1"},
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return Measurement{}, err
+	}
+
+	m := Measurement{
+		Timestamp:   time.Now(),
+		ProbeType:   ProbeTypeTLS,
+		Target:      target,
+		ConnectTime: F64(durationMs(connect)),
+		TLSTime:     F64(durationMs(handshake)),
+		TLSVersion:  tls.VersionName(state.Version),
+		TLSCipher:   tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+		OCSPStapled: Bool(len(state.OCSPResponse) > 0),
+		CertValid:   Bool(p.verify(host, state.PeerCertificates) == nil),
+	}
+	if expiry, ok := chainExpiry(state.PeerCertificates); ok {
+		m.CertExpiryDays = F64(time.Until(expiry).Hours() / 24)
+	}
+
+	return m, nil
+}
+
+// dialTLS connects to addr over TCP and completes a TLS handshake,
+// timing each separately, then closes the connection.
+func dialTLS(ctx context.Context, addr string, config *tls.Config) (tls.ConnectionState, time.Duration, time.Duration, error) {
+	var dialer net.Dialer
+	start := time.Now()
+	raw, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return tls.ConnectionState{}, 0, 0, fmt.Errorf("failed to connect: %w", err)
+	}
+	connect := time.Since(start)
+
+	conn := tls.Client(raw, config)
+	defer conn.Close()
+	start = time.Now()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return tls.ConnectionState{}, connect, 0, fmt.Errorf("TLS handshake failed: %w", err)
+	}
+	return conn.ConnectionState(), connect, time.Since(start), nil
+}
+
+// verify checks a presented chain against the probe's roots for host.
+func (p *TLSProbe) verify(host string, chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return fmt.Errorf("no certificate presented")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         p.rootCAs,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+// chainExpiry returns the earliest expiry in a presented chain, since an
+// expiring intermediate breaks clients just as an expiring leaf does.
+func chainExpiry(chain []*x509.Certificate) (time.Time, bool) {
+	var earliest time.Time
+	for _, cert := range chain {
+		if earliest.IsZero() || cert.NotAfter.Before(earliest) {
+			earliest = cert.NotAfter
+		}
+	}
+	return earliest, !earliest.IsZero()
+}
@@ -0,0 +1,197 @@
+package probe
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// issueCert creates a certificate valid until notAfter for 127.0.0.1,
+// signed by parent or self-signed when parent is nil.
+func issueCert(t *testing.T, name string, notAfter time.Time, isCA bool, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if !isCA {
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// startTLSServer completes handshakes with config on a loopback port until
+// the test ends and returns its address.
+func startTLSServer(t *testing.T, config *tls.Config) string {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestTLSProbeHandshake(t *testing.T) {
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	srvRoots := x509.NewCertPool()
+	srvRoots.AddCert(srv.Certificate())
+
+	// A chain whose intermediate expires before its leaf, stapling an
+	// OCSP response.
+	now := time.Now()
+	root, rootKey := issueCert(t, "Test Root", now.Add(10*365*24*time.Hour), true, nil, nil)
+	intermediate, intermediateKey := issueCert(t, "Test Intermediate", now.Add(5*24*time.Hour), true, root, rootKey)
+	leaf, leafKey := issueCert(t, "127.0.0.1", now.Add(30*24*time.Hour), false, intermediate, intermediateKey)
+	expired, expiredKey := issueCert(t, "127.0.0.1", now.Add(-24*time.Hour), false, root, rootKey)
+	chainRoots := x509.NewCertPool()
+	chainRoots.AddCert(root)
+
+	stapled := startTLSServer(t, &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{leaf.Raw, intermediate.Raw},
+			PrivateKey:  leafKey,
+			OCSPStaple:  []byte{0x30, 0x03, 0x0a, 0x01, 0x00},
+		}},
+		NextProtos: []string{"h2"},
+		MaxVersion: tls.VersionTLS12,
+	})
+	lapsed := startTLSServer(t, &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{expired.Raw}, PrivateKey: expiredKey}},
+	})
+
+	tests := []struct {
+		name        string
+		target      string
+		roots       *x509.CertPool
+		wantValid   bool
+		wantVersion string
+		wantALPN    string
+		wantOCSP    bool
+		wantExpiry  float64
+	}{
+		{
+			name:        "trusted test server",
+			target:      srv.Listener.Addr().String(),
+			roots:       srvRoots,
+			wantValid:   true,
+			wantVersion: "TLS 1.3",
+			wantALPN:    "http/1.1",
+			wantExpiry:  time.Until(srv.Certificate().NotAfter).Hours() / 24,
+		},
+		{
+			name:        "untrusted test server",
+			target:      srv.Listener.Addr().String(),
+			wantVersion: "TLS 1.3",
+			wantALPN:    "http/1.1",
+			wantExpiry:  time.Until(srv.Certificate().NotAfter).Hours() / 24,
+		},
+		{
+			name:        "intermediate expires first",
+			target:      stapled,
+			roots:       chainRoots,
+			wantValid:   true,
+			wantVersion: "TLS 1.2",
+			wantALPN:    "h2",
+			wantOCSP:    true,
+			wantExpiry:  5,
+		},
+		{
+			name:        "expired leaf",
+			target:      lapsed,
+			roots:       chainRoots,
+			wantVersion: "TLS 1.3",
+			wantExpiry:  -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewTLSProbe(nil)
+			p.rootCAs = tt.roots
+			m, err := p.handshake(context.Background(), tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if m.ProbeType != ProbeTypeTLS || m.Target != tt.target || m.ConnectTime == nil || m.TLSTime == nil {
+				t.Errorf("got %s measurement of %q, connect %v handshake %v",
+					m.ProbeType, m.Target, deref(m.ConnectTime), deref(m.TLSTime))
+			}
+			if *m.CertValid != tt.wantValid {
+				t.Errorf("cert valid = %v, want %v", *m.CertValid, tt.wantValid)
+			}
+			if m.TLSVersion != tt.wantVersion || m.ALPN != tt.wantALPN || m.TLSCipher == "" {
+				t.Errorf("negotiated %s %q with ALPN %q, want %s with %q", m.TLSVersion, m.TLSCipher, m.ALPN, tt.wantVersion, tt.wantALPN)
+			}
+			if *m.OCSPStapled != tt.wantOCSP {
+				t.Errorf("OCSP stapled = %v, want %v", *m.OCSPStapled, tt.wantOCSP)
+			}
+			if m.CertExpiryDays == nil || *m.CertExpiryDays < tt.wantExpiry-0.01 || *m.CertExpiryDays > tt.wantExpiry+0.01 {
+				t.Errorf("expiry = %v days, want %.2f", deref(m.CertExpiryDays), tt.wantExpiry)
+			}
+		})
+	}
+}
+
+func TestTLSProbeRun(t *testing.T) {
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	down := httptest.NewTLSServer(nil)
+	down.Close()
+
+	targets := []string{srv.Listener.Addr().String(), down.Listener.Addr().String(), "no-port"}
+	ms, err := NewTLSProbe(targets).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || ms[0].Target != targets[0] {
+		t.Errorf("got %+v, want one measurement of %s", ms, targets[0])
+	}
+
+	if _, err := NewTLSProbe(targets[1:]).Run(context.Background()); err == nil {
+		t.Error("Run succeeded with every target down")
+	}
+}
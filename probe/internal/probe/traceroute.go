@@ -0,0 +1,461 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// protocolICMP is the IANA protocol number for ICMP, as expected by
+// icmp.ParseMessage.
+const protocolICMP = 1
+
+// Hop holds MTR-style statistics for a single TTL on the path to a target.
+type Hop struct {
+	TTL        int      `json:"ttl"`
+	Address    string   `json:"address,omitempty"`
+	Sent       int      `json:"sent"`
+	Received   int      `json:"received"`
+	LatencyMin *float64 `json:"latency_min,omitempty"`
+	LatencyAvg *float64 `json:"latency_avg,omitempty"`
+	LatencyMax *float64 `json:"latency_max,omitempty"`
+	LatencyP95 *float64 `json:"latency_p95,omitempty"`
+	Jitter     *float64 `json:"jitter,omitempty"`
+	PacketLoss *float64 `json:"packet_loss,omitempty"`
+}
+
+// traceConn sends ICMP echo requests with a chosen TTL and reads back the
+// replies. icmpTraceConn implements it over a real socket; tests can
+// substitute a fake responder.
+type traceConn interface {
+	WriteTo(b []byte, ttl int, dst net.IP) error
+	ReadFrom(b []byte) (int, net.IP, error)
+	SetReadDeadline(t time.Time) error
+	Close() error
+}
+
+// TracerouteProbe maps the path to each target, sending several rounds of
+// TTL-limited echo requests and aggregating per-hop RTT and loss.
+type TracerouteProbe struct {
+	targets    []string
+	maxHops    int
+	hopTimeout time.Duration
+	rounds     int
+	// dial opens a traceConn and reports whether it rewrites echo IDs
+	// (unprivileged datagram sockets do).
+	dial func() (traceConn, bool, error)
+}
+
+func NewTracerouteProbe(targets []string, maxHops int, hopTimeout time.Duration, rounds int) *TracerouteProbe {
+	if maxHops <= 0 {
+		maxHops = 30
+	}
+	if hopTimeout <= 0 {
+		hopTimeout = time.Second
+	}
+	if rounds <= 0 {
+		rounds = 5
+	}
+	return &TracerouteProbe{
+		targets:    targets,
+		maxHops:    maxHops,
+		hopTimeout: hopTimeout,
+		rounds:     rounds,
+		dial:       dialICMPTraceConn,
+	}
+}
+
+func (p *TracerouteProbe) Type() ProbeType {
+	return ProbeTypeTraceroute
+}
+
+func (p *TracerouteProbe) Run(ctx context.Context) ([]Measurement, error) {
+	var wg sync.WaitGroup
+	results := make([]Measurement, len(p.targets))
+	errors := make([]error, len(p.targets))
+
+	for i, target := range p.targets {
+		wg.Add(1)
+		go func(idx int, tgt string) {
+			defer wg.Done()
+			measurement, err := p.traceTarget(ctx, tgt)
+			if err != nil {
+				errors[idx] = err
+				return
+			}
+			results[idx] = measurement
+		}(i, target)
+	}
+
+	wg.Wait()
+
+	var validResults []Measurement
+	var errs []error
+	for i, result := range results {
+		if errors[i] != nil {
+			errs = append(errs, fmt.Errorf("target %s: %w", p.targets[i], errors[i]))
+		} else {
+			validResults = append(validResults, result)
+		}
+	}
+
+	if len(validResults) == 0 && len(errs) > 0 {
+		return nil, fmt.Errorf("all targets failed: %v", errs)
+	}
+
+	return validResults, nil
+}
+
+func (p *TracerouteProbe) traceTarget(ctx context.Context, target string) (Measurement, error) {
+	dst, err := net.ResolveIPAddr("ip4", target)
+	if err != nil {
+		return Measurement{}, fmt.Errorf("failed to resolve target: %w", err)
+	}
+
+	conn, rewritesID, err := p.dial()
+	if err != nil {
+		return Measurement{}, fmt.Errorf("failed to open ICMP socket: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	t := &tracer{
+		conn:       conn,
+		id:         rand.Intn(0xffff),
+		checkID:    !rewritesID,
+		maxHops:    p.maxHops,
+		hopTimeout: p.hopTimeout,
+	}
+
+	hops, reached, err := t.trace(dst.IP, p.rounds)
+	if err != nil {
+		return Measurement{}, err
+	}
+
+	measurement := Measurement{
+		Timestamp:    time.Now(),
+		ProbeType:    ProbeTypeTraceroute,
+		Target:       target,
+		HopCount:     Int(len(hops)),
+		Hops:         hops,
+		TraceReached: Bool(reached),
+	}
+
+	// When the destination answered, the last hop is the destination, so
+	// its statistics double as the end-to-end result. Otherwise the last
+	// hop is some router short of it and says nothing end to end.
+	if reached {
+		last := hops[len(hops)-1]
+		measurement.LatencyMin = last.LatencyMin
+		measurement.LatencyAvg = last.LatencyAvg
+		measurement.LatencyMax = last.LatencyMax
+		measurement.LatencyP95 = last.LatencyP95
+		measurement.Jitter = last.Jitter
+		measurement.PacketLoss = last.PacketLoss
+	}
+
+	return measurement, nil
+}
+
+// hopReply is a single response to a TTL-limited echo request. final is
+// set when no higher TTL can get further: the destination answered, or a
+// router reported it unreachable.
+type hopReply struct {
+	addr    net.IP
+	rtt     time.Duration
+	reached bool
+	final   bool
+}
+
+// tracer runs MTR-style rounds over a traceConn. Each round sends one echo
+// per TTL back to back, then collects replies until hopTimeout elapses.
+type tracer struct {
+	conn       traceConn
+	id         int
+	checkID    bool
+	maxHops    int
+	hopTimeout time.Duration
+}
+
+// trace runs rounds over the path to dst. The hops end at the destination
+// when it answered, or at a router that reported it unreachable; otherwise
+// at the last hop that answered, so a target that drops echo requests does
+// not pad the path out to maxHops.
+func (t *tracer) trace(dst net.IP, rounds int) (hops []Hop, reached bool, err error) {
+	type hopSamples struct {
+		sent      int
+		rtts      []time.Duration
+		addrCount map[string]int
+	}
+
+	samples := make([]hopSamples, t.maxHops+1)
+	for ttl := range samples {
+		samples[ttl].addrCount = make(map[string]int)
+	}
+	pathLen := t.maxHops
+
+	for r := 0; r < rounds; r++ {
+		seqBase := r * t.maxHops
+		replies, err := t.round(dst, seqBase)
+		if err != nil {
+			return nil, false, err
+		}
+
+		for ttl := 1; ttl <= t.maxHops; ttl++ {
+			samples[ttl].sent++
+			reply, ok := replies[ttl]
+			if !ok {
+				continue
+			}
+			samples[ttl].rtts = append(samples[ttl].rtts, reply.rtt)
+			samples[ttl].addrCount[reply.addr.String()]++
+			switch {
+			case !reply.final || ttl > pathLen:
+			case ttl < pathLen:
+				pathLen = ttl
+				reached = reply.reached
+			default:
+				reached = reached || reply.reached
+			}
+		}
+	}
+
+	if !reached {
+		for pathLen > 0 && len(samples[pathLen].rtts) == 0 {
+			pathLen--
+		}
+	}
+
+	hops = make([]Hop, 0, pathLen)
+	for ttl := 1; ttl <= pathLen; ttl++ {
+		s := samples[ttl]
+		hop := Hop{
+			TTL:      ttl,
+			Sent:     s.sent,
+			Received: len(s.rtts),
+		}
+
+		// ECMP paths can answer from several routers; report the one
+		// seen most often.
+		best := 0
+		for addr, n := range s.addrCount {
+			if n > best {
+				hop.Address, best = addr, n
+			}
+		}
+
+		loss := float64(s.sent-len(s.rtts)) / float64(s.sent) * 100
+		hop.PacketLoss = F64(loss)
+
+		var m Measurement
+		applyRTTStats(&m, s.rtts)
+		hop.LatencyMin = m.LatencyMin
+		hop.LatencyAvg = m.LatencyAvg
+		hop.LatencyMax = m.LatencyMax
+		hop.LatencyP95 = m.LatencyP95
+		hop.Jitter = m.Jitter
+
+		hops = append(hops, hop)
+	}
+
+	return hops, reached, nil
+}
+
+// round sends one echo request per TTL and returns the replies keyed by TTL.
+func (t *tracer) round(dst net.IP, seqBase int) (map[int]hopReply, error) {
+	sentAt := make(map[int]time.Time, t.maxHops)
+
+	for ttl := 1; ttl <= t.maxHops; ttl++ {
+		msg := icmp.Message{
+			Type: ipv4.ICMPTypeEcho,
+			Body: &icmp.Echo{
+				ID:   t.id,
+				Seq:  seqBase + ttl,
+				Data: []byte("netpulse-traceroute"),
+			},
+		}
+		b, err := msg.Marshal(nil)
+		if err != nil {
+			return nil, fmt.Errorf("marshal echo request: %w", err)
+		}
+
+		sentAt[ttl] = time.Now()
+		if err := t.conn.WriteTo(b, ttl, dst); err != nil {
+			return nil, fmt.Errorf("send echo request (ttl %d): %w", ttl, err)
+		}
+	}
+
+	if err := t.conn.SetReadDeadline(time.Now().Add(t.hopTimeout)); err != nil {
+		return nil, fmt.Errorf("set read deadline: %w", err)
+	}
+
+	replies := make(map[int]hopReply)
+	finalAt := t.maxHops + 1
+	buf := make([]byte, 1500)
+
+	for {
+		n, peer, err := t.conn.ReadFrom(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				break
+			}
+			return nil, fmt.Errorf("read reply: %w", err)
+		}
+		received := time.Now()
+
+		id, seq, reached, final, ok := parseTraceReply(buf[:n], peer, dst)
+		if !ok || (t.checkID && id != t.id) {
+			continue
+		}
+
+		ttl := seq - seqBase
+		if ttl < 1 || ttl > t.maxHops {
+			continue
+		}
+		if _, dup := replies[ttl]; dup {
+			continue
+		}
+
+		replies[ttl] = hopReply{
+			addr:    peer,
+			rtt:     received.Sub(sentAt[ttl]),
+			reached: reached,
+			final:   final,
+		}
+		if final && ttl < finalAt {
+			finalAt = ttl
+		}
+
+		if t.complete(replies, finalAt) {
+			break
+		}
+	}
+
+	return replies, nil
+}
+
+// complete reports whether every TTL up to the end of the path has
+// answered, so the round can end before the timeout.
+func (t *tracer) complete(replies map[int]hopReply, finalAt int) bool {
+	if finalAt > t.maxHops {
+		return false
+	}
+	for ttl := 1; ttl <= finalAt; ttl++ {
+		if _, ok := replies[ttl]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTraceReply extracts the echo ID and sequence from an echo reply
+// sent by peer, or from the original request quoted in a time-exceeded or
+// unreachable error. reached is true when the reply came from dst itself;
+// final when the echo got no further, because dst answered or some hop
+// reported it unreachable. A firewall short of dst that rejects the echo
+// ends the path without reaching it.
+func parseTraceReply(b []byte, peer, dst net.IP) (id, seq int, reached, final, ok bool) {
+	msg, err := icmp.ParseMessage(protocolICMP, b)
+	if err != nil {
+		return 0, 0, false, false, false
+	}
+
+	switch body := msg.Body.(type) {
+	case *icmp.Echo:
+		if msg.Type != ipv4.ICMPTypeEchoReply {
+			return 0, 0, false, false, false
+		}
+		reached := peer.Equal(dst)
+		return body.ID, body.Seq, reached, reached, true
+	case *icmp.TimeExceeded:
+		id, seq, ok := parseQuotedEcho(body.Data)
+		return id, seq, false, false, ok
+	case *icmp.DstUnreach:
+		id, seq, ok := parseQuotedEcho(body.Data)
+		return id, seq, peer.Equal(dst), true, ok
+	}
+
+	return 0, 0, false, false, false
+}
+
+// parseQuotedEcho reads the echo header out of the IPv4 packet quoted in
+// an ICMP error message.
+func parseQuotedEcho(data []byte) (id, seq int, ok bool) {
+	if len(data) < ipv4.HeaderLen {
+		return 0, 0, false
+	}
+	headerLen := int(data[0]&0x0f) * 4
+	if len(data) < headerLen+8 {
+		return 0, 0, false
+	}
+	inner := data[headerLen:]
+	if inner[0] != byte(ipv4.ICMPTypeEcho) {
+		return 0, 0, false
+	}
+	return int(binary.BigEndian.Uint16(inner[4:6])), int(binary.BigEndian.Uint16(inner[6:8])), true
+}
+
+// icmpTraceConn is a traceConn over an x/net ICMP socket.
+type icmpTraceConn struct {
+	conn       *icmp.PacketConn
+	privileged bool
+}
+
+// dialICMPTraceConn tries a raw ICMP socket first, then an unprivileged
+// datagram ICMP socket, like pingWithFallback. Linux does not deliver
+// time-exceeded errors to datagram ICMP sockets, so without CAP_NET_RAW
+// only the destination hop will answer there.
+func dialICMPTraceConn() (traceConn, bool, error) {
+	if conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0"); err == nil {
+		return &icmpTraceConn{conn: conn, privileged: true}, false, nil
+	}
+
+	conn, err := icmp.ListenPacket("udp4", "0.0.0.0")
+	if err != nil {
+		return nil, false, err
+	}
+	return &icmpTraceConn{conn: conn}, true, nil
+}
+
+func (c *icmpTraceConn) WriteTo(b []byte, ttl int, dst net.IP) error {
+	if err := c.conn.IPv4PacketConn().SetTTL(ttl); err != nil {
+		return err
+	}
+
+	var addr net.Addr = &net.IPAddr{IP: dst}
+	if !c.privileged {
+		addr = &net.UDPAddr{IP: dst}
+	}
+	_, err := c.conn.WriteTo(b, addr)
+	return err
+}
+
+func (c *icmpTraceConn) ReadFrom(b []byte) (int, net.IP, error) {
+	n, peer, err := c.conn.ReadFrom(b)
+	if err != nil {
+		return 0, nil, err
+	}
+	switch addr := peer.(type) {
+	case *net.IPAddr:
+		return n, addr.IP, nil
+	case *net.UDPAddr:
+		return n, addr.IP, nil
+	}
+	return n, nil, nil
+}
+
+func (c *icmpTraceConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *icmpTraceConn) Close() error {
+	return c.conn.Close()
+}
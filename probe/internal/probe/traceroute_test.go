@@ -0,0 +1,285 @@
+package probe
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// quoteIPv4 wraps an ICMP message in a minimal IPv4 header, as routers
+// quote the offending packet in ICMP errors.
+func quoteIPv4(payload []byte) []byte {
+	header := make([]byte, ipv4.HeaderLen)
+	header[0] = 0x45
+	header[9] = protocolICMP
+	return append(header, payload...)
+}
+
+func marshalICMP(t *testing.T, msg icmp.Message) []byte {
+	t.Helper()
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return b
+}
+
+func TestParseTraceReply(t *testing.T) {
+	request := icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: 7, Seq: 42, Data: []byte("x")}}
+	requestBytes := marshalICMP(t, request)
+	udp := make([]byte, 8)
+	dst := net.IPv4(192, 0, 2, 1)
+	router := net.IPv4(10, 0, 0, 1)
+	unreachable := func(code int) icmp.Message {
+		return icmp.Message{Type: ipv4.ICMPTypeDestinationUnreachable, Code: code, Body: &icmp.DstUnreach{Data: quoteIPv4(requestBytes)}}
+	}
+
+	tests := []struct {
+		name        string
+		msg         icmp.Message
+		peer        net.IP
+		wantID      int
+		wantSeq     int
+		wantReached bool
+		wantFinal   bool
+		wantOK      bool
+	}{
+		{
+			name:        "echo reply",
+			msg:         icmp.Message{Type: ipv4.ICMPTypeEchoReply, Body: &icmp.Echo{ID: 7, Seq: 42}},
+			peer:        dst,
+			wantID:      7,
+			wantSeq:     42,
+			wantReached: true,
+			wantFinal:   true,
+			wantOK:      true,
+		},
+		{
+			name:    "echo reply from another address",
+			msg:     icmp.Message{Type: ipv4.ICMPTypeEchoReply, Body: &icmp.Echo{ID: 7, Seq: 42}},
+			peer:    router,
+			wantID:  7,
+			wantSeq: 42,
+			wantOK:  true,
+		},
+		{
+			name: "own echo request looped back",
+			msg:  request,
+			peer: dst,
+		},
+		{
+			name:    "time exceeded",
+			msg:     icmp.Message{Type: ipv4.ICMPTypeTimeExceeded, Body: &icmp.TimeExceeded{Data: quoteIPv4(requestBytes)}},
+			peer:    router,
+			wantID:  7,
+			wantSeq: 42,
+			wantOK:  true,
+		},
+		{
+			name:        "unreachable from the destination",
+			msg:         unreachable(3),
+			peer:        dst,
+			wantID:      7,
+			wantSeq:     42,
+			wantReached: true,
+			wantFinal:   true,
+			wantOK:      true,
+		},
+		{
+			name:      "host unreachable from a router",
+			msg:       unreachable(1),
+			peer:      router,
+			wantID:    7,
+			wantSeq:   42,
+			wantFinal: true,
+			wantOK:    true,
+		},
+		{
+			name:      "administratively prohibited by a firewall",
+			msg:       unreachable(13),
+			peer:      router,
+			wantID:    7,
+			wantSeq:   42,
+			wantFinal: true,
+			wantOK:    true,
+		},
+		{
+			name: "time exceeded quoting another protocol",
+			msg:  icmp.Message{Type: ipv4.ICMPTypeTimeExceeded, Body: &icmp.TimeExceeded{Data: quoteIPv4(udp)}},
+			peer: router,
+		},
+		{
+			name: "time exceeded with truncated quote",
+			msg:  icmp.Message{Type: ipv4.ICMPTypeTimeExceeded, Body: &icmp.TimeExceeded{Data: quoteIPv4(requestBytes[:4])}},
+			peer: router,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, seq, reached, final, ok := parseTraceReply(marshalICMP(t, tt.msg), tt.peer, dst)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if id != tt.wantID || seq != tt.wantSeq || reached != tt.wantReached || final != tt.wantFinal {
+				t.Errorf("got id %d seq %d reached %v final %v, want id %d seq %d reached %v final %v",
+					id, seq, reached, final, tt.wantID, tt.wantSeq, tt.wantReached, tt.wantFinal)
+			}
+		})
+	}
+
+	if _, _, _, _, ok := parseTraceReply([]byte{0xff}, dst, dst); ok {
+		t.Error("garbage parsed as a reply")
+	}
+}
+
+// hopBehaviour is how the fake path answers an echo sent with some TTL.
+type hopBehaviour int
+
+const (
+	hopSilent hopBehaviour = iota
+	hopRouter
+	hopDestination
+	hopUnreachable
+	hopFirewall
+)
+
+// fakeTraceConn answers each echo request as the path says, then times
+// out once every reply has been read.
+type fakeTraceConn struct {
+	t       *testing.T
+	path    map[int]hopBehaviour
+	pending [][]byte
+	from    []net.IP
+}
+
+func (c *fakeTraceConn) WriteTo(b []byte, ttl int, dst net.IP) error {
+	msg, err := icmp.ParseMessage(protocolICMP, b)
+	if err != nil {
+		return err
+	}
+	echo := msg.Body.(*icmp.Echo)
+	from := net.IPv4(10, 0, 0, byte(ttl))
+
+	var reply icmp.Message
+	switch c.path[ttl] {
+	case hopSilent:
+		return nil
+	case hopRouter:
+		reply = icmp.Message{Type: ipv4.ICMPTypeTimeExceeded, Body: &icmp.TimeExceeded{Data: quoteIPv4(b)}}
+	case hopDestination:
+		reply = icmp.Message{Type: ipv4.ICMPTypeEchoReply, Body: &icmp.Echo{ID: echo.ID, Seq: echo.Seq}}
+		from = dst
+	case hopUnreachable:
+		reply = icmp.Message{Type: ipv4.ICMPTypeDestinationUnreachable, Code: 3, Body: &icmp.DstUnreach{Data: quoteIPv4(b)}}
+		from = dst
+	case hopFirewall:
+		// The same firewall rejects every echo that reaches it.
+		reply = icmp.Message{Type: ipv4.ICMPTypeDestinationUnreachable, Code: 13, Body: &icmp.DstUnreach{Data: quoteIPv4(b)}}
+		from = net.IPv4(10, 0, 0, 254)
+	}
+	c.pending = append(c.pending, marshalICMP(c.t, reply))
+	c.from = append(c.from, from)
+	return nil
+}
+
+func (c *fakeTraceConn) ReadFrom(b []byte) (int, net.IP, error) {
+	if len(c.pending) == 0 {
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+	n := copy(b, c.pending[0])
+	from := c.from[0]
+	c.pending, c.from = c.pending[1:], c.from[1:]
+	return n, from, nil
+}
+
+func (c *fakeTraceConn) SetReadDeadline(time.Time) error { return nil }
+
+func (c *fakeTraceConn) Close() error { return nil }
+
+func TestTracerouteTraceTarget(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        map[int]hopBehaviour
+		wantHops    int
+		wantReached bool
+	}{
+		{
+			name:        "destination reached",
+			path:        map[int]hopBehaviour{1: hopRouter, 2: hopRouter, 3: hopDestination, 4: hopDestination},
+			wantHops:    3,
+			wantReached: true,
+		},
+		{
+			name:        "destination reached behind a silent hop",
+			path:        map[int]hopBehaviour{1: hopRouter, 3: hopDestination},
+			wantHops:    3,
+			wantReached: true,
+		},
+		{
+			name:        "unreachable from the destination reaches it",
+			path:        map[int]hopBehaviour{1: hopRouter, 2: hopUnreachable},
+			wantHops:    2,
+			wantReached: true,
+		},
+		{
+			name:     "firewall short of the destination ends the path",
+			path:     map[int]hopBehaviour{1: hopRouter, 2: hopFirewall, 3: hopFirewall, 4: hopFirewall, 5: hopFirewall, 6: hopFirewall, 7: hopFirewall, 8: hopFirewall},
+			wantHops: 2,
+		},
+		{
+			name:     "silent destination trims trailing hops",
+			path:     map[int]hopBehaviour{1: hopRouter, 2: hopRouter},
+			wantHops: 2,
+		},
+		{
+			name:     "gap before the last answering hop is kept",
+			path:     map[int]hopBehaviour{1: hopRouter, 3: hopRouter},
+			wantHops: 3,
+		},
+		{
+			name:     "nothing answers",
+			path:     map[int]hopBehaviour{},
+			wantHops: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewTracerouteProbe([]string{"192.0.2.1"}, 8, time.Millisecond, 2)
+			p.dial = func() (traceConn, bool, error) {
+				return &fakeTraceConn{t: t, path: tt.path}, true, nil
+			}
+
+			m, err := p.traceTarget(t.Context(), "192.0.2.1")
+			if err != nil {
+				t.Fatalf("traceTarget: %v", err)
+			}
+			if got := *m.HopCount; got != tt.wantHops || len(m.Hops) != tt.wantHops {
+				t.Errorf("hop count %d with %d hops, want %d", got, len(m.Hops), tt.wantHops)
+			}
+			if m.TraceReached == nil || *m.TraceReached != tt.wantReached {
+				t.Errorf("TraceReached = %v, want %v", m.TraceReached, tt.wantReached)
+			}
+			if tt.wantReached != (m.LatencyAvg != nil) || tt.wantReached != (m.PacketLoss != nil) {
+				t.Errorf("end-to-end stats set = %v, want %v", m.LatencyAvg != nil, tt.wantReached)
+			}
+			for _, hop := range m.Hops {
+				want := 0
+				if tt.path[hop.TTL] != hopSilent {
+					want = 2
+				}
+				if hop.Sent != 2 || hop.Received != want {
+					t.Errorf("ttl %d: sent %d received %d, want 2 and %d", hop.TTL, hop.Sent, hop.Received, want)
+				}
+			}
+		})
+	}
+}
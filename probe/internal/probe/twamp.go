@@ -0,0 +1,173 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// twampPort is the well-known TWAMP test port used when a target has none.
+const twampPort = "862"
+
+// Unauthenticated TWAMP-Test packet layouts (RFC 5357 section 4.1.2 and
+// 4.2.1). A sender packet is a sequence number, transmit timestamp and
+// error estimate followed by padding. A reflector packet adds its own
+// receive timestamp and echoes the sender's fields and received TTL.
+const (
+	twampSenderHeaderLen = 14
+	twampReplyLen        = 41
+)
+
+// twampErrorEstimate marks timestamps as unsynchronized with an error of
+// one second (scale 32, multiplier 1), since the probe cannot tell how
+// well the system clock is disciplined.
+const twampErrorEstimate = 32<<8 | 1
+
+// TWAMPProbe is a TWAMP-Light Session-Sender (RFC 5357 Appendix I): it
+// streams test packets to reflectors without a control session and uses
+// timestamps from both ends to split round-trip delay into forward and
+// reverse delay and the reflector's processing time. Round-trip latency
+// excludes processing time; the one-way delays are only meaningful when
+// both clocks are synchronized.
+type TWAMPProbe struct {
+	targets    []string
+	rate       int
+	duration   time.Duration
+	packetSize int
+	// drain is how long to wait for late replies after the last send.
+	drain time.Duration
+}
+
+// NewTWAMPProbe sends rate test packets per second of packetSize bytes to
+// each reflector target (host or host:port, port 862 by default) for
+// duration. packetSize defaults to the reply size so that requests and
+// replies match, as RFC 6038 recommends.
+func NewTWAMPProbe(targets []string, rate int, duration time.Duration, packetSize int) *TWAMPProbe {
+	if rate <= 0 {
+		rate = 10
+	}
+	if duration <= 0 {
+		duration = 10 * time.Second
+	}
+	if packetSize < twampReplyLen {
+		packetSize = twampReplyLen
+	}
+	return &TWAMPProbe{
+		targets:    targets,
+		rate:       rate,
+		duration:   duration,
+		packetSize: packetSize,
+		drain:      time.Second,
+	}
+}
+
+func (p *TWAMPProbe) Type() ProbeType {
+	return ProbeTypeTWAMP
+}
+
+func (p *TWAMPProbe) Run(ctx context.Context) ([]Measurement, error) {
+	var wg sync.WaitGroup
+	results := make([]Measurement, len(p.targets))
+	errors := make([]error, len(p.targets))
+
+	for i, target := range p.targets {
+		wg.Add(1)
+		go func(idx int, tgt string) {
+			defer wg.Done()
+			measurement, err := p.testTarget(ctx, tgt)
+			if err != nil {
+				errors[idx] = err
+				return
+			}
+			results[idx] = measurement
+		}(i, target)
+	}
+
+	wg.Wait()
+
+	var validResults []Measurement
+	var errs []error
+	for i, result := range results {
+		if errors[i] != nil {
+			errs = append(errs, fmt.Errorf("target %s: %w", p.targets[i], errors[i]))
+		} else {
+			validResults = append(validResults, result)
+		}
+	}
+
+	if len(validResults) == 0 && len(errs) > 0 {
+		return nil, fmt.Errorf("all targets failed: %v", errs)
+	}
+
+	return validResults, nil
+}
+
+func (p *TWAMPProbe) testTarget(ctx context.Context, target string) (Measurement, error) {
+	addr := target
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		addr = net.JoinHostPort(target, twampPort)
+	}
+
+	packet := make([]byte, p.packetSize)
+	encode := func(seq uint32, now time.Time) []byte {
+		binary.BigEndian.PutUint32(packet[0:4], seq)
+		putNTPTimestamp(packet[4:12], now)
+		binary.BigEndian.PutUint16(packet[12:14], twampErrorEstimate)
+		return packet
+	}
+	parse := func(b []byte, received time.Time) (streamReply, bool) {
+		r, ok := parseTWAMPReply(b)
+		r.received = received
+		return r, ok
+	}
+
+	replies, sent, err := runStream(ctx, addr, p.rate, p.duration, p.drain, encode, parse)
+	if err != nil {
+		return Measurement{}, err
+	}
+
+	measurement := summarizeStream(replies, sent)
+	measurement.ProbeType = ProbeTypeTWAMP
+	measurement.Target = target
+	measurement.ForwardDelay, measurement.ReverseDelay, measurement.ReflectorDelay = twampDelays(replies)
+	return measurement, nil
+}
+
+// twampDelays averages the forward, reverse and reflector processing
+// delays in milliseconds over each sequence number's first reply.
+func twampDelays(replies []streamReply) (forward, reverse, processing *float64) {
+	seen := make(map[uint32]bool, len(replies))
+	var fwd, rev, proc time.Duration
+	for _, r := range replies {
+		if seen[r.seq] {
+			continue
+		}
+		seen[r.seq] = true
+		fwd += r.reflected.Sub(r.sent)
+		rev += r.received.Sub(r.transmitted)
+		proc += r.transmitted.Sub(r.reflected)
+	}
+	n := time.Duration(len(seen))
+	if n == 0 {
+		return nil, nil, nil
+	}
+	return F64(durationMs(fwd / n)), F64(durationMs(rev / n)), F64(durationMs(proc / n))
+}
+
+// parseTWAMPReply reads the timestamps from a reflector test packet. The
+// sequence number is the sender's, echoed back, so stateless and stateful
+// reflectors are handled alike.
+func parseTWAMPReply(b []byte) (streamReply, bool) {
+	if len(b) < twampReplyLen {
+		return streamReply{}, false
+	}
+	return streamReply{
+		seq:         binary.BigEndian.Uint32(b[24:28]),
+		sent:        readNTPTimestamp(b[28:36]),
+		reflected:   readNTPTimestamp(b[16:24]),
+		transmitted: readNTPTimestamp(b[4:12]),
+	}, true
+}
@@ -0,0 +1,113 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+func TestTWAMPReflectorReply(t *testing.T) {
+	reflector, err := ListenTWAMPReflector("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveReflector(t, reflector.Serve)
+
+	conn, err := net.Dial("udp", reflector.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := ipv4.NewConn(conn).SetTTL(42); err != nil {
+		t.Fatal(err)
+	}
+
+	// Too short to answer without the reply outgrowing the request.
+	conn.Write(make([]byte, twampReplyLen-1))
+
+	sent := time.Now()
+	request := make([]byte, 64)
+	binary.BigEndian.PutUint32(request[0:4], 7)
+	putNTPTimestamp(request[4:12], sent)
+	binary.BigEndian.PutUint16(request[12:14], twampErrorEstimate)
+	if _, err := conn.Write(request); err != nil {
+		t.Fatal(err)
+	}
+
+	reply := make([]byte, 128)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := time.Now()
+	reply = reply[:n]
+
+	if n != len(request) {
+		t.Errorf("reply is %d bytes, want the request's %d", n, len(request))
+	}
+	if seq := binary.BigEndian.Uint32(reply[0:4]); seq != 7 {
+		t.Errorf("reflector sequence number = %d, want the sender's 7", seq)
+	}
+	if e := binary.BigEndian.Uint16(reply[12:14]); e != twampErrorEstimate {
+		t.Errorf("error estimate = %#x, want %#x", e, twampErrorEstimate)
+	}
+	if !bytes.Equal(reply[24:38], request[:twampSenderHeaderLen]) {
+		t.Errorf("echoed sender fields % x, want % x", reply[24:38], request[:twampSenderHeaderLen])
+	}
+
+	// NTP fractions truncate, so allow a nanosecond either side.
+	r, ok := parseTWAMPReply(reply)
+	if !ok {
+		t.Fatal("parseTWAMPReply rejected the reply")
+	}
+	if r.seq != 7 || r.sent.Sub(sent).Abs() > time.Nanosecond {
+		t.Errorf("parsed seq %d sent %v, want 7 and %v", r.seq, r.sent, sent)
+	}
+	if r.reflected.Before(sent.Add(-time.Nanosecond)) || r.transmitted.Before(r.reflected) || r.transmitted.After(received) {
+		t.Errorf("reflector received at %v and sent at %v, outside %v to %v", r.reflected, r.transmitted, sent, received)
+	}
+
+	if reflector.ttl == nil {
+		t.Skip("the platform does not report received TTLs")
+	}
+	if reply[40] != 42 {
+		t.Errorf("reported TTL = %d, want 42", reply[40])
+	}
+}
+
+func TestTWAMPProbeLoopback(t *testing.T) {
+	reflector, err := ListenTWAMPReflector("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveReflector(t, reflector.Serve)
+
+	relay := startImpairedRelay(t, reflector.Addr(), func(b []byte) uint32 {
+		return binary.BigEndian.Uint32(b[0:4])
+	}, 3, 5, 7)
+
+	p := NewTWAMPProbe([]string{relay}, 100, 200*time.Millisecond, 0)
+	p.drain = 200 * time.Millisecond
+	ms, err := p.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || ms[0].ProbeType != ProbeTypeTWAMP || ms[0].Target != relay {
+		t.Fatalf("got %+v, want one TWAMP measurement of %s", ms, relay)
+	}
+	m := ms[0]
+	checkStreamImpairments(t, m)
+
+	// Both ends share a clock, so every delay is real and non-negative.
+	for name, d := range map[string]*float64{"forward": m.ForwardDelay, "reverse": m.ReverseDelay, "reflector": m.ReflectorDelay} {
+		if d == nil || *d < 0 {
+			t.Errorf("%s delay = %v", name, deref(d))
+		}
+	}
+}
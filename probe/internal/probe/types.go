@@ -1,35 +1,190 @@
 package probe
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // ProbeType identifies the kind of measurement.
 type ProbeType string
 
 const (
-	ProbeTypePing       ProbeType = "ping"
-	ProbeTypeDNS        ProbeType = "dns"
+	ProbeTypePing        ProbeType = "ping"
+	ProbeTypeDNS         ProbeType = "dns"
 	ProbeTypeBufferbloat ProbeType = "bufferbloat"
+	ProbeTypeHTTP        ProbeType = "http"
+	ProbeTypeTCP         ProbeType = "tcp"
+	ProbeTypeTraceroute  ProbeType = "traceroute"
+	ProbeTypeThroughput  ProbeType = "throughput"
+	ProbeTypeGateway     ProbeType = "gateway"
+	ProbeTypePMTU        ProbeType = "pmtu"
+	ProbeTypeUDPStream   ProbeType = "udp_stream"
+	ProbeTypeTWAMP       ProbeType = "twamp"
+	ProbeTypeNTP         ProbeType = "ntp"
+	ProbeTypePublicIP    ProbeType = "public_ip"
+	ProbeTypePortal      ProbeType = "portal"
+	ProbeTypeTLS         ProbeType = "tls"
+	ProbeTypeQUIC        ProbeType = "quic"
 )
 
 // Measurement holds the result of a single probe run.
 type Measurement struct {
-	Timestamp  time.Time `json:"timestamp"`
-	ProbeType  ProbeType `json:"probe_type"`
-	Target     string    `json:"target"`
-	LatencyMin *float64  `json:"latency_min,omitempty"`
-	LatencyAvg *float64  `json:"latency_avg,omitempty"`
-	LatencyMax *float64  `json:"latency_max,omitempty"`
-	LatencyP95 *float64  `json:"latency_p95,omitempty"`
-	Jitter     *float64  `json:"jitter,omitempty"`
-	PacketLoss *float64  `json:"packet_loss,omitempty"`
-	DNSTime    *float64  `json:"dns_time,omitempty"`
-	Bufferbloat *float64 `json:"bufferbloat,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+	ProbeType   ProbeType `json:"probe_type"`
+	Target      string    `json:"target"`
+	LatencyMin  *float64  `json:"latency_min,omitempty"`
+	LatencyAvg  *float64  `json:"latency_avg,omitempty"`
+	LatencyMax  *float64  `json:"latency_max,omitempty"`
+	LatencyP95  *float64  `json:"latency_p95,omitempty"`
+	Jitter      *float64  `json:"jitter,omitempty"`
+	PacketLoss  *float64  `json:"packet_loss,omitempty"`
+	DNSTime     *float64  `json:"dns_time,omitempty"`
+	Bufferbloat *float64  `json:"bufferbloat,omitempty"`
+
+	// Bufferbloat broken down by load direction, in milliseconds.
+	LatencyIdle           *float64 `json:"latency_idle,omitempty"`
+	LatencyLoadedDownload *float64 `json:"latency_loaded_download,omitempty"`
+	LatencyLoadedUpload   *float64 `json:"latency_loaded_upload,omitempty"`
+	BufferbloatDownload   *float64 `json:"bufferbloat_download,omitempty"`
+	BufferbloatUpload     *float64 `json:"bufferbloat_upload,omitempty"`
+
+	// Throughput in megabits per second and the bytes it cost.
+	DownloadMbps     *float64 `json:"download_mbps,omitempty"`
+	UploadMbps       *float64 `json:"upload_mbps,omitempty"`
+	BytesTransferred *int64   `json:"bytes_transferred,omitempty"`
+
+	// UDP stream quality. Reordering is the percentage of received packets
+	// that arrived after a later one; JitterForward and JitterReverse are
+	// RFC 3550 delay variation for each direction, in milliseconds.
+	Reordering    *float64 `json:"reordering,omitempty"`
+	Duplicates    *int     `json:"duplicates,omitempty"`
+	JitterForward *float64 `json:"jitter_forward,omitempty"`
+	JitterReverse *float64 `json:"jitter_reverse,omitempty"`
+
+	// TWAMP one-way delays and reflector processing time in milliseconds.
+	// The one-way delays assume synchronized clocks at both ends.
+	ForwardDelay   *float64 `json:"forward_delay,omitempty"`
+	ReverseDelay   *float64 `json:"reverse_delay,omitempty"`
+	ReflectorDelay *float64 `json:"reflector_delay,omitempty"`
+
+	// Estimated call quality: ITU-T G.107 R-factor (0-100) and MOS (1-4.5)
+	// for a call using VoIPCodec over the measured path.
+	RFactor   *float64 `json:"r_factor,omitempty"`
+	MOS       *float64 `json:"mos,omitempty"`
+	VoIPCodec string   `json:"voip_codec,omitempty"`
+
+	// NTP clock offset in milliseconds (positive when the local clock is
+	// behind) and server stratum. ClockUntrusted is set on every
+	// measurement once an offset is known, true when it exceeded the
+	// configured threshold and Timestamp was corrected by it.
+	ClockOffset    *float64 `json:"clock_offset,omitempty"`
+	Stratum        *int     `json:"stratum,omitempty"`
+	ClockUntrusted *bool    `json:"clock_untrusted,omitempty"`
+
+	// Public egress address, the autonomous system it belongs to, and
+	// whether the path crosses a carrier-grade NAT.
+	PublicIP string `json:"public_ip,omitempty"`
+	ASN      *int   `json:"asn,omitempty"`
+	ASOrg    string `json:"as_org,omitempty"`
+	CGNAT    *bool  `json:"cgnat,omitempty"`
+
+	// Browsing obstacles found by the portal probe.
+	CaptivePortal    *bool `json:"captive_portal,omitempty"`
+	ContentInjected  *bool `json:"content_injected,omitempty"`
+	TransparentProxy *bool `json:"transparent_proxy,omitempty"`
+	TLSIntercepted   *bool `json:"tls_intercepted,omitempty"`
+
+	// Negotiated TLS parameters and certificate health. CertExpiryDays
+	// counts down to the earliest expiry in the presented chain and goes
+	// negative once it has passed; CertValid reports whether the chain
+	// verified for the target's name.
+	TLSVersion     string   `json:"tls_version,omitempty"`
+	TLSCipher      string   `json:"tls_cipher,omitempty"`
+	ALPN           string   `json:"alpn,omitempty"`
+	OCSPStapled    *bool    `json:"ocsp_stapled,omitempty"`
+	CertExpiryDays *float64 `json:"cert_expiry_days,omitempty"`
+	CertValid      *bool    `json:"cert_valid,omitempty"`
+
+	// QUIC handshake times in milliseconds, for a fresh connection and
+	// one resuming its session, compared with ConnectTime plus TLSTime
+	// over TCP. QUIC0RTT reports the server accepted early data on
+	// resumption; UDPBlocked reports QUIC timed out while TCP worked.
+	QUICHandshake       *float64 `json:"quic_handshake,omitempty"`
+	QUICResumeHandshake *float64 `json:"quic_resume_handshake,omitempty"`
+	QUIC0RTT            *bool    `json:"quic_0rtt,omitempty"`
+	QUICVersion         string   `json:"quic_version,omitempty"`
+	UDPBlocked          *bool    `json:"udp_blocked,omitempty"`
+
+	// UnderLoad is set on passive probe measurements, true when a
+	// load-generating probe was running at the same time.
+	UnderLoad *bool `json:"under_load,omitempty"`
+
+	// DNS query asked and, with cache busting, the time to resolve a random
+	// uncached name under it. DNSTime is then a warm, cached lookup.
+	QueryName   string   `json:"query_name,omitempty"`
+	QueryType   string   `json:"query_type,omitempty"`
+	DNSTimeCold *float64 `json:"dns_time_cold,omitempty"`
+
+	// DNS answer validation. DNSAnswers holds the sorted A/AAAA addresses
+	// returned, comma separated.
+	DNSRcode         string `json:"dns_rcode,omitempty"`
+	DNSAnswerCount   *int   `json:"dns_answer_count,omitempty"`
+	DNSMinTTL        *int   `json:"dns_min_ttl,omitempty"`
+	DNSAnswers       string `json:"dns_answers,omitempty"`
+	DNSMismatch      *bool  `json:"dns_mismatch,omitempty"`
+	NXDomainRedirect *bool  `json:"nxdomain_redirect,omitempty"`
+	DNSIntercepted   *bool  `json:"dns_intercepted,omitempty"`
+
+	// Resolver DNSSEC and large-response health. DNSSECAD reports the
+	// resolver set the AD flag for the signed zones checked; DNSSECValid
+	// reports their RRSIGs verified locally. A truncated plain answer is
+	// retried over TCP, and DNSTCPFallbackTime covers both attempts.
+	DNSSECAD           *bool    `json:"dnssec_ad,omitempty"`
+	DNSSECValid        *bool    `json:"dnssec_valid,omitempty"`
+	DNSLargeResponseOK *bool    `json:"dns_large_response_ok,omitempty"`
+	DNSTCPFallbackOK   *bool    `json:"dns_tcp_fallback_ok,omitempty"`
+	DNSTCPFallbackTime *float64 `json:"dns_tcp_fallback_time,omitempty"`
+
+	// IPFamily is "ipv4" or "ipv6". With dual-stack probing, HappyEyeballs
+	// names the family an RFC 8305 client would have connected over.
+	IPFamily      string `json:"ip_family,omitempty"`
+	HappyEyeballs string `json:"happy_eyeballs,omitempty"`
+
+	// Scope tags where on the path a measurement was taken, e.g. "lan"
+	// for the default gateway.
+	Scope string `json:"scope,omitempty"`
+
+	// Protocol is the transport used, e.g. "udp", "dot", "doh" or "doq"
+	// for DNS.
+	Protocol string `json:"protocol,omitempty"`
+
+	// HTTP phase timings in milliseconds. ConnectTime and TLSTime are also
+	// used for encrypted DNS handshakes.
+	ResolveTime  *float64 `json:"resolve_time,omitempty"`
+	ConnectTime  *float64 `json:"connect_time,omitempty"`
+	TLSTime      *float64 `json:"tls_time,omitempty"`
+	TTFB         *float64 `json:"ttfb,omitempty"`
+	TransferTime *float64 `json:"transfer_time,omitempty"`
+	TotalTime    *float64 `json:"total_time,omitempty"`
+	StatusCode   *int     `json:"status_code,omitempty"`
+
+	// Path MTU in bytes, and whether oversized packets were dropped
+	// without an ICMP "fragmentation needed" reply.
+	PathMTU       *int  `json:"path_mtu,omitempty"`
+	PMTUBlackhole *bool `json:"pmtu_blackhole,omitempty"`
+
+	// Traceroute path, one entry per TTL up to the destination or, when
+	// it never answered, up to the last hop that did.
+	HopCount     *int  `json:"hop_count,omitempty"`
+	Hops         []Hop `json:"hops,omitempty"`
+	TraceReached *bool `json:"trace_reached,omitempty"`
 }
 
 // Prober is the interface all probe implementations must satisfy.
 type Prober interface {
-	// Run executes the probe and returns measurements.
-	Run() ([]Measurement, error)
+	// Run executes the probe and returns measurements. It returns early
+	// once ctx is cancelled or its deadline passes.
+	Run(ctx context.Context) ([]Measurement, error)
 	// Type returns the probe type identifier.
 	Type() ProbeType
 }
@@ -38,3 +193,13 @@ type Prober interface {
 func F64(v float64) *float64 {
 	return &v
 }
+
+// Int is a helper to create an *int from an int value.
+func Int(v int) *int {
+	return &v
+}
+
+// Bool is a helper to create a *bool from a bool value.
+func Bool(v bool) *bool {
+	return &v
+}
@@ -0,0 +1,274 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// udpStreamMagic starts every stream packet so reflectors ignore, rather
+// than echo, unrelated traffic.
+var udpStreamMagic = []byte("NPUS")
+
+// udpStreamHeaderLen covers the magic, a 32-bit sequence number, the
+// sender's transmit time and the reflector's receive time, both as Unix
+// nanoseconds. The rest of the packet is padding.
+const udpStreamHeaderLen = 24
+
+// UDPStreamProbe sends a constant-bitrate stream of sequenced UDP packets
+// to a reflector, like a VoIP call, and measures loss, reordering,
+// duplicates and delay variation in each direction. The reflector stamps
+// its receive time; sender and reflector clocks need not agree since only
+// differences between packets are used.
+type UDPStreamProbe struct {
+	targets    []string
+	rate       int
+	duration   time.Duration
+	packetSize int
+	// drain is how long to wait for late replies after the last send.
+	drain time.Duration
+}
+
+// NewUDPStreamProbe streams rate packets per second of packetSize bytes
+// to each reflector target (host:port) for duration.
+func NewUDPStreamProbe(targets []string, rate int, duration time.Duration, packetSize int) *UDPStreamProbe {
+	if rate <= 0 {
+		rate = 50
+	}
+	if duration <= 0 {
+		duration = 10 * time.Second
+	}
+	if packetSize < udpStreamHeaderLen {
+		packetSize = 172
+	}
+	return &UDPStreamProbe{
+		targets:    targets,
+		rate:       rate,
+		duration:   duration,
+		packetSize: packetSize,
+		drain:      time.Second,
+	}
+}
+
+func (p *UDPStreamProbe) Type() ProbeType {
+	return ProbeTypeUDPStream
+}
+
+func (p *UDPStreamProbe) Run(ctx context.Context) ([]Measurement, error) {
+	var wg sync.WaitGroup
+	results := make([]Measurement, len(p.targets))
+	errors := make([]error, len(p.targets))
+
+	for i, target := range p.targets {
+		wg.Add(1)
+		go func(idx int, tgt string) {
+			defer wg.Done()
+			measurement, err := p.streamTarget(ctx, tgt)
+			if err != nil {
+				errors[idx] = err
+				return
+			}
+			results[idx] = measurement
+		}(i, target)
+	}
+
+	wg.Wait()
+
+	var validResults []Measurement
+	var errs []error
+	for i, result := range results {
+		if errors[i] != nil {
+			errs = append(errs, fmt.Errorf("target %s: %w", p.targets[i], errors[i]))
+		} else {
+			validResults = append(validResults, result)
+		}
+	}
+
+	if len(validResults) == 0 && len(errs) > 0 {
+		return nil, fmt.Errorf("all targets failed: %v", errs)
+	}
+
+	return validResults, nil
+}
+
+func (p *UDPStreamProbe) streamTarget(ctx context.Context, target string) (Measurement, error) {
+	packet := make([]byte, p.packetSize)
+	copy(packet, udpStreamMagic)
+	encode := func(seq uint32, now time.Time) []byte {
+		binary.BigEndian.PutUint32(packet[4:8], seq)
+		binary.BigEndian.PutUint64(packet[8:16], uint64(now.UnixNano()))
+		return packet
+	}
+	parse := func(b []byte, received time.Time) (streamReply, bool) {
+		seq, sent, reflected, ok := parseStreamPacket(b)
+		return streamReply{
+			seq:       seq,
+			sent:      sent,
+			reflected: reflected,
+			received:  received,
+		}, ok
+	}
+
+	replies, sent, err := runStream(ctx, target, p.rate, p.duration, p.drain, encode, parse)
+	if err != nil {
+		return Measurement{}, err
+	}
+
+	measurement := summarizeStream(replies, sent)
+	measurement.ProbeType = ProbeTypeUDPStream
+	measurement.Target = target
+	return measurement, nil
+}
+
+// streamReply is one reflected packet as received by the sender. The
+// reflector's transmit time is zero when it only stamps receipt.
+type streamReply struct {
+	seq         uint32
+	sent        time.Time
+	reflected   time.Time
+	transmitted time.Time
+	received    time.Time
+}
+
+// runStream sends rate packets per second built by encode to target for
+// duration, collects replies decoded by parse until drain after the last
+// send, and returns them in arrival order along with the number sent.
+// Cancelling ctx abandons the stream.
+func runStream(
+	ctx context.Context,
+	target string,
+	rate int,
+	duration, drain time.Duration,
+	encode func(seq uint32, now time.Time) []byte,
+	parse func(b []byte, received time.Time) (streamReply, bool),
+) ([]streamReply, int, error) {
+	raddr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to resolve target: %w", err)
+	}
+
+	// An unconnected socket keeps ICMP port-unreachable errors from
+	// aborting reads; replies are filtered by source instead.
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open UDP socket: %w", err)
+	}
+	defer conn.Close()
+
+	var replies []streamReply
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 64<<10)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			received := time.Now()
+			if !from.IP.Equal(raddr.IP) || from.Port != raddr.Port {
+				continue
+			}
+			if r, ok := parse(buf[:n], received); ok {
+				replies = append(replies, r)
+			}
+		}
+	}()
+
+	count := int(duration * time.Duration(rate) / time.Second)
+	ticker := time.NewTicker(time.Second / time.Duration(rate))
+	defer ticker.Stop()
+
+	for seq := 0; seq < count; seq++ {
+		if seq > 0 {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				conn.Close()
+				<-done
+				return nil, seq, ctx.Err()
+			}
+		}
+		// A failed send is simply a lost packet.
+		conn.WriteToUDP(encode(uint32(seq), time.Now()), raddr)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(drain))
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+	<-done
+
+	if err := ctx.Err(); err != nil {
+		return nil, count, err
+	}
+
+	if len(replies) == 0 {
+		return nil, count, fmt.Errorf("no replies from reflector")
+	}
+	return replies, count, nil
+}
+
+// summarizeStream computes stream statistics from replies in arrival
+// order. A packet arriving after one with a higher sequence number counts
+// as reordered; repeats of a sequence number count as duplicates and are
+// otherwise ignored. When the reflector stamps its transmit time, its
+// processing delay is left out of the round trip. Callers set ProbeType
+// and Target.
+func summarizeStream(replies []streamReply, sent int) Measurement {
+	seen := make(map[uint32]bool, len(replies))
+	var rtts, forward, reverse []time.Duration
+	duplicates, reordered := 0, 0
+	highest := int64(-1)
+
+	for _, r := range replies {
+		if seen[r.seq] {
+			duplicates++
+			continue
+		}
+		seen[r.seq] = true
+
+		if int64(r.seq) < highest {
+			reordered++
+		} else {
+			highest = int64(r.seq)
+		}
+
+		departed := r.reflected
+		if !r.transmitted.IsZero() {
+			departed = r.transmitted
+		}
+		rtts = append(rtts, r.received.Sub(r.sent)-departed.Sub(r.reflected))
+		forward = append(forward, r.reflected.Sub(r.sent))
+		reverse = append(reverse, r.received.Sub(departed))
+	}
+
+	unique := len(rtts)
+	m := Measurement{
+		Timestamp:     time.Now(),
+		PacketLoss:    F64(float64(sent-unique) / float64(sent) * 100),
+		Duplicates:    Int(duplicates),
+		JitterForward: F64(calculateJitter(forward)),
+		JitterReverse: F64(calculateJitter(reverse)),
+	}
+	if unique > 0 {
+		m.Reordering = F64(float64(reordered) / float64(unique) * 100)
+	}
+	applyRTTStats(&m, rtts)
+
+	return m
+}
+
+// parseStreamPacket reads the header of a reflected stream packet.
+func parseStreamPacket(b []byte) (seq uint32, sent, reflected time.Time, ok bool) {
+	if len(b) < udpStreamHeaderLen || !bytes.Equal(b[:4], udpStreamMagic) {
+		return 0, time.Time{}, time.Time{}, false
+	}
+	seq = binary.BigEndian.Uint32(b[4:8])
+	sent = time.Unix(0, int64(binary.BigEndian.Uint64(b[8:16])))
+	reflected = time.Unix(0, int64(binary.BigEndian.Uint64(b[16:24])))
+	return seq, sent, reflected, true
+}
@@ -0,0 +1,246 @@
+package probe
+
+import (
+	"context"
+	"math"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// nearF64 reports whether a is set and within rounding error of b.
+func nearF64(a *float64, b float64) bool {
+	return a != nil && math.Abs(*a-b) < 1e-9
+}
+
+func TestSummarizeStream(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	// reply is seq reflected 10ms out and received 20ms back.
+	reply := func(seq uint32) streamReply {
+		sent := base.Add(time.Duration(seq) * 20 * time.Millisecond)
+		return streamReply{
+			seq:       seq,
+			sent:      sent,
+			reflected: sent.Add(10 * time.Millisecond),
+			received:  sent.Add(30 * time.Millisecond),
+		}
+	}
+
+	tests := []struct {
+		name           string
+		seqs           []uint32
+		sent           int
+		wantLoss       float64
+		wantDuplicates int
+		wantReordering float64
+	}{
+		{name: "in order", seqs: []uint32{0, 1, 2, 3}, sent: 4},
+		{name: "gap is loss, not reordering", seqs: []uint32{0, 2, 3}, sent: 4, wantLoss: 25},
+		{name: "late packet is reordered", seqs: []uint32{0, 2, 1, 3}, sent: 4, wantReordering: 25},
+		{name: "repeat is a duplicate", seqs: []uint32{0, 1, 1, 2, 3}, sent: 4, wantDuplicates: 1},
+		{
+			name:           "duplicate of a reordered packet",
+			seqs:           []uint32{1, 0, 0, 3},
+			sent:           4,
+			wantLoss:       25,
+			wantDuplicates: 1,
+			wantReordering: 100.0 / 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replies := make([]streamReply, len(tt.seqs))
+			for i, seq := range tt.seqs {
+				replies[i] = reply(seq)
+			}
+
+			m := summarizeStream(replies, tt.sent)
+			if !equalF64(m.PacketLoss, F64(tt.wantLoss)) {
+				t.Errorf("loss = %v, want %v", deref(m.PacketLoss), tt.wantLoss)
+			}
+			if *m.Duplicates != tt.wantDuplicates {
+				t.Errorf("duplicates = %d, want %d", *m.Duplicates, tt.wantDuplicates)
+			}
+			if !nearF64(m.Reordering, tt.wantReordering) {
+				t.Errorf("reordering = %v, want %v", deref(m.Reordering), tt.wantReordering)
+			}
+			if !equalF64(m.LatencyAvg, F64(30)) {
+				t.Errorf("RTT = %v, want 30ms", deref(m.LatencyAvg))
+			}
+		})
+	}
+}
+
+func TestSummarizeStreamExcludesReflectorDelay(t *testing.T) {
+	sent := time.Unix(1700000000, 0)
+	r := streamReply{
+		sent:        sent,
+		reflected:   sent.Add(10 * time.Millisecond),
+		transmitted: sent.Add(15 * time.Millisecond),
+		received:    sent.Add(30 * time.Millisecond),
+	}
+
+	m := summarizeStream([]streamReply{r}, 1)
+	if !equalF64(m.LatencyAvg, F64(25)) {
+		t.Errorf("RTT = %v, want 25ms without the reflector's 5ms", deref(m.LatencyAvg))
+	}
+}
+
+// impairedRelay forwards datagrams between a stream sender and a
+// reflector, dropping, duplicating and reordering requests by sequence
+// number. seq reads the sequence number from a request.
+type impairedRelay struct {
+	conn     net.PacketConn
+	upstream net.Conn
+	seq      func([]byte) uint32
+
+	drop, duplicate, delay uint32
+
+	mu     sync.Mutex
+	client net.Addr
+}
+
+// startImpairedRelay relays to reflector until the test ends, dropping
+// request drop, sending request duplicate twice and holding request delay
+// back until the one after it has gone.
+func startImpairedRelay(t *testing.T, reflector net.Addr, seq func([]byte) uint32, drop, duplicate, delay uint32) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream, err := net.Dial("udp", reflector.String())
+	if err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	r := &impairedRelay{conn: conn, upstream: upstream, seq: seq, drop: drop, duplicate: duplicate, delay: delay}
+	t.Cleanup(func() {
+		conn.Close()
+		upstream.Close()
+	})
+
+	go r.forward()
+	go r.backward()
+	return conn.LocalAddr().String()
+}
+
+func (r *impairedRelay) forward() {
+	buf := make([]byte, 64<<10)
+	var held []byte
+	for {
+		n, from, err := r.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		r.client = from
+		r.mu.Unlock()
+
+		switch seq := r.seq(buf[:n]); seq {
+		case r.drop:
+		case r.duplicate:
+			r.upstream.Write(buf[:n])
+			r.upstream.Write(buf[:n])
+		case r.delay:
+			held = append([]byte(nil), buf[:n]...)
+		case r.delay + 1:
+			r.upstream.Write(buf[:n])
+			r.upstream.Write(held)
+		default:
+			r.upstream.Write(buf[:n])
+		}
+	}
+}
+
+func (r *impairedRelay) backward() {
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := r.upstream.Read(buf)
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		client := r.client
+		r.mu.Unlock()
+		r.conn.WriteTo(buf[:n], client)
+	}
+}
+
+// serveReflector runs serve until the test ends.
+func serveReflector(t *testing.T, serve func(context.Context) error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- serve(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("reflector: %v", err)
+		}
+	})
+}
+
+// checkStreamImpairments checks a 20-packet stream that lost one packet,
+// had one duplicated and one reordered.
+func checkStreamImpairments(t *testing.T, m Measurement) {
+	t.Helper()
+	if !equalF64(m.PacketLoss, F64(5)) {
+		t.Errorf("loss = %v, want 5%%", deref(m.PacketLoss))
+	}
+	if m.Duplicates == nil || *m.Duplicates != 1 {
+		t.Errorf("duplicates = %v, want 1", deref(m.Duplicates))
+	}
+	if !nearF64(m.Reordering, 100.0/19) {
+		t.Errorf("reordering = %v, want one of 19 packets", deref(m.Reordering))
+	}
+	if m.LatencyAvg == nil || *m.LatencyMin < 0 {
+		t.Errorf("RTT min %v avg %v", deref(m.LatencyMin), deref(m.LatencyAvg))
+	}
+}
+
+func TestUDPStreamProbeLoopback(t *testing.T) {
+	reflector, err := ListenUDPReflector("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveReflector(t, reflector.Serve)
+
+	relay := startImpairedRelay(t, reflector.Addr(), func(b []byte) uint32 {
+		seq, _, _, _ := parseStreamPacket(b)
+		return seq
+	}, 3, 5, 7)
+
+	p := NewUDPStreamProbe([]string{relay}, 100, 200*time.Millisecond, 0)
+	p.drain = 200 * time.Millisecond
+	ms, err := p.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 1 || ms[0].ProbeType != ProbeTypeUDPStream || ms[0].Target != relay {
+		t.Fatalf("got %+v, want one UDP stream measurement of %s", ms, relay)
+	}
+	checkStreamImpairments(t, ms[0])
+}
+
+func TestUDPReflectorIgnoresForeignTraffic(t *testing.T) {
+	reflector, err := ListenUDPReflector("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveReflector(t, reflector.Serve)
+
+	conn, err := net.Dial("udp", reflector.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write(make([]byte, 64))
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if n, err := conn.Read(make([]byte, 64)); err == nil {
+		t.Errorf("reflector echoed %d bytes without the stream magic", n)
+	}
+}
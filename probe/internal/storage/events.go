@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/netpulse/probe/internal/probe"
+)
+
+type StoredEvent struct {
+	ID     int64
+	Synced bool
+	probe.Event
+}
+
+func (s *Store) SaveEvents(events []probe.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO events (timestamp, type, previous, current, detail)
+		VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, e := range events {
+		_, err := stmt.Exec(
+			e.Timestamp.UTC().Format(time.RFC3339Nano),
+			string(e.Type),
+			e.Previous,
+			e.Current,
+			e.Detail,
+		)
+		if err != nil {
+			return fmt.Errorf("insert event: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) GetUnsyncedEvents(limit int) ([]StoredEvent, error) {
+	rows, err := s.db.Query(`SELECT id, timestamp, type, previous, current, detail
+		FROM events
+		WHERE synced = 0
+		ORDER BY timestamp ASC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query unsynced events: %w", err)
+	}
+	defer rows.Close()
+
+	var results []StoredEvent
+	for rows.Next() {
+		var se StoredEvent
+		var timestampStr, typeStr string
+
+		err := rows.Scan(&se.ID, &timestampStr, &typeStr, &se.Previous, &se.Current, &se.Detail)
+		if err != nil {
+			return nil, fmt.Errorf("scan event: %w", err)
+		}
+
+		se.Timestamp, err = time.Parse(time.RFC3339Nano, timestampStr)
+		if err != nil {
+			return nil, fmt.Errorf("parse timestamp: %w", err)
+		}
+		se.Type = probe.EventType(typeStr)
+
+		results = append(results, se)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("event rows iteration: %w", err)
+	}
+
+	return results, nil
+}
+
+func (s *Store) MarkEventsSynced(ids []int64) error {
+	return s.setSyncState("events", ids, syncDone)
+}
+
+// MarkEventsRejected takes events the dashboard refused as invalid out of
+// the sync queue.
+func (s *Store) MarkEventsRejected(ids []int64) error {
+	return s.setSyncState("events", ids, syncRejected)
+}
+
+// LatestEvents returns the most recent event of each type, so stateful
+// probes can resume where they left off.
+func (s *Store) LatestEvents() ([]probe.Event, error) {
+	rows, err := s.db.Query(`SELECT timestamp, type, previous, current, detail FROM events
+		WHERE id IN (SELECT MAX(id) FROM events GROUP BY type)`)
+	if err != nil {
+		return nil, fmt.Errorf("query latest events: %w", err)
+	}
+	defer rows.Close()
+
+	var latest []probe.Event
+	for rows.Next() {
+		var e probe.Event
+		var timestampStr, typeStr string
+		if err := rows.Scan(&timestampStr, &typeStr, &e.Previous, &e.Current, &e.Detail); err != nil {
+			return nil, fmt.Errorf("scan event: %w", err)
+		}
+		e.Timestamp, err = time.Parse(time.RFC3339Nano, timestampStr)
+		if err != nil {
+			return nil, fmt.Errorf("parse timestamp: %w", err)
+		}
+		e.Type = probe.EventType(typeStr)
+		latest = append(latest, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("event rows iteration: %w", err)
+	}
+
+	return latest, nil
+}
+
+// deleteOldEvents removes synced events older than cutoff, except the
+// latest of each type, which LatestEvents still needs.
+func (s *Store) deleteOldEvents(cutoff string) error {
+	_, err := s.db.Exec(`DELETE FROM events
+		WHERE synced != 0 AND timestamp < ?
+		AND id NOT IN (SELECT MAX(id) FROM events GROUP BY type)`, cutoff)
+	if err != nil {
+		return fmt.Errorf("delete old events: %w", err)
+	}
+	return nil
+}
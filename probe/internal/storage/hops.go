@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/netpulse/probe/internal/probe"
+)
+
+func insertHops(tx *sql.Tx, measurementID int64, hops []probe.Hop) error {
+	stmt, err := tx.Prepare(`INSERT INTO traceroute_hops (
+		measurement_id, ttl, address, sent, received, latency_min,
+		latency_avg, latency_max, latency_p95, jitter, packet_loss
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("prepare hop statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, h := range hops {
+		_, err := stmt.Exec(
+			measurementID,
+			h.TTL,
+			h.Address,
+			h.Sent,
+			h.Received,
+			h.LatencyMin,
+			h.LatencyAvg,
+			h.LatencyMax,
+			h.LatencyP95,
+			h.Jitter,
+			h.PacketLoss,
+		)
+		if err != nil {
+			return fmt.Errorf("insert hop %d: %w", h.TTL, err)
+		}
+	}
+
+	return nil
+}
+
+// attachHops loads the stored path for every traceroute measurement in ms.
+func (s *Store) attachHops(ms []StoredMeasurement) error {
+	for i := range ms {
+		if ms[i].ProbeType != probe.ProbeTypeTraceroute {
+			continue
+		}
+
+		hops, err := s.getHops(ms[i].ID)
+		if err != nil {
+			return err
+		}
+		ms[i].Hops = hops
+	}
+
+	return nil
+}
+
+func (s *Store) getHops(measurementID int64) ([]probe.Hop, error) {
+	rows, err := s.db.Query(`SELECT ttl, address, sent, received, latency_min,
+		latency_avg, latency_max, latency_p95, jitter, packet_loss
+		FROM traceroute_hops
+		WHERE measurement_id = ?
+		ORDER BY ttl ASC`, measurementID)
+	if err != nil {
+		return nil, fmt.Errorf("query hops: %w", err)
+	}
+	defer rows.Close()
+
+	var hops []probe.Hop
+	for rows.Next() {
+		var h probe.Hop
+		var address sql.NullString
+
+		err := rows.Scan(
+			&h.TTL,
+			&address,
+			&h.Sent,
+			&h.Received,
+			&h.LatencyMin,
+			&h.LatencyAvg,
+			&h.LatencyMax,
+			&h.LatencyP95,
+			&h.Jitter,
+			&h.PacketLoss,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan hop: %w", err)
+		}
+		h.Address = address.String
+
+		hops = append(hops, h)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("hop rows iteration: %w", err)
+	}
+
+	return hops, nil
+}
+
+// deleteOrphanHops removes hops whose measurement has been cleaned up.
+func (s *Store) deleteOrphanHops() error {
+	_, err := s.db.Exec(`DELETE FROM traceroute_hops
+		WHERE measurement_id NOT IN (SELECT id FROM measurements)`)
+	if err != nil {
+		return fmt.Errorf("delete orphaned hops: %w", err)
+	}
+	return nil
+}
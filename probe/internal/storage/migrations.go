@@ -5,31 +5,253 @@ import (
 	"fmt"
 )
 
-const currentSchemaVersion = 1
+// migration is a set of statements that brings the schema to version.
+type migration struct {
+	version    int
+	statements []string
+}
 
-var migrations = []string{
-	`CREATE TABLE IF NOT EXISTS schema_version (
-		version INTEGER PRIMARY KEY,
-		applied_at TEXT NOT NULL DEFAULT (datetime('now'))
-	);`,
-	`CREATE TABLE IF NOT EXISTS measurements (
-		id          INTEGER PRIMARY KEY AUTOINCREMENT,
-		timestamp   TEXT NOT NULL,
-		probe_type  TEXT NOT NULL,
-		target      TEXT NOT NULL,
-		latency_min REAL,
-		latency_avg REAL,
-		latency_max REAL,
-		latency_p95 REAL,
-		jitter      REAL,
-		packet_loss REAL,
-		dns_time    REAL,
-		bufferbloat REAL,
-		synced      INTEGER NOT NULL DEFAULT 0,
-		created_at  TEXT NOT NULL DEFAULT (datetime('now'))
-	);`,
-	`CREATE INDEX IF NOT EXISTS idx_measurements_synced ON measurements(synced, timestamp);`,
-	`CREATE INDEX IF NOT EXISTS idx_measurements_timestamp ON measurements(timestamp);`,
+// migrations are applied in order. Databases created before versioning
+// already record version 1, so new schema changes must be appended as a
+// new version rather than edited into an existing one.
+var migrations = []migration{
+	{
+		version: 1,
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS measurements (
+				id          INTEGER PRIMARY KEY AUTOINCREMENT,
+				timestamp   TEXT NOT NULL,
+				probe_type  TEXT NOT NULL,
+				target      TEXT NOT NULL,
+				latency_min REAL,
+				latency_avg REAL,
+				latency_max REAL,
+				latency_p95 REAL,
+				jitter      REAL,
+				packet_loss REAL,
+				dns_time    REAL,
+				bufferbloat REAL,
+				synced      INTEGER NOT NULL DEFAULT 0,
+				created_at  TEXT NOT NULL DEFAULT (datetime('now'))
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_measurements_synced ON measurements(synced, timestamp);`,
+			`CREATE INDEX IF NOT EXISTS idx_measurements_timestamp ON measurements(timestamp);`,
+		},
+	},
+	{
+		version: 2,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN resolve_time REAL;`,
+			`ALTER TABLE measurements ADD COLUMN connect_time REAL;`,
+			`ALTER TABLE measurements ADD COLUMN tls_time REAL;`,
+			`ALTER TABLE measurements ADD COLUMN ttfb REAL;`,
+			`ALTER TABLE measurements ADD COLUMN transfer_time REAL;`,
+			`ALTER TABLE measurements ADD COLUMN total_time REAL;`,
+			`ALTER TABLE measurements ADD COLUMN status_code INTEGER;`,
+		},
+	},
+	{
+		version: 3,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN hop_count INTEGER;`,
+			`CREATE TABLE IF NOT EXISTS traceroute_hops (
+				id             INTEGER PRIMARY KEY AUTOINCREMENT,
+				measurement_id INTEGER NOT NULL,
+				ttl            INTEGER NOT NULL,
+				address        TEXT,
+				sent           INTEGER NOT NULL,
+				received       INTEGER NOT NULL,
+				latency_min    REAL,
+				latency_avg    REAL,
+				latency_max    REAL,
+				latency_p95    REAL,
+				jitter         REAL,
+				packet_loss    REAL
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_traceroute_hops_measurement ON traceroute_hops(measurement_id, ttl);`,
+		},
+	},
+	{
+		version: 4,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN latency_idle REAL;`,
+			`ALTER TABLE measurements ADD COLUMN latency_loaded_download REAL;`,
+			`ALTER TABLE measurements ADD COLUMN latency_loaded_upload REAL;`,
+			`ALTER TABLE measurements ADD COLUMN bufferbloat_download REAL;`,
+			`ALTER TABLE measurements ADD COLUMN bufferbloat_upload REAL;`,
+		},
+	},
+	{
+		version: 5,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN download_mbps REAL;`,
+			`ALTER TABLE measurements ADD COLUMN upload_mbps REAL;`,
+			`ALTER TABLE measurements ADD COLUMN bytes_transferred INTEGER;`,
+		},
+	},
+	{
+		version: 6,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN protocol TEXT NOT NULL DEFAULT '';`,
+		},
+	},
+	{
+		version: 7,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN dns_rcode TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE measurements ADD COLUMN dns_answer_count INTEGER;`,
+			`ALTER TABLE measurements ADD COLUMN dns_min_ttl INTEGER;`,
+			`ALTER TABLE measurements ADD COLUMN dns_answers TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE measurements ADD COLUMN dns_mismatch INTEGER;`,
+			`ALTER TABLE measurements ADD COLUMN nxdomain_redirect INTEGER;`,
+			`ALTER TABLE measurements ADD COLUMN dns_intercepted INTEGER;`,
+		},
+	},
+	{
+		version: 8,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN query_name TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE measurements ADD COLUMN query_type TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE measurements ADD COLUMN dns_time_cold REAL;`,
+		},
+	},
+	{
+		version: 9,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN dnssec_ad INTEGER;`,
+			`ALTER TABLE measurements ADD COLUMN dnssec_valid INTEGER;`,
+			`ALTER TABLE measurements ADD COLUMN dns_large_response_ok INTEGER;`,
+			`ALTER TABLE measurements ADD COLUMN dns_tcp_fallback_ok INTEGER;`,
+			`ALTER TABLE measurements ADD COLUMN dns_tcp_fallback_time REAL;`,
+		},
+	},
+	{
+		version: 10,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN scope TEXT NOT NULL DEFAULT '';`,
+		},
+	},
+	{
+		version: 11,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN path_mtu INTEGER;`,
+			`ALTER TABLE measurements ADD COLUMN pmtu_blackhole INTEGER;`,
+		},
+	},
+	{
+		version: 12,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN ip_family TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE measurements ADD COLUMN happy_eyeballs TEXT NOT NULL DEFAULT '';`,
+		},
+	},
+	{
+		version: 13,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN reordering REAL;`,
+			`ALTER TABLE measurements ADD COLUMN duplicates INTEGER;`,
+			`ALTER TABLE measurements ADD COLUMN jitter_forward REAL;`,
+			`ALTER TABLE measurements ADD COLUMN jitter_reverse REAL;`,
+		},
+	},
+	{
+		version: 14,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN forward_delay REAL;`,
+			`ALTER TABLE measurements ADD COLUMN reverse_delay REAL;`,
+			`ALTER TABLE measurements ADD COLUMN reflector_delay REAL;`,
+		},
+	},
+	{
+		version: 15,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN r_factor REAL;`,
+			`ALTER TABLE measurements ADD COLUMN mos REAL;`,
+			`ALTER TABLE measurements ADD COLUMN voip_codec TEXT NOT NULL DEFAULT '';`,
+		},
+	},
+	{
+		version: 16,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN clock_offset REAL;`,
+			`ALTER TABLE measurements ADD COLUMN stratum INTEGER;`,
+			`ALTER TABLE measurements ADD COLUMN clock_untrusted INTEGER;`,
+		},
+	},
+	{
+		version: 17,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN public_ip TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE measurements ADD COLUMN asn INTEGER;`,
+			`ALTER TABLE measurements ADD COLUMN as_org TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE measurements ADD COLUMN cgnat INTEGER;`,
+			`CREATE TABLE IF NOT EXISTS events (
+				id         INTEGER PRIMARY KEY AUTOINCREMENT,
+				timestamp  TEXT NOT NULL,
+				type       TEXT NOT NULL,
+				previous   TEXT NOT NULL DEFAULT '',
+				current    TEXT NOT NULL DEFAULT '',
+				detail     TEXT NOT NULL DEFAULT '',
+				synced     INTEGER NOT NULL DEFAULT 0,
+				created_at TEXT NOT NULL DEFAULT (datetime('now'))
+			);`,
+			`CREATE INDEX IF NOT EXISTS idx_events_synced ON events(synced, timestamp);`,
+			`CREATE INDEX IF NOT EXISTS idx_events_type ON events(type, id);`,
+		},
+	},
+	{
+		version: 18,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN captive_portal INTEGER;`,
+			`ALTER TABLE measurements ADD COLUMN content_injected INTEGER;`,
+			`ALTER TABLE measurements ADD COLUMN transparent_proxy INTEGER;`,
+			`ALTER TABLE measurements ADD COLUMN tls_intercepted INTEGER;`,
+		},
+	},
+	{
+		version: 19,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN tls_version TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE measurements ADD COLUMN tls_cipher TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE measurements ADD COLUMN alpn TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE measurements ADD COLUMN ocsp_stapled INTEGER;`,
+			`ALTER TABLE measurements ADD COLUMN cert_expiry_days REAL;`,
+			`ALTER TABLE measurements ADD COLUMN cert_valid INTEGER;`,
+		},
+	},
+	{
+		version: 20,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN quic_handshake REAL;`,
+			`ALTER TABLE measurements ADD COLUMN quic_resume_handshake REAL;`,
+			`ALTER TABLE measurements ADD COLUMN quic_0rtt INTEGER;`,
+			`ALTER TABLE measurements ADD COLUMN quic_version TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE measurements ADD COLUMN udp_blocked INTEGER;`,
+		},
+	},
+	{
+		version: 21,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN under_load INTEGER;`,
+		},
+	},
+	{
+		version: 22,
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS data_usage (
+				budget TEXT NOT NULL,
+				day    TEXT NOT NULL,
+				bytes  INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (budget, day)
+			);`,
+		},
+	},
+	{
+		version: 23,
+		statements: []string{
+			`ALTER TABLE measurements ADD COLUMN trace_reached INTEGER;`,
+		},
+	},
 }
 
 func runMigrations(db *sql.DB) error {
@@ -39,10 +261,12 @@ func runMigrations(db *sql.DB) error {
 	}
 	defer tx.Rollback()
 
-	for _, migration := range migrations {
-		if _, err := tx.Exec(migration); err != nil {
-			return fmt.Errorf("execute migration: %w", err)
-		}
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL DEFAULT (datetime('now'))
+	);`)
+	if err != nil {
+		return fmt.Errorf("create schema_version table: %w", err)
 	}
 
 	var currentVersion int
@@ -51,8 +275,18 @@ func runMigrations(db *sql.DB) error {
 		return fmt.Errorf("query schema version: %w", err)
 	}
 
-	if currentVersion < currentSchemaVersion {
-		_, err = tx.Exec("INSERT INTO schema_version (version) VALUES (?)", currentSchemaVersion)
+	for _, m := range migrations {
+		if m.version <= currentVersion {
+			continue
+		}
+
+		for _, stmt := range m.statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				return fmt.Errorf("execute migration %d: %w", m.version, err)
+			}
+		}
+
+		_, err = tx.Exec("INSERT INTO schema_version (version) VALUES (?)", m.version)
 		if err != nil {
 			return fmt.Errorf("update schema version: %w", err)
 		}
@@ -5,12 +5,22 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/netpulse/probe/internal/probe"
 )
 
+// Values of the synced column of measurements and events, which is 0
+// until a push. Rejected rows were refused by the dashboard as invalid,
+// say for a timestamp taken before the clock was set; they stay in local
+// history but are never pushed again.
+const (
+	syncDone     = 1
+	syncRejected = 2
+)
+
 type Store struct {
 	db *sql.DB
 }
@@ -47,14 +57,53 @@ func NewStore(dbPath string) (*Store, error) {
 	return &Store{db: db}, nil
 }
 
-func (s *Store) SaveMeasurement(m probe.Measurement) error {
-	query := `INSERT INTO measurements (
-		timestamp, probe_type, target, latency_min, latency_avg, latency_max,
-		latency_p95, jitter, packet_loss, dns_time, bufferbloat
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+// measurementColumns lists the measurements table columns written by
+// SaveMeasurement(s) and read back by GetUnsynced, in argument order.
+var measurementColumns = []string{
+	"timestamp", "probe_type", "target",
+	"latency_min", "latency_avg", "latency_max", "latency_p95",
+	"jitter", "packet_loss", "dns_time", "bufferbloat",
+	"resolve_time", "connect_time", "tls_time", "ttfb",
+	"transfer_time", "total_time", "status_code",
+	"hop_count",
+	"latency_idle", "latency_loaded_download", "latency_loaded_upload",
+	"bufferbloat_download", "bufferbloat_upload",
+	"download_mbps", "upload_mbps", "bytes_transferred",
+	"protocol",
+	"dns_rcode", "dns_answer_count", "dns_min_ttl", "dns_answers",
+	"dns_mismatch", "nxdomain_redirect", "dns_intercepted",
+	"query_name", "query_type", "dns_time_cold",
+	"dnssec_ad", "dnssec_valid", "dns_large_response_ok",
+	"dns_tcp_fallback_ok", "dns_tcp_fallback_time",
+	"scope",
+	"path_mtu", "pmtu_blackhole",
+	"ip_family", "happy_eyeballs",
+	"reordering", "duplicates", "jitter_forward",
+	"jitter_reverse",
+	"forward_delay", "reverse_delay", "reflector_delay",
+	"r_factor", "mos", "voip_codec",
+	"clock_offset", "stratum", "clock_untrusted",
+	"public_ip", "asn", "as_org",
+	"cgnat",
+	"captive_portal", "content_injected", "transparent_proxy",
+	"tls_intercepted",
+	"tls_version", "tls_cipher", "alpn",
+	"ocsp_stapled", "cert_expiry_days", "cert_valid",
+	"quic_handshake", "quic_resume_handshake", "quic_0rtt",
+	"quic_version", "udp_blocked",
+	"under_load",
+	"trace_reached",
+}
+
+var insertMeasurementQuery = fmt.Sprintf(
+	"INSERT INTO measurements (%s) VALUES (%s)",
+	strings.Join(measurementColumns, ", "),
+	strings.TrimSuffix(strings.Repeat("?, ", len(measurementColumns)), ", "),
+)
 
-	_, err := s.db.Exec(
-		query,
+// measurementArgs returns the values for m in measurementColumns order.
+func measurementArgs(m probe.Measurement) []any {
+	return []any{
 		m.Timestamp.UTC().Format(time.RFC3339Nano),
 		string(m.ProbeType),
 		m.Target,
@@ -66,12 +115,82 @@ func (s *Store) SaveMeasurement(m probe.Measurement) error {
 		m.PacketLoss,
 		m.DNSTime,
 		m.Bufferbloat,
-	)
-	if err != nil {
-		return fmt.Errorf("insert measurement: %w", err)
+		m.ResolveTime,
+		m.ConnectTime,
+		m.TLSTime,
+		m.TTFB,
+		m.TransferTime,
+		m.TotalTime,
+		m.StatusCode,
+		m.HopCount,
+		m.LatencyIdle,
+		m.LatencyLoadedDownload,
+		m.LatencyLoadedUpload,
+		m.BufferbloatDownload,
+		m.BufferbloatUpload,
+		m.DownloadMbps,
+		m.UploadMbps,
+		m.BytesTransferred,
+		m.Protocol,
+		m.DNSRcode,
+		m.DNSAnswerCount,
+		m.DNSMinTTL,
+		m.DNSAnswers,
+		m.DNSMismatch,
+		m.NXDomainRedirect,
+		m.DNSIntercepted,
+		m.QueryName,
+		m.QueryType,
+		m.DNSTimeCold,
+		m.DNSSECAD,
+		m.DNSSECValid,
+		m.DNSLargeResponseOK,
+		m.DNSTCPFallbackOK,
+		m.DNSTCPFallbackTime,
+		m.Scope,
+		m.PathMTU,
+		m.PMTUBlackhole,
+		m.IPFamily,
+		m.HappyEyeballs,
+		m.Reordering,
+		m.Duplicates,
+		m.JitterForward,
+		m.JitterReverse,
+		m.ForwardDelay,
+		m.ReverseDelay,
+		m.ReflectorDelay,
+		m.RFactor,
+		m.MOS,
+		m.VoIPCodec,
+		m.ClockOffset,
+		m.Stratum,
+		m.ClockUntrusted,
+		m.PublicIP,
+		m.ASN,
+		m.ASOrg,
+		m.CGNAT,
+		m.CaptivePortal,
+		m.ContentInjected,
+		m.TransparentProxy,
+		m.TLSIntercepted,
+		m.TLSVersion,
+		m.TLSCipher,
+		m.ALPN,
+		m.OCSPStapled,
+		m.CertExpiryDays,
+		m.CertValid,
+		m.QUICHandshake,
+		m.QUICResumeHandshake,
+		m.QUIC0RTT,
+		m.QUICVersion,
+		m.UDPBlocked,
+		m.UnderLoad,
+		m.TraceReached,
 	}
+}
 
-	return nil
+func (s *Store) SaveMeasurement(m probe.Measurement) error {
+	return s.SaveMeasurements([]probe.Measurement{m})
 }
 
 func (s *Store) SaveMeasurements(ms []probe.Measurement) error {
@@ -85,32 +204,27 @@ func (s *Store) SaveMeasurements(ms []probe.Measurement) error {
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(`INSERT INTO measurements (
-		timestamp, probe_type, target, latency_min, latency_avg, latency_max,
-		latency_p95, jitter, packet_loss, dns_time, bufferbloat
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	stmt, err := tx.Prepare(insertMeasurementQuery)
 	if err != nil {
 		return fmt.Errorf("prepare statement: %w", err)
 	}
 	defer stmt.Close()
 
 	for _, m := range ms {
-		_, err := stmt.Exec(
-			m.Timestamp.UTC().Format(time.RFC3339Nano),
-			string(m.ProbeType),
-			m.Target,
-			m.LatencyMin,
-			m.LatencyAvg,
-			m.LatencyMax,
-			m.LatencyP95,
-			m.Jitter,
-			m.PacketLoss,
-			m.DNSTime,
-			m.Bufferbloat,
-		)
+		result, err := stmt.Exec(measurementArgs(m)...)
 		if err != nil {
 			return fmt.Errorf("insert measurement: %w", err)
 		}
+
+		if len(m.Hops) > 0 {
+			id, err := result.LastInsertId()
+			if err != nil {
+				return fmt.Errorf("get measurement id: %w", err)
+			}
+			if err := insertHops(tx, id, m.Hops); err != nil {
+				return err
+			}
+		}
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -121,12 +235,11 @@ func (s *Store) SaveMeasurements(ms []probe.Measurement) error {
 }
 
 func (s *Store) GetUnsynced(limit int) ([]StoredMeasurement, error) {
-	query := `SELECT id, timestamp, probe_type, target, latency_min, latency_avg,
-		latency_max, latency_p95, jitter, packet_loss, dns_time, bufferbloat, synced
+	query := fmt.Sprintf(`SELECT id, %s, synced
 		FROM measurements
 		WHERE synced = 0
 		ORDER BY timestamp ASC
-		LIMIT ?`
+		LIMIT ?`, strings.Join(measurementColumns, ", "))
 
 	rows, err := s.db.Query(query, limit)
 	if err != nil {
@@ -154,6 +267,77 @@ func (s *Store) GetUnsynced(limit int) ([]StoredMeasurement, error) {
 			&sm.PacketLoss,
 			&sm.DNSTime,
 			&sm.Bufferbloat,
+			&sm.ResolveTime,
+			&sm.ConnectTime,
+			&sm.TLSTime,
+			&sm.TTFB,
+			&sm.TransferTime,
+			&sm.TotalTime,
+			&sm.StatusCode,
+			&sm.HopCount,
+			&sm.LatencyIdle,
+			&sm.LatencyLoadedDownload,
+			&sm.LatencyLoadedUpload,
+			&sm.BufferbloatDownload,
+			&sm.BufferbloatUpload,
+			&sm.DownloadMbps,
+			&sm.UploadMbps,
+			&sm.BytesTransferred,
+			&sm.Protocol,
+			&sm.DNSRcode,
+			&sm.DNSAnswerCount,
+			&sm.DNSMinTTL,
+			&sm.DNSAnswers,
+			&sm.DNSMismatch,
+			&sm.NXDomainRedirect,
+			&sm.DNSIntercepted,
+			&sm.QueryName,
+			&sm.QueryType,
+			&sm.DNSTimeCold,
+			&sm.DNSSECAD,
+			&sm.DNSSECValid,
+			&sm.DNSLargeResponseOK,
+			&sm.DNSTCPFallbackOK,
+			&sm.DNSTCPFallbackTime,
+			&sm.Scope,
+			&sm.PathMTU,
+			&sm.PMTUBlackhole,
+			&sm.IPFamily,
+			&sm.HappyEyeballs,
+			&sm.Reordering,
+			&sm.Duplicates,
+			&sm.JitterForward,
+			&sm.JitterReverse,
+			&sm.ForwardDelay,
+			&sm.ReverseDelay,
+			&sm.ReflectorDelay,
+			&sm.RFactor,
+			&sm.MOS,
+			&sm.VoIPCodec,
+			&sm.ClockOffset,
+			&sm.Stratum,
+			&sm.ClockUntrusted,
+			&sm.PublicIP,
+			&sm.ASN,
+			&sm.ASOrg,
+			&sm.CGNAT,
+			&sm.CaptivePortal,
+			&sm.ContentInjected,
+			&sm.TransparentProxy,
+			&sm.TLSIntercepted,
+			&sm.TLSVersion,
+			&sm.TLSCipher,
+			&sm.ALPN,
+			&sm.OCSPStapled,
+			&sm.CertExpiryDays,
+			&sm.CertValid,
+			&sm.QUICHandshake,
+			&sm.QUICResumeHandshake,
+			&sm.QUIC0RTT,
+			&sm.QUICVersion,
+			&sm.UDPBlocked,
+			&sm.UnderLoad,
+			&sm.TraceReached,
 			&syncedInt,
 		)
 		if err != nil {
@@ -174,11 +358,27 @@ func (s *Store) GetUnsynced(limit int) ([]StoredMeasurement, error) {
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("rows iteration: %w", err)
 	}
+	rows.Close()
+
+	if err := s.attachHops(results); err != nil {
+		return nil, err
+	}
 
 	return results, nil
 }
 
 func (s *Store) MarkSynced(ids []int64) error {
+	return s.setSyncState("measurements", ids, syncDone)
+}
+
+// MarkRejected takes measurements the dashboard refused as invalid out of
+// the sync queue.
+func (s *Store) MarkRejected(ids []int64) error {
+	return s.setSyncState("measurements", ids, syncRejected)
+}
+
+// setSyncState sets the synced column of the rows of table with ids.
+func (s *Store) setSyncState(table string, ids []int64, state int) error {
 	if len(ids) == 0 {
 		return nil
 	}
@@ -189,15 +389,15 @@ func (s *Store) MarkSynced(ids []int64) error {
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare("UPDATE measurements SET synced = 1 WHERE id = ?")
+	stmt, err := tx.Prepare(fmt.Sprintf("UPDATE %s SET synced = ? WHERE id = ?", table))
 	if err != nil {
 		return fmt.Errorf("prepare statement: %w", err)
 	}
 	defer stmt.Close()
 
 	for _, id := range ids {
-		if _, err := stmt.Exec(id); err != nil {
-			return fmt.Errorf("mark measurement %d as synced: %w", id, err)
+		if _, err := stmt.Exec(state, id); err != nil {
+			return fmt.Errorf("set sync state of %s row %d: %w", table, id, err)
 		}
 	}
 
@@ -212,7 +412,7 @@ func (s *Store) Cleanup(retentionDays int) error {
 	cutoff := time.Now().UTC().AddDate(0, 0, -retentionDays)
 	cutoffStr := cutoff.Format(time.RFC3339Nano)
 
-	query := "DELETE FROM measurements WHERE synced = 1 AND timestamp < ?"
+	query := "DELETE FROM measurements WHERE synced != 0 AND timestamp < ?"
 	result, err := s.db.Exec(query, cutoffStr)
 	if err != nil {
 		return fmt.Errorf("delete old measurements: %w", err)
@@ -223,7 +423,17 @@ func (s *Store) Cleanup(retentionDays int) error {
 		return fmt.Errorf("get rows affected: %w", err)
 	}
 
+	if err := s.deleteOldEvents(cutoffStr); err != nil {
+		return err
+	}
+	if err := s.deleteOldUsage(); err != nil {
+		return err
+	}
+
 	if rowsAffected > 0 {
+		if err := s.deleteOrphanHops(); err != nil {
+			return err
+		}
 		if _, err := s.db.Exec("VACUUM"); err != nil {
 			return fmt.Errorf("vacuum database: %w", err)
 		}
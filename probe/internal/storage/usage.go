@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// DataUsage returns the bytes recorded against budget for days from to to
+// inclusive, formatted as 2006-01-02.
+func (s *Store) DataUsage(budget, from, to string) (int64, error) {
+	var total int64
+	err := s.db.QueryRow(`SELECT COALESCE(SUM(bytes), 0) FROM data_usage
+		WHERE budget = ? AND day >= ? AND day <= ?`, budget, from, to).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("query data usage: %w", err)
+	}
+	return total, nil
+}
+
+// AddDataUsage adds n bytes to budget's usage on day.
+func (s *Store) AddDataUsage(budget, day string, n int64) error {
+	_, err := s.db.Exec(`INSERT INTO data_usage (budget, day, bytes) VALUES (?, ?, ?)
+		ON CONFLICT (budget, day) DO UPDATE SET bytes = bytes + excluded.bytes`, budget, day, n)
+	if err != nil {
+		return fmt.Errorf("add data usage: %w", err)
+	}
+	return nil
+}
+
+// deleteOldUsage drops usage from before last month, which no budget
+// looks at any more.
+func (s *Store) deleteOldUsage() error {
+	now := time.Now()
+	cutoff := time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, now.Location())
+	_, err := s.db.Exec("DELETE FROM data_usage WHERE day < ?", cutoff.Format("2006-01-02"))
+	if err != nil {
+		return fmt.Errorf("delete old data usage: %w", err)
+	}
+	return nil
+}
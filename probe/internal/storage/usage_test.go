@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDataUsage(t *testing.T) {
+	s, err := NewStore(filepath.Join(t.TempDir(), "netpulse.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	adds := []struct {
+		budget, day string
+		n           int64
+	}{
+		{"throughput", "2026-02-28", 1000},
+		{"throughput", "2026-03-01", 300},
+		{"throughput", "2026-03-01", 200},
+		{"throughput", "2026-03-02", 40},
+		{"bufferbloat", "2026-03-01", 7},
+	}
+	for _, a := range adds {
+		if err := s.AddDataUsage(a.budget, a.day, a.n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		budget, from, to string
+		want             int64
+	}{
+		{"throughput", "2026-03-01", "2026-03-01", 500},
+		{"throughput", "2026-03-01", "2026-03-31", 540},
+		{"throughput", "2026-02-01", "2026-03-31", 1540},
+		{"throughput", "2026-03-03", "2026-03-03", 0},
+		{"bufferbloat", "2026-03-01", "2026-03-31", 7},
+		{"link", "2026-03-01", "2026-03-31", 0},
+	}
+	for _, tt := range tests {
+		got, err := s.DataUsage(tt.budget, tt.from, tt.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("DataUsage(%q, %s, %s) = %d, want %d", tt.budget, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -14,42 +15,236 @@ import (
 
 // StoredMeasurement mirrors the storage layer's stored measurement type.
 type StoredMeasurement struct {
-	ID         int64    `json:"id"`
-	Timestamp  string   `json:"timestamp"`
-	ProbeType  string   `json:"probe_type"`
-	Target     string   `json:"target"`
+	ID                    int64    `json:"id"`
+	Timestamp             string   `json:"timestamp"`
+	ProbeType             string   `json:"probe_type"`
+	Target                string   `json:"target"`
+	LatencyMin            *float64 `json:"latency_min,omitempty"`
+	LatencyAvg            *float64 `json:"latency_avg,omitempty"`
+	LatencyMax            *float64 `json:"latency_max,omitempty"`
+	LatencyP95            *float64 `json:"latency_p95,omitempty"`
+	Jitter                *float64 `json:"jitter,omitempty"`
+	PacketLoss            *float64 `json:"packet_loss,omitempty"`
+	DNSTime               *float64 `json:"dns_time,omitempty"`
+	Bufferbloat           *float64 `json:"bufferbloat,omitempty"`
+	ResolveTime           *float64 `json:"resolve_time,omitempty"`
+	ConnectTime           *float64 `json:"connect_time,omitempty"`
+	TLSTime               *float64 `json:"tls_time,omitempty"`
+	TTFB                  *float64 `json:"ttfb,omitempty"`
+	TransferTime          *float64 `json:"transfer_time,omitempty"`
+	TotalTime             *float64 `json:"total_time,omitempty"`
+	StatusCode            *int     `json:"status_code,omitempty"`
+	HopCount              *int     `json:"hop_count,omitempty"`
+	Hops                  []Hop    `json:"hops,omitempty"`
+	LatencyIdle           *float64 `json:"latency_idle,omitempty"`
+	LatencyLoadedDownload *float64 `json:"latency_loaded_download,omitempty"`
+	LatencyLoadedUpload   *float64 `json:"latency_loaded_upload,omitempty"`
+	BufferbloatDownload   *float64 `json:"bufferbloat_download,omitempty"`
+	BufferbloatUpload     *float64 `json:"bufferbloat_upload,omitempty"`
+	DownloadMbps          *float64 `json:"download_mbps,omitempty"`
+	UploadMbps            *float64 `json:"upload_mbps,omitempty"`
+	BytesTransferred      *int64   `json:"bytes_transferred,omitempty"`
+	Protocol              string   `json:"protocol,omitempty"`
+	DNSRcode              string   `json:"dns_rcode,omitempty"`
+	DNSAnswerCount        *int     `json:"dns_answer_count,omitempty"`
+	DNSMinTTL             *int     `json:"dns_min_ttl,omitempty"`
+	DNSAnswers            string   `json:"dns_answers,omitempty"`
+	DNSMismatch           *bool    `json:"dns_mismatch,omitempty"`
+	NXDomainRedirect      *bool    `json:"nxdomain_redirect,omitempty"`
+	DNSIntercepted        *bool    `json:"dns_intercepted,omitempty"`
+	QueryName             string   `json:"query_name,omitempty"`
+	QueryType             string   `json:"query_type,omitempty"`
+	DNSTimeCold           *float64 `json:"dns_time_cold,omitempty"`
+	DNSSECAD              *bool    `json:"dnssec_ad,omitempty"`
+	DNSSECValid           *bool    `json:"dnssec_valid,omitempty"`
+	DNSLargeResponseOK    *bool    `json:"dns_large_response_ok,omitempty"`
+	DNSTCPFallbackOK      *bool    `json:"dns_tcp_fallback_ok,omitempty"`
+	DNSTCPFallbackTime    *float64 `json:"dns_tcp_fallback_time,omitempty"`
+	Scope                 string   `json:"scope,omitempty"`
+	PathMTU               *int     `json:"path_mtu,omitempty"`
+	PMTUBlackhole         *bool    `json:"pmtu_blackhole,omitempty"`
+	IPFamily              string   `json:"ip_family,omitempty"`
+	HappyEyeballs         string   `json:"happy_eyeballs,omitempty"`
+	Reordering            *float64 `json:"reordering,omitempty"`
+	Duplicates            *int     `json:"duplicates,omitempty"`
+	JitterForward         *float64 `json:"jitter_forward,omitempty"`
+	JitterReverse         *float64 `json:"jitter_reverse,omitempty"`
+	ForwardDelay          *float64 `json:"forward_delay,omitempty"`
+	ReverseDelay          *float64 `json:"reverse_delay,omitempty"`
+	ReflectorDelay        *float64 `json:"reflector_delay,omitempty"`
+	RFactor               *float64 `json:"r_factor,omitempty"`
+	MOS                   *float64 `json:"mos,omitempty"`
+	VoIPCodec             string   `json:"voip_codec,omitempty"`
+	ClockOffset           *float64 `json:"clock_offset,omitempty"`
+	Stratum               *int     `json:"stratum,omitempty"`
+	ClockUntrusted        *bool    `json:"clock_untrusted,omitempty"`
+	PublicIP              string   `json:"public_ip,omitempty"`
+	ASN                   *int     `json:"asn,omitempty"`
+	ASOrg                 string   `json:"as_org,omitempty"`
+	CGNAT                 *bool    `json:"cgnat,omitempty"`
+	CaptivePortal         *bool    `json:"captive_portal,omitempty"`
+	ContentInjected       *bool    `json:"content_injected,omitempty"`
+	TransparentProxy      *bool    `json:"transparent_proxy,omitempty"`
+	TLSIntercepted        *bool    `json:"tls_intercepted,omitempty"`
+	TLSVersion            string   `json:"tls_version,omitempty"`
+	TLSCipher             string   `json:"tls_cipher,omitempty"`
+	ALPN                  string   `json:"alpn,omitempty"`
+	OCSPStapled           *bool    `json:"ocsp_stapled,omitempty"`
+	CertExpiryDays        *float64 `json:"cert_expiry_days,omitempty"`
+	CertValid             *bool    `json:"cert_valid,omitempty"`
+	QUICHandshake         *float64 `json:"quic_handshake,omitempty"`
+	QUICResumeHandshake   *float64 `json:"quic_resume_handshake,omitempty"`
+	QUIC0RTT              *bool    `json:"quic_0rtt,omitempty"`
+	QUICVersion           string   `json:"quic_version,omitempty"`
+	UDPBlocked            *bool    `json:"udp_blocked,omitempty"`
+	UnderLoad             *bool    `json:"under_load,omitempty"`
+	TraceReached          *bool    `json:"trace_reached,omitempty"`
+}
+
+// Hop is a single traceroute hop attached to a measurement.
+type Hop struct {
+	TTL        int      `json:"ttl"`
+	Address    string   `json:"address,omitempty"`
+	Sent       int      `json:"sent"`
+	Received   int      `json:"received"`
 	LatencyMin *float64 `json:"latency_min,omitempty"`
 	LatencyAvg *float64 `json:"latency_avg,omitempty"`
 	LatencyMax *float64 `json:"latency_max,omitempty"`
 	LatencyP95 *float64 `json:"latency_p95,omitempty"`
 	Jitter     *float64 `json:"jitter,omitempty"`
 	PacketLoss *float64 `json:"packet_loss,omitempty"`
-	DNSTime    *float64 `json:"dns_time,omitempty"`
-	Bufferbloat *float64 `json:"bufferbloat,omitempty"`
+}
+
+// StoredEvent mirrors the storage layer's stored event type.
+type StoredEvent struct {
+	ID        int64  `json:"id"`
+	Timestamp string `json:"timestamp"`
+	Type      string `json:"type"`
+	Previous  string `json:"previous,omitempty"`
+	Current   string `json:"current"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// IngestEvent is a single network event in the ingest payload.
+type IngestEvent struct {
+	Timestamp string `json:"timestamp"`
+	Type      string `json:"type"`
+	Previous  string `json:"previous,omitempty"`
+	Current   string `json:"current"`
+	Detail    string `json:"detail,omitempty"`
 }
 
 // IngestPayload is the JSON body sent to the dashboard ingest endpoint.
 type IngestPayload struct {
 	ProbeID      string              `json:"probe_id"`
 	Measurements []IngestMeasurement `json:"measurements"`
+	Events       []IngestEvent       `json:"events,omitempty"`
+}
+
+// IngestResponse is the dashboard's reply to an ingest request. Events is
+// the number of events stored, and is absent from servers that predate
+// event ingest.
+type IngestResponse struct {
+	Accepted int  `json:"accepted"`
+	Rejected int  `json:"rejected"`
+	Events   *int `json:"events"`
 }
 
 // IngestMeasurement is a single measurement in the ingest payload.
 type IngestMeasurement struct {
-	Timestamp   string   `json:"timestamp"`
-	Target      string   `json:"target"`
-	LatencyAvg  *float64 `json:"latency_avg,omitempty"`
-	LatencyP95  *float64 `json:"latency_p95,omitempty"`
-	Jitter      *float64 `json:"jitter,omitempty"`
-	PacketLoss  *float64 `json:"packet_loss,omitempty"`
-	DNSTime     *float64 `json:"dns_time,omitempty"`
-	Bufferbloat *float64 `json:"bufferbloat,omitempty"`
+	Timestamp             string   `json:"timestamp"`
+	ProbeType             string   `json:"probe_type,omitempty"`
+	Target                string   `json:"target"`
+	LatencyAvg            *float64 `json:"latency_avg,omitempty"`
+	LatencyP95            *float64 `json:"latency_p95,omitempty"`
+	Jitter                *float64 `json:"jitter,omitempty"`
+	PacketLoss            *float64 `json:"packet_loss,omitempty"`
+	DNSTime               *float64 `json:"dns_time,omitempty"`
+	Bufferbloat           *float64 `json:"bufferbloat,omitempty"`
+	ResolveTime           *float64 `json:"resolve_time,omitempty"`
+	ConnectTime           *float64 `json:"connect_time,omitempty"`
+	TLSTime               *float64 `json:"tls_time,omitempty"`
+	TTFB                  *float64 `json:"ttfb,omitempty"`
+	TransferTime          *float64 `json:"transfer_time,omitempty"`
+	TotalTime             *float64 `json:"total_time,omitempty"`
+	StatusCode            *int     `json:"status_code,omitempty"`
+	HopCount              *int     `json:"hop_count,omitempty"`
+	Hops                  []Hop    `json:"hops,omitempty"`
+	LatencyIdle           *float64 `json:"latency_idle,omitempty"`
+	LatencyLoadedDownload *float64 `json:"latency_loaded_download,omitempty"`
+	LatencyLoadedUpload   *float64 `json:"latency_loaded_upload,omitempty"`
+	BufferbloatDownload   *float64 `json:"bufferbloat_download,omitempty"`
+	BufferbloatUpload     *float64 `json:"bufferbloat_upload,omitempty"`
+	DownloadMbps          *float64 `json:"download_mbps,omitempty"`
+	UploadMbps            *float64 `json:"upload_mbps,omitempty"`
+	BytesTransferred      *int64   `json:"bytes_transferred,omitempty"`
+	Protocol              string   `json:"protocol,omitempty"`
+	DNSRcode              string   `json:"dns_rcode,omitempty"`
+	DNSAnswerCount        *int     `json:"dns_answer_count,omitempty"`
+	DNSMinTTL             *int     `json:"dns_min_ttl,omitempty"`
+	DNSAnswers            string   `json:"dns_answers,omitempty"`
+	DNSMismatch           *bool    `json:"dns_mismatch,omitempty"`
+	NXDomainRedirect      *bool    `json:"nxdomain_redirect,omitempty"`
+	DNSIntercepted        *bool    `json:"dns_intercepted,omitempty"`
+	QueryName             string   `json:"query_name,omitempty"`
+	QueryType             string   `json:"query_type,omitempty"`
+	DNSTimeCold           *float64 `json:"dns_time_cold,omitempty"`
+	DNSSECAD              *bool    `json:"dnssec_ad,omitempty"`
+	DNSSECValid           *bool    `json:"dnssec_valid,omitempty"`
+	DNSLargeResponseOK    *bool    `json:"dns_large_response_ok,omitempty"`
+	DNSTCPFallbackOK      *bool    `json:"dns_tcp_fallback_ok,omitempty"`
+	DNSTCPFallbackTime    *float64 `json:"dns_tcp_fallback_time,omitempty"`
+	Scope                 string   `json:"scope,omitempty"`
+	PathMTU               *int     `json:"path_mtu,omitempty"`
+	PMTUBlackhole         *bool    `json:"pmtu_blackhole,omitempty"`
+	IPFamily              string   `json:"ip_family,omitempty"`
+	HappyEyeballs         string   `json:"happy_eyeballs,omitempty"`
+	Reordering            *float64 `json:"reordering,omitempty"`
+	Duplicates            *int     `json:"duplicates,omitempty"`
+	JitterForward         *float64 `json:"jitter_forward,omitempty"`
+	JitterReverse         *float64 `json:"jitter_reverse,omitempty"`
+	ForwardDelay          *float64 `json:"forward_delay,omitempty"`
+	ReverseDelay          *float64 `json:"reverse_delay,omitempty"`
+	ReflectorDelay        *float64 `json:"reflector_delay,omitempty"`
+	RFactor               *float64 `json:"r_factor,omitempty"`
+	MOS                   *float64 `json:"mos,omitempty"`
+	VoIPCodec             string   `json:"voip_codec,omitempty"`
+	ClockOffset           *float64 `json:"clock_offset,omitempty"`
+	Stratum               *int     `json:"stratum,omitempty"`
+	ClockUntrusted        *bool    `json:"clock_untrusted,omitempty"`
+	PublicIP              string   `json:"public_ip,omitempty"`
+	ASN                   *int     `json:"asn,omitempty"`
+	ASOrg                 string   `json:"as_org,omitempty"`
+	CGNAT                 *bool    `json:"cgnat,omitempty"`
+	CaptivePortal         *bool    `json:"captive_portal,omitempty"`
+	ContentInjected       *bool    `json:"content_injected,omitempty"`
+	TransparentProxy      *bool    `json:"transparent_proxy,omitempty"`
+	TLSIntercepted        *bool    `json:"tls_intercepted,omitempty"`
+	TLSVersion            string   `json:"tls_version,omitempty"`
+	TLSCipher             string   `json:"tls_cipher,omitempty"`
+	ALPN                  string   `json:"alpn,omitempty"`
+	OCSPStapled           *bool    `json:"ocsp_stapled,omitempty"`
+	CertExpiryDays        *float64 `json:"cert_expiry_days,omitempty"`
+	CertValid             *bool    `json:"cert_valid,omitempty"`
+	QUICHandshake         *float64 `json:"quic_handshake,omitempty"`
+	QUICResumeHandshake   *float64 `json:"quic_resume_handshake,omitempty"`
+	QUIC0RTT              *bool    `json:"quic_0rtt,omitempty"`
+	QUICVersion           string   `json:"quic_version,omitempty"`
+	UDPBlocked            *bool    `json:"udp_blocked,omitempty"`
+	UnderLoad             *bool    `json:"under_load,omitempty"`
+	TraceReached          *bool    `json:"trace_reached,omitempty"`
 }
 
-// UnsyncedFetcher retrieves unsynced measurements from storage.
+// UnsyncedFetcher retrieves unsynced measurements and events from storage.
+// Rejected rows are ones the server refused as invalid; they must not be
+// returned as unsynced again.
 type UnsyncedFetcher interface {
 	GetUnsynced(limit int) ([]StoredMeasurement, error)
 	MarkSynced(ids []int64) error
+	MarkRejected(ids []int64) error
+	GetUnsyncedEvents(limit int) ([]StoredEvent, error)
+	MarkEventsSynced(ids []int64) error
+	MarkEventsRejected(ids []int64) error
 }
 
 // Pusher batches and pushes measurements to the dashboard server.
@@ -99,7 +294,9 @@ func (p *Pusher) Run(ctx context.Context, interval time.Duration) {
 	}
 }
 
-// pushAll sends all unsynced measurements in batches.
+// pushAll sends all unsynced measurements in batches. Unsynced events ride
+// along with the measurements, since the ingest endpoint requires at least
+// one measurement per payload.
 func (p *Pusher) pushAll() {
 	for {
 		measurements, err := p.fetcher.GetUnsynced(p.batchSize)
@@ -112,7 +309,23 @@ func (p *Pusher) pushAll() {
 			return
 		}
 
-		if err := p.pushBatch(measurements); err != nil {
+		events, err := p.fetcher.GetUnsyncedEvents(p.batchSize)
+		if err != nil {
+			p.logger.Error("failed to fetch unsynced events", "error", err)
+			return
+		}
+
+		resp, err := p.pushBatch(measurements, events)
+		var rejected *rejectedRowsError
+		if errors.As(err, &rejected) {
+			// Invalid rows would be refused on every retry and hold back
+			// everything queued behind them.
+			if !p.dropRejected(measurements, events, rejected) {
+				return
+			}
+			continue
+		}
+		if err != nil {
 			p.logger.Warn("push failed, will retry next cycle",
 				"batch_size", len(measurements),
 				"error", err,
@@ -130,8 +343,29 @@ func (p *Pusher) pushAll() {
 			return
 		}
 
+		// Servers that do not acknowledge events dropped them, so they stay
+		// unsynced until one does.
+		if len(events) > 0 && resp.Events == nil {
+			p.logger.Debug("server does not accept events, keeping them for later",
+				"events", len(events),
+			)
+			events = nil
+		}
+
+		if len(events) > 0 {
+			eventIDs := make([]int64, len(events))
+			for i, e := range events {
+				eventIDs[i] = e.ID
+			}
+			if err := p.fetcher.MarkEventsSynced(eventIDs); err != nil {
+				p.logger.Error("failed to mark events as synced", "error", err)
+				return
+			}
+		}
+
 		p.logger.Info("pushed measurements",
 			"count", len(measurements),
+			"events", len(events),
 		)
 
 		// If we got a full batch, there may be more.
@@ -141,44 +375,222 @@ func (p *Pusher) pushAll() {
 	}
 }
 
-func (p *Pusher) pushBatch(measurements []StoredMeasurement) error {
+// dropRejected marks the rows the server rejected so that they are not
+// pushed again, and reports whether it succeeded.
+func (p *Pusher) dropRejected(measurements []StoredMeasurement, events []StoredEvent, rejected *rejectedRowsError) bool {
+	var ids, eventIDs []int64
+	for _, i := range rejected.measurements {
+		if i < len(measurements) {
+			ids = append(ids, measurements[i].ID)
+		}
+	}
+	for _, i := range rejected.events {
+		if i < len(events) {
+			eventIDs = append(eventIDs, events[i].ID)
+		}
+	}
+	if len(ids) == 0 && len(eventIDs) == 0 {
+		p.logger.Warn("push failed, will retry next cycle", "batch_size", len(measurements), "error", rejected)
+		return false
+	}
+
+	if err := p.fetcher.MarkRejected(ids); err != nil {
+		p.logger.Error("failed to mark measurements as rejected", "error", err)
+		return false
+	}
+	if err := p.fetcher.MarkEventsRejected(eventIDs); err != nil {
+		p.logger.Error("failed to mark events as rejected", "error", err)
+		return false
+	}
+
+	p.logger.Warn("server rejected invalid rows, skipping them",
+		"measurements", len(ids),
+		"events", len(eventIDs),
+		"reason", rejected.reason,
+	)
+	return true
+}
+
+// rejectedRowsError is a 400 response from the ingest endpoint. The
+// measurements and events fields index the rows of the batch that failed
+// validation; issues with the payload as a whole point at no row.
+type rejectedRowsError struct {
+	body         string
+	measurements []int
+	events       []int
+	// reason is the first row's validation message.
+	reason string
+}
+
+func (e *rejectedRowsError) Error() string {
+	return fmt.Sprintf("server returned %d: %s", http.StatusBadRequest, e.body)
+}
+
+// parseRejectedRows reads the validation issues of a 400 response, each
+// of which has a path such as ["measurements", 3, "timestamp"].
+func parseRejectedRows(body []byte) *rejectedRowsError {
+	rejected := &rejectedRowsError{body: string(body)}
+	var resp struct {
+		Details []struct {
+			Path    []any  `json:"path"`
+			Message string `json:"message"`
+		} `json:"details"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return rejected
+	}
+
+	type row struct {
+		field string
+		index int
+	}
+	seen := make(map[row]bool)
+	for _, issue := range resp.Details {
+		if len(issue.Path) < 2 {
+			continue
+		}
+		field, _ := issue.Path[0].(string)
+		index, ok := issue.Path[1].(float64)
+		if !ok || seen[row{field, int(index)}] {
+			continue
+		}
+		switch field {
+		case "measurements":
+			rejected.measurements = append(rejected.measurements, int(index))
+		case "events":
+			rejected.events = append(rejected.events, int(index))
+		default:
+			continue
+		}
+		seen[row{field, int(index)}] = true
+		if rejected.reason == "" {
+			rejected.reason = issue.Message
+		}
+	}
+	return rejected
+}
+
+func (p *Pusher) pushBatch(measurements []StoredMeasurement, events []StoredEvent) (IngestResponse, error) {
 	payload := IngestPayload{
 		ProbeID:      p.probeID,
 		Measurements: make([]IngestMeasurement, len(measurements)),
 	}
 
+	for _, e := range events {
+		payload.Events = append(payload.Events, IngestEvent{
+			Timestamp: e.Timestamp,
+			Type:      e.Type,
+			Previous:  e.Previous,
+			Current:   e.Current,
+			Detail:    e.Detail,
+		})
+	}
+
 	for i, m := range measurements {
 		payload.Measurements[i] = IngestMeasurement{
-			Timestamp:   m.Timestamp,
-			Target:      m.Target,
-			LatencyAvg:  m.LatencyAvg,
-			LatencyP95:  m.LatencyP95,
-			Jitter:      m.Jitter,
-			PacketLoss:  m.PacketLoss,
-			DNSTime:     m.DNSTime,
-			Bufferbloat: m.Bufferbloat,
+			Timestamp:             m.Timestamp,
+			ProbeType:             m.ProbeType,
+			Target:                m.Target,
+			LatencyAvg:            m.LatencyAvg,
+			LatencyP95:            m.LatencyP95,
+			Jitter:                m.Jitter,
+			PacketLoss:            m.PacketLoss,
+			DNSTime:               m.DNSTime,
+			Bufferbloat:           m.Bufferbloat,
+			ResolveTime:           m.ResolveTime,
+			ConnectTime:           m.ConnectTime,
+			TLSTime:               m.TLSTime,
+			TTFB:                  m.TTFB,
+			TransferTime:          m.TransferTime,
+			TotalTime:             m.TotalTime,
+			StatusCode:            m.StatusCode,
+			HopCount:              m.HopCount,
+			Hops:                  m.Hops,
+			LatencyIdle:           m.LatencyIdle,
+			LatencyLoadedDownload: m.LatencyLoadedDownload,
+			LatencyLoadedUpload:   m.LatencyLoadedUpload,
+			BufferbloatDownload:   m.BufferbloatDownload,
+			BufferbloatUpload:     m.BufferbloatUpload,
+			DownloadMbps:          m.DownloadMbps,
+			UploadMbps:            m.UploadMbps,
+			BytesTransferred:      m.BytesTransferred,
+			Protocol:              m.Protocol,
+			DNSRcode:              m.DNSRcode,
+			DNSAnswerCount:        m.DNSAnswerCount,
+			DNSMinTTL:             m.DNSMinTTL,
+			DNSAnswers:            m.DNSAnswers,
+			DNSMismatch:           m.DNSMismatch,
+			NXDomainRedirect:      m.NXDomainRedirect,
+			DNSIntercepted:        m.DNSIntercepted,
+			QueryName:             m.QueryName,
+			QueryType:             m.QueryType,
+			DNSTimeCold:           m.DNSTimeCold,
+			DNSSECAD:              m.DNSSECAD,
+			DNSSECValid:           m.DNSSECValid,
+			DNSLargeResponseOK:    m.DNSLargeResponseOK,
+			DNSTCPFallbackOK:      m.DNSTCPFallbackOK,
+			DNSTCPFallbackTime:    m.DNSTCPFallbackTime,
+			Scope:                 m.Scope,
+			PathMTU:               m.PathMTU,
+			PMTUBlackhole:         m.PMTUBlackhole,
+			IPFamily:              m.IPFamily,
+			HappyEyeballs:         m.HappyEyeballs,
+			Reordering:            m.Reordering,
+			Duplicates:            m.Duplicates,
+			JitterForward:         m.JitterForward,
+			JitterReverse:         m.JitterReverse,
+			ForwardDelay:          m.ForwardDelay,
+			ReverseDelay:          m.ReverseDelay,
+			ReflectorDelay:        m.ReflectorDelay,
+			RFactor:               m.RFactor,
+			MOS:                   m.MOS,
+			VoIPCodec:             m.VoIPCodec,
+			ClockOffset:           m.ClockOffset,
+			Stratum:               m.Stratum,
+			ClockUntrusted:        m.ClockUntrusted,
+			PublicIP:              m.PublicIP,
+			ASN:                   m.ASN,
+			ASOrg:                 m.ASOrg,
+			CGNAT:                 m.CGNAT,
+			CaptivePortal:         m.CaptivePortal,
+			ContentInjected:       m.ContentInjected,
+			TransparentProxy:      m.TransparentProxy,
+			TLSIntercepted:        m.TLSIntercepted,
+			TLSVersion:            m.TLSVersion,
+			TLSCipher:             m.TLSCipher,
+			ALPN:                  m.ALPN,
+			OCSPStapled:           m.OCSPStapled,
+			CertExpiryDays:        m.CertExpiryDays,
+			CertValid:             m.CertValid,
+			QUICHandshake:         m.QUICHandshake,
+			QUICResumeHandshake:   m.QUICResumeHandshake,
+			QUIC0RTT:              m.QUIC0RTT,
+			QUICVersion:           m.QUICVersion,
+			UDPBlocked:            m.UDPBlocked,
+			UnderLoad:             m.UnderLoad,
+			TraceReached:          m.TraceReached,
 		}
 	}
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("marshaling payload: %w", err)
+		return IngestResponse{}, fmt.Errorf("marshaling payload: %w", err)
 	}
 
 	// Gzip compress the payload.
 	var buf bytes.Buffer
 	gz := gzip.NewWriter(&buf)
 	if _, err := gz.Write(jsonData); err != nil {
-		return fmt.Errorf("compressing payload: %w", err)
+		return IngestResponse{}, fmt.Errorf("compressing payload: %w", err)
 	}
 	if err := gz.Close(); err != nil {
-		return fmt.Errorf("closing gzip writer: %w", err)
+		return IngestResponse{}, fmt.Errorf("closing gzip writer: %w", err)
 	}
 
 	url := fmt.Sprintf("%s/api/v1/ingest", p.serverURL)
 	req, err := http.NewRequest("POST", url, &buf)
 	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
+		return IngestResponse{}, fmt.Errorf("creating request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -187,19 +599,27 @@ func (p *Pusher) pushBatch(measurements []StoredMeasurement) error {
 
 	resp, err := p.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("sending request: %w", err)
+		return IngestResponse{}, fmt.Errorf("sending request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, _ := io.ReadAll(resp.Body)
 
 	if resp.StatusCode == http.StatusTooManyRequests {
-		return fmt.Errorf("rate limited by server")
+		return IngestResponse{}, fmt.Errorf("rate limited by server")
+	}
+
+	if resp.StatusCode == http.StatusBadRequest {
+		return IngestResponse{}, parseRejectedRows(body)
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusMultiStatus {
-		return fmt.Errorf("server returned %d: %s", resp.StatusCode, string(body))
+		return IngestResponse{}, fmt.Errorf("server returned %d: %s", resp.StatusCode, string(body))
 	}
 
-	return nil
+	// The measurements were stored whatever the body says, so a body that
+	// does not parse only loses the event acknowledgement.
+	var ingest IngestResponse
+	json.Unmarshal(body, &ingest)
+	return ingest, nil
 }
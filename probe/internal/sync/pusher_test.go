@@ -0,0 +1,155 @@
+package sync
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+type fakeFetcher struct {
+	measurements   []StoredMeasurement
+	events         []StoredEvent
+	synced         []int64
+	rejected       []int64
+	eventsSynced   []int64
+	eventsRejected []int64
+}
+
+func (f *fakeFetcher) GetUnsynced(limit int) ([]StoredMeasurement, error) {
+	var unsynced []StoredMeasurement
+	for _, m := range f.measurements {
+		if !slices.Contains(f.synced, m.ID) && !slices.Contains(f.rejected, m.ID) {
+			unsynced = append(unsynced, m)
+		}
+	}
+	return unsynced, nil
+}
+
+func (f *fakeFetcher) MarkSynced(ids []int64) error {
+	f.synced = append(f.synced, ids...)
+	return nil
+}
+
+func (f *fakeFetcher) MarkRejected(ids []int64) error {
+	f.rejected = append(f.rejected, ids...)
+	return nil
+}
+
+func (f *fakeFetcher) GetUnsyncedEvents(limit int) ([]StoredEvent, error) {
+	var unsynced []StoredEvent
+	for _, e := range f.events {
+		if !slices.Contains(f.eventsSynced, e.ID) && !slices.Contains(f.eventsRejected, e.ID) {
+			unsynced = append(unsynced, e)
+		}
+	}
+	return unsynced, nil
+}
+
+func (f *fakeFetcher) MarkEventsSynced(ids []int64) error {
+	f.eventsSynced = append(f.eventsSynced, ids...)
+	return nil
+}
+
+func (f *fakeFetcher) MarkEventsRejected(ids []int64) error {
+	f.eventsRejected = append(f.eventsRejected, ids...)
+	return nil
+}
+
+func TestPushAllEventAcknowledgement(t *testing.T) {
+	tests := []struct {
+		name             string
+		status           int
+		body             string
+		wantSynced       int
+		wantEventsSynced int
+	}{
+		{
+			name:             "server stores events",
+			status:           http.StatusOK,
+			body:             `{"accepted":1,"rejected":0,"events":1}`,
+			wantSynced:       1,
+			wantEventsSynced: 1,
+		},
+		{
+			name:       "server predates event ingest",
+			status:     http.StatusOK,
+			body:       `{"accepted":1,"rejected":0}`,
+			wantSynced: 1,
+		},
+		{
+			name:       "unparseable body",
+			status:     http.StatusOK,
+			body:       `ok`,
+			wantSynced: 1,
+		},
+		{
+			name:   "server rejects the batch",
+			status: http.StatusBadRequest,
+			body:   `{"error":"Invalid payload"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			fetcher := &fakeFetcher{
+				measurements: []StoredMeasurement{{ID: 1, Timestamp: "2026-03-01T12:00:00Z", Target: "1.1.1.1"}},
+				events:       []StoredEvent{{ID: 7, Timestamp: "2026-03-01T12:00:00Z", Type: "public_ip_changed", Current: "192.0.2.1"}},
+			}
+			p := NewPusher(srv.URL, "key", "probe", fetcher, slog.New(slog.DiscardHandler))
+			p.pushAll()
+
+			if len(fetcher.synced) != tt.wantSynced || len(fetcher.eventsSynced) != tt.wantEventsSynced {
+				t.Errorf("synced %d measurements and %d events, want %d and %d",
+					len(fetcher.synced), len(fetcher.eventsSynced), tt.wantSynced, tt.wantEventsSynced)
+			}
+		})
+	}
+}
+
+func TestPushAllSkipsRejectedRows(t *testing.T) {
+	// The dashboard's validation issues for a measurement stamped before
+	// the clock was set and an event with the same problem.
+	const invalid = `{"error":"Invalid payload","details":[
+		{"path":["measurements",1,"timestamp"],"message":"Timestamp must be within last 7 days"},
+		{"path":["measurements",1,"target"],"message":"Required"},
+		{"path":["events",0,"timestamp"],"message":"Timestamp must be within last 7 days"}]}`
+
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, invalid)
+			return
+		}
+		io.WriteString(w, `{"accepted":2,"rejected":0,"events":0}`)
+	}))
+	defer srv.Close()
+
+	fetcher := &fakeFetcher{
+		measurements: []StoredMeasurement{
+			{ID: 1, Timestamp: "2026-03-01T12:00:00Z", Target: "1.1.1.1"},
+			{ID: 2, Timestamp: "1970-01-01T00:00:42Z", Target: "1.1.1.1"},
+			{ID: 3, Timestamp: "2026-03-01T12:00:30Z", Target: "1.1.1.1"},
+		},
+		events: []StoredEvent{{ID: 7, Timestamp: "1970-01-01T00:00:42Z", Type: "public_ip_changed", Current: "192.0.2.1"}},
+	}
+	p := NewPusher(srv.URL, "key", "probe", fetcher, slog.New(slog.DiscardHandler))
+	p.pushAll()
+
+	if !slices.Equal(fetcher.rejected, []int64{2}) || !slices.Equal(fetcher.eventsRejected, []int64{7}) {
+		t.Errorf("rejected measurements %v and events %v, want [2] and [7]", fetcher.rejected, fetcher.eventsRejected)
+	}
+	if !slices.Equal(fetcher.synced, []int64{1, 3}) {
+		t.Errorf("synced %v, want the valid rows [1 3] pushed on the retry", fetcher.synced)
+	}
+}